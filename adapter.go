@@ -119,6 +119,11 @@ func (h *HlogAdapter) SetOutput(w io.Writer) {
 	h.logger.SetOutput(w)
 }
 
+// Flush blocks until queued events have been written, see ZLogger.Flush
+func (h *HlogAdapter) Flush() error {
+	return h.logger.Flush()
+}
+
 // Convenience function to set hlog's default logger to use our ZLogger
 func SetAsHlogDefault(zlogger *ZLogger) {
 	adapter := NewHlogAdapter(zlogger)
@@ -0,0 +1,198 @@
+// Package zlog provides asynchronous output for slow writers
+package zlog
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrWriterClosed is returned when writing to a closed AsyncWriter or FileWriter
+var ErrWriterClosed = errors.New("zlog: writer is closed")
+
+// DefaultAsyncQueueSize is the queue length used when WithAsync is given a non-positive size
+const DefaultAsyncQueueSize = 1024
+
+// AsyncWriter queues writes and performs them on a background goroutine.
+// When the queue is full new events are dropped instead of blocking the caller.
+type AsyncWriter struct {
+	out     io.Writer
+	queue   chan []byte
+	flushCh chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	closeOnce sync.Once
+	closed    atomic.Bool
+	dropped   atomic.Uint64
+	metrics   atomic.Pointer[metricsRecorder]
+}
+
+// NewAsyncWriter creates an AsyncWriter writing to out with a queue of size events
+func NewAsyncWriter(out io.Writer, size int) *AsyncWriter {
+	if size <= 0 {
+		size = DefaultAsyncQueueSize
+	}
+	a := &AsyncWriter{
+		out:     out,
+		queue:   make(chan []byte, size),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// WithAsync makes the logger write through an AsyncWriter with a queue of size events
+func WithAsync(size int) Option {
+	return func(c *config) {
+		c.asyncQueueSize = size
+		c.async = true
+	}
+}
+
+// Write implements the io.Writer interface; p is copied before being queued
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrWriterClosed
+	}
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	select {
+	case a.queue <- buf:
+	default:
+		a.recordDropped()
+	}
+	return len(p), nil
+}
+
+// run drains the queue until the writer is closed
+func (a *AsyncWriter) run() {
+	defer close(a.stopped)
+	for {
+		select {
+		case p := <-a.queue:
+			a.write(p)
+		case ack := <-a.flushCh:
+			a.drain()
+			close(ack)
+		case <-a.done:
+			a.drain()
+			return
+		}
+	}
+}
+
+// drain writes every event currently queued
+func (a *AsyncWriter) drain() {
+	for {
+		select {
+		case p := <-a.queue:
+			a.write(p)
+		default:
+			return
+		}
+	}
+}
+
+// write performs a single queued write, counting failures as dropped events
+func (a *AsyncWriter) write(p []byte) {
+	if _, err := a.out.Write(p); err != nil {
+		a.recordDropped()
+	}
+}
+
+// recordDropped counts an event that will never reach the output
+func (a *AsyncWriter) recordDropped() {
+	a.dropped.Add(1)
+	if m := a.metrics.Load(); m != nil {
+		m.recordDropped()
+	}
+}
+
+// setMetrics attaches a recorder that counts dropped events and reports the queue depth
+func (a *AsyncWriter) setMetrics(m *metricsRecorder) {
+	a.metrics.Store(m)
+}
+
+// Flush blocks until every event queued before the call has been written
+func (a *AsyncWriter) Flush() error {
+	if a.closed.Load() {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case a.flushCh <- ack:
+		<-ack
+	case <-a.stopped:
+	}
+	return nil
+}
+
+// Close writes the remaining queued events and stops the background goroutine
+func (a *AsyncWriter) Close() error {
+	a.closeOnce.Do(func() {
+		a.closed.Store(true)
+		close(a.done)
+	})
+	<-a.stopped
+	return nil
+}
+
+// QueueDepth returns the number of events waiting to be written
+func (a *AsyncWriter) QueueDepth() int {
+	return len(a.queue)
+}
+
+// QueueCapacity returns the maximum number of events the queue holds
+func (a *AsyncWriter) QueueCapacity() int {
+	return cap(a.queue)
+}
+
+// Dropped returns the number of events dropped because the queue was full or the output failed
+func (a *AsyncWriter) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Flush blocks until events queued by asynchronous outputs of the logger have been written
+func (zl *ZLogger) Flush() error {
+	var err error
+	walkWriters(zl.core().chain.out, func(w io.Writer) {
+		if f, ok := w.(interface{ Flush() error }); ok {
+			if ferr := f.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	})
+	return err
+}
+
+// Close flushes the logger, stops the async writers and closes the route files it created.
+// Outputs passed in by the caller are left open.
+func (zl *ZLogger) Close() error {
+	err := zl.Flush()
+	s := zl.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chain := s.core.Load().chain
+	// Outermost writers first, so that events they still hold reach the inner ones
+	var closers []io.Closer
+	if chain.async != nil {
+		closers = append(closers, chain.async)
+	}
+	closers = append(closers, s.retired...)
+	if chain.durable != nil {
+		closers = append(closers, chain.durable)
+	}
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		closers = append(closers, s.closers[i])
+	}
+	for _, c := range closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockedBuffer is a bytes.Buffer written from the goroutine of an AsyncWriter
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// gatedWriter blocks every write until release is closed, reporting each write on entered
+type gatedWriter struct {
+	lockedBuffer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return g.lockedBuffer.Write(p)
+}
+
+// brokenWriter rejects every write
+type brokenWriter struct{}
+
+func (brokenWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAsyncWriterFlushAndClose(t *testing.T) {
+	out := &lockedBuffer{}
+	w := NewAsyncWriter(out, 16)
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		n, err := w.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "a\nb\nc\n", out.String())
+
+	_, err := w.Write([]byte("d\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "a\nb\nc\nd\n", out.String(), "Close drains the queue")
+	require.NoError(t, w.Close())
+
+	_, err = w.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+	assert.NoError(t, w.Flush())
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	out := &gatedWriter{entered: make(chan struct{}, 4), release: make(chan struct{})}
+	w := NewAsyncWriter(out, 1)
+	assert.Equal(t, 1, w.QueueCapacity())
+
+	_, _ = w.Write([]byte("1\n"))
+	<-out.entered // the goroutine holds the first event, the queue is empty
+	_, _ = w.Write([]byte("2\n"))
+	n, err := w.Write([]byte("3\n"))
+	assert.NoError(t, err, "a full queue never blocks nor fails the caller")
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, w.QueueDepth())
+	assert.Equal(t, uint64(1), w.Dropped())
+
+	close(out.release)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "1\n2\n", out.String())
+}
+
+func TestAsyncWriterCountsFailedWrites(t *testing.T) {
+	w := NewAsyncWriter(brokenWriter{}, 0)
+	defer w.Close()
+	assert.Equal(t, DefaultAsyncQueueSize, w.QueueCapacity())
+
+	_, err := w.Write([]byte("lost\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, uint64(1), w.Dropped())
+}
+
+func TestWithAsync(t *testing.T) {
+	out := &lockedBuffer{}
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithAsync(16))
+	logger.Info("queued")
+	require.NoError(t, logger.Flush())
+	assert.Contains(t, out.String(), `"message":"queued"`)
+
+	logger.Info("closing")
+	require.NoError(t, logger.Close())
+	assert.Contains(t, out.String(), `"message":"closing"`)
+}
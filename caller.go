@@ -0,0 +1,186 @@
+// Package zlog provides caller annotation that looks through zlog's own wrappers
+package zlog
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// CallerFuncKey is the field holding the calling function when WithCallerFunction is enabled
+const CallerFuncKey = "func"
+
+// maxCallerDepth bounds how far up the stack the caller is searched for
+const maxCallerDepth = 32
+
+// CallerMode selects how the file of the caller is rendered
+type CallerMode int
+
+const (
+	// CallerShortPath renders the parent directory and file name, e.g. "service/handler.go:42"
+	CallerShortPath CallerMode = iota
+	// CallerFullPath renders the absolute file path
+	CallerFullPath
+)
+
+// callerSkipPrefixes are function name prefixes of logging layers that are never reported as the caller
+var callerSkipPrefixes = []string{
+	"github.com/rs/zerolog.",
+	"github.com/cloudwego/hertz/pkg/common/hlog.",
+	"runtime.",
+}
+
+// zlogPackagePrefix is the function name prefix of this package, e.g. "github.com/v-mars/zlog."
+var zlogPackagePrefix = packagePrefix(reflect.ValueOf(New).Pointer())
+
+// helpers holds the names of functions marked through Helper
+var helpers sync.Map
+
+// packagePrefix returns the package part of the function at pc, including the trailing dot
+func packagePrefix(pc uintptr) string {
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	return name[:slash+1+dot+1]
+}
+
+// Helper marks the calling function as a logging helper, like testing.T.Helper.
+// When the caller is reported, frames of helper functions are skipped so the
+// location that called the helper is shown instead.
+func Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		helpers.Store(fn.Name(), struct{}{})
+	}
+}
+
+// WithCaller reports the file and line of the code that called the logger.
+// Frames of ZLogger, RotatingLogger, HlogAdapter, the hlog package functions and
+// functions marked with Helper are skipped automatically.
+func WithCaller(mode CallerMode) Option {
+	return func(c *config) {
+		c.caller = true
+		c.callerMode = mode
+	}
+}
+
+// WithCallerFunction additionally reports the name of the calling function; it enables the caller
+func WithCallerFunction() Option {
+	return func(c *config) {
+		c.caller = true
+		c.callerFunction = true
+	}
+}
+
+// WithCallerSkip skips skip additional frames above the automatically detected caller; it enables the caller
+func WithCallerSkip(skip int) Option {
+	return func(c *config) {
+		c.caller = true
+		c.callerSkip = skip
+	}
+}
+
+// CallerWithSkipFrameCount adds zerolog's caller field, skipping skipFrameCount frames counted
+// from zerolog, e.g. 3 to report the code calling ZLogger; 0 or less leaves the caller off.
+// It is ignored when the caller is enabled by WithCaller, WithCallerFunction or WithCallerSkip.
+//
+// Deprecated: the frame count depends on the wrappers between the code and zerolog. Use
+// WithCaller and WithCallerSkip, which skip zlog's own frames, or mark wrappers with Helper.
+func CallerWithSkipFrameCount(skipFrameCount int) Option {
+	return func(c *config) {
+		c.skipFrameCount = skipFrameCount
+	}
+}
+
+// callerHook is a zerolog hook that adds the caller of the logging call to each event
+type callerHook struct {
+	mode     CallerMode
+	function bool
+	skip     int
+}
+
+// newCallerHook creates the caller hook described by cfg, or nil when caller reporting is disabled
+func newCallerHook(cfg *config) *callerHook {
+	if !cfg.caller {
+		return nil
+	}
+	return &callerHook{mode: cfg.callerMode, function: cfg.callerFunction, skip: cfg.callerSkip}
+}
+
+// Run implements the zerolog.Hook interface
+func (h *callerHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	frame, ok := h.caller()
+	if !ok {
+		return
+	}
+	e.Str(zerolog.CallerFieldName, h.formatFile(frame.File)+":"+strconv.Itoa(frame.Line))
+	if h.function {
+		e.Str(CallerFuncKey, h.formatFunction(frame.Function))
+	}
+}
+
+// caller finds the first frame outside of the logging layers, then skips h.skip more frames
+func (h *callerHook) caller() (runtime.Frame, bool) {
+	var pcs [maxCallerDepth]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	skip := h.skip
+	for {
+		frame, more := frames.Next()
+		if !isLoggingFrame(frame) {
+			if skip == 0 {
+				return frame, true
+			}
+			skip--
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// isLoggingFrame reports whether frame belongs to a logging layer rather than to the caller
+func isLoggingFrame(frame runtime.Frame) bool {
+	fn := frame.Function
+	if strings.HasPrefix(fn, zlogPackagePrefix) && !strings.HasSuffix(frame.File, "_test.go") {
+		return true
+	}
+	for _, prefix := range callerSkipPrefixes {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+	_, helper := helpers.Load(fn)
+	return helper
+}
+
+// formatFile renders a file path according to the caller mode
+func (h *callerHook) formatFile(file string) string {
+	if h.mode == CallerFullPath {
+		return file
+	}
+	dir, name := filepath.Split(file)
+	if dir == "" {
+		return name
+	}
+	return filepath.Join(filepath.Base(dir), name)
+}
+
+// formatFunction renders a function name according to the caller mode
+func (h *callerHook) formatFunction(fn string) string {
+	if h.mode == CallerFullPath {
+		return fn
+	}
+	if slash := strings.LastIndex(fn, "/"); slash >= 0 {
+		return fn[slash+1:]
+	}
+	return fn
+}
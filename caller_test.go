@@ -0,0 +1,127 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+)
+
+// lineAbove returns the short caller of the line above the one that called it
+func lineAbove() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", filepath.Join(filepath.Base(filepath.Dir(file)), filepath.Base(file)), line-1)
+}
+
+// logThroughHelper logs on behalf of its caller
+func logThroughHelper(logger *ZLogger, msg string) {
+	Helper()
+	logger.Info(msg)
+}
+
+func TestCallerPointsAtUserCode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithCaller(CallerShortPath))
+
+	logger.Info("direct")
+	want := lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+
+	buf.Reset()
+	logger.CtxErrorf(nil, "ctx")
+	want = lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+
+	buf.Reset()
+	logger.ErrorErr(fmt.Errorf("boom"), "err")
+	want = lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+}
+
+func TestCallerThroughWrappers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithCaller(CallerShortPath))
+
+	adapter := NewHlogAdapter(logger)
+	adapter.Infof("adapter")
+	want := lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+
+	rotating := &RotatingLogger{baseLogger: logger}
+	buf.Reset()
+	rotating.Warn("rotating")
+	want = lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+
+	previous := hertzlog.DefaultLogger()
+	defer hertzlog.SetLogger(previous)
+	hertzlog.SetLogger(adapter)
+	buf.Reset()
+	hertzlog.Info("hlog package")
+	want = lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+}
+
+func TestCallerSkipsHelpers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithCaller(CallerShortPath))
+
+	logThroughHelper(logger, "helped")
+	want := lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+}
+
+func TestCallerFullPathAndFunction(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithCaller(CallerFullPath), WithCallerFunction())
+
+	logger.Info("full")
+	_, file, line, _ := runtime.Caller(0)
+	entry := decodeLine(t, buf)
+	assert.Equal(t, fmt.Sprintf("%s:%d", file, line-1), entry["caller"])
+	assert.Equal(t, "github.com/v-mars/zlog.TestCallerFullPathAndFunction", entry[CallerFuncKey])
+
+	buf.Reset()
+	short := New(WithOutput(buf), WithFormat(JSONFormat), WithCallerFunction())
+	short.Info("short")
+	assert.Equal(t, "zlog.TestCallerFullPathAndFunction", decodeLine(t, buf)[CallerFuncKey])
+}
+
+func TestCallerLegacySkipFrameCount(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), CallerWithSkipFrameCount(3))
+
+	// The frames are counted from zerolog and the file is rendered by zerolog, in full
+	logger.Info("legacy")
+	_, file, line, _ := runtime.Caller(0)
+	assert.Equal(t, fmt.Sprintf("%s:%d", file, line-1), decodeLine(t, buf)["caller"])
+
+	buf.Reset()
+	logger.SetOutput(buf)
+	logger.Info("after SetOutput")
+	_, _, line, _ = runtime.Caller(0)
+	assert.Equal(t, fmt.Sprintf("%s:%d", file, line-1), decodeLine(t, buf)["caller"])
+
+	buf.Reset()
+	New(WithOutput(buf), WithFormat(JSONFormat), CallerWithSkipFrameCount(0)).Info("off")
+	assert.NotContains(t, decodeLine(t, buf), "caller")
+
+	// The caller of WithCaller replaces the legacy one
+	buf.Reset()
+	New(WithOutput(buf), WithFormat(JSONFormat), CallerWithSkipFrameCount(3), WithCaller(CallerShortPath)).Info("detected")
+	want := lineAbove()
+	assert.Equal(t, want, decodeLine(t, buf)["caller"])
+}
+
+func TestCallerDisabledByDefault(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+
+	logger.SetOutput(buf)
+	logger.Info("no caller")
+	assert.NotContains(t, decodeLine(t, buf), "caller")
+}
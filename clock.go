@@ -0,0 +1,144 @@
+// Package zlog provides the clock behind timestamps, rotation, retention and sampling
+package zlog
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Clock tells the time to a logger and its writers, e.g. a fake clock in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface
+type ClockFunc func() time.Time
+
+// Now implements the Clock interface
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// systemClock is the Clock of the system time
+type systemClock struct{}
+
+// Now implements the Clock interface
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock of the system time, used unless WithClock is given
+var SystemClock Clock = systemClock{}
+
+// WithClock sets the clock used for the timestamps of events, the time-based rotation and
+// retention of the file writers in the output that have no RotateConfig.Clock of their own,
+// the windows of a BurstSampler set with WithSampler, fallback retries and the flight recorder
+func WithClock(clock Clock) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// clockSource is a Clock that can be replaced while in use, the system clock until set
+type clockSource struct {
+	clock atomic.Pointer[Clock]
+}
+
+// newClockSource creates a clockSource telling the time of clock, or of the system clock when nil
+func newClockSource(clock Clock) *clockSource {
+	s := &clockSource{}
+	if clock != nil {
+		s.set(clock)
+	}
+	return s
+}
+
+// Now implements the Clock interface
+func (s *clockSource) Now() time.Time {
+	if c := s.clock.Load(); c != nil {
+		return (*c).Now()
+	}
+	return time.Now()
+}
+
+// set replaces the clock
+func (s *clockSource) set(clock Clock) {
+	s.clock.Store(&clock)
+}
+
+// setDefault sets the clock unless one was set before
+func (s *clockSource) setDefault(clock Clock) {
+	s.clock.CompareAndSwap(nil, &clock)
+}
+
+// clockHook adds the timestamp of the clock to every event, in place of zerolog.TimestampFunc
+type clockHook struct {
+	clock Clock
+}
+
+// Run implements the zerolog.Hook interface
+func (h clockHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	e.Time(zerolog.TimestampFieldName, h.clock.Now())
+}
+
+// withTimestamp returns the context of l adding the time of clock to every event; the system
+// clock keeps using zerolog.TimestampFunc
+func withTimestamp(l zerolog.Logger, clock Clock) zerolog.Context {
+	if clock == nil || clock == SystemClock {
+		return l.With().Timestamp()
+	}
+	return l.Hook(clockHook{clock: clock}).With()
+}
+
+// applyClock makes the writers of the output tree without a clock of their own use clock
+func applyClock(w io.Writer, clock Clock) {
+	walkWriters(w, func(w io.Writer) {
+		if c, ok := w.(interface{ setDefaultClock(Clock) }); ok {
+			c.setDefaultClock(clock)
+		}
+	})
+}
+
+// BurstSampler lets Burst events through per Period and hands the others to NextSampler,
+// dropping them when it is nil. Unlike zerolog.BurstSampler its periods follow the clock
+// set with WithClock.
+type BurstSampler struct {
+	Burst       uint32          // Burst is the number of events let through per period
+	Period      time.Duration   // Period is the length of a window, 0 hands every event to NextSampler
+	NextSampler zerolog.Sampler // NextSampler decides on the events beyond the burst
+
+	clock   clockSource
+	mu      sync.Mutex
+	count   uint32
+	resetAt time.Time
+}
+
+// Sample implements the zerolog.Sampler interface
+func (s *BurstSampler) Sample(lvl zerolog.Level) bool {
+	if s.Burst > 0 && s.Period > 0 {
+		now := s.clock.Now()
+		s.mu.Lock()
+		if !now.Before(s.resetAt) {
+			s.count, s.resetAt = 0, now.Add(s.Period)
+		}
+		s.count++
+		within := s.count <= s.Burst
+		s.mu.Unlock()
+		if within {
+			return true
+		}
+	}
+	if s.NextSampler == nil {
+		return false
+	}
+	return s.NextSampler.Sample(lvl)
+}
+
+// setDefaultClock makes the windows follow clock unless another clock was set before
+func (s *BurstSampler) setDefaultClock(clock Clock) {
+	s.clock.setDefault(clock)
+}
@@ -0,0 +1,73 @@
+package zlog
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithClockTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return now })
+
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat), WithClock(clock))
+	logger.Info("json")
+	assert.Equal(t, `{"level":"info","time":"2024-01-02T03:04:05Z","message":"json"}`+"\n", out.String())
+
+	out.Reset()
+	logger = New(WithOutput(&out), WithClock(ClockFunc(func() time.Time { return now.Local() })))
+	logger.Named("api").Warn("console")
+	assert.Equal(t, now.Local().Format(time.DateTime)+" warn   console logger=api\n", out.String())
+
+	out.Reset()
+	logger.SetOutput(&out)
+	logger.Info("after SetOutput")
+	assert.Contains(t, out.String(), now.Local().Format(time.DateTime))
+}
+
+func TestWithClockDrivesRotation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	now := time.Date(2024, 5, 1, 10, 59, 30, 0, time.UTC)
+	rl := NewRotatingLoggerWithFormat(&RotateConfig{Filename: filename, RotationInterval: time.Hour}, JSONFormat,
+		WithClock(ClockFunc(func() time.Time { return now })))
+	defer rl.Close()
+
+	rl.Info("before")
+	now = now.Add(time.Minute)
+	rl.Info("next hour")
+	assert.Equal(t, []string{"app-2024-05-01T11-00-30.000.log"}, backupsOf(t, filename))
+
+	// A clock of the RotateConfig takes precedence over the clock of the logger
+	own := NewFileWriter(&RotateConfig{Filename: filename, Clock: SystemClock})
+	defer own.Close()
+	applyClock(own, ClockFunc(func() time.Time { return now }))
+	assert.NotEqual(t, now, own.now())
+}
+
+func TestBurstSamplerFollowsClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampler := &BurstSampler{Burst: 2, Period: time.Second}
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat), WithSampler(sampler),
+		WithClock(ClockFunc(func() time.Time { return now })))
+
+	for i := 0; i < 5; i++ {
+		logger.Info("burst")
+	}
+	assert.Len(t, messages(&out), 2)
+	now = now.Add(999 * time.Millisecond)
+	logger.Info("same window")
+	assert.Len(t, messages(&out), 2)
+	now = now.Add(time.Millisecond)
+	logger.Info("next window")
+	assert.Equal(t, []string{"burst", "burst", "next window"}, messages(&out))
+
+	next := &BurstSampler{Burst: 1, Period: time.Second, NextSampler: &BurstSampler{}}
+	require.True(t, next.Sample(0))
+	assert.False(t, next.Sample(0), "an empty next sampler drops the events beyond the burst")
+}
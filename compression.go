@@ -0,0 +1,239 @@
+// Package zlog provides pluggable compression of rotated log files
+package zlog
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionGzip compresses backups with gzip, level 1-9
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses backups with zstd, level 1-22
+	CompressionZstd = "zstd"
+
+	// zstdSuffix is the extension added to zstd compressed backups
+	zstdSuffix = ".zst"
+	// checksumSuffix is the extension of the SHA-256 file written next to an archive
+	checksumSuffix = ".sha256"
+	// partialSuffix is the extension of an archive being written
+	partialSuffix = ".tmp"
+)
+
+// Compression configures how rotated files are compressed
+type Compression struct {
+	Algorithm string // Algorithm is CompressionGzip or CompressionZstd
+	Level     int    // Level is the algorithm specific compression level, 0 selects the default
+	Checksum  bool   // Checksum writes a sha256sum compatible file next to every archive
+}
+
+// suffix returns the extension of archives produced by c
+func (c *Compression) suffix() string {
+	if c.Algorithm == CompressionZstd {
+		return zstdSuffix
+	}
+	return gzipSuffix
+}
+
+// validate reports configuration errors
+func (c *Compression) validate() error {
+	switch c.Algorithm {
+	case CompressionGzip:
+		if c.Level != 0 && (c.Level < gzip.HuffmanOnly || c.Level > gzip.BestCompression) {
+			return fmt.Errorf("invalid gzip compression level %d", c.Level)
+		}
+	case CompressionZstd:
+		if c.Level < 0 || c.Level > 22 {
+			return fmt.Errorf("invalid zstd compression level %d", c.Level)
+		}
+	default:
+		return fmt.Errorf("unknown compression algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// newWriter wraps w with the configured compressor
+func (c *Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Algorithm == CompressionZstd {
+		level := zstd.SpeedDefault
+		if c.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	}
+	level := gzip.DefaultCompression
+	if c.Level != 0 {
+		level = c.Level
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// compressionSlots bounds the number of files compressed at the same time across all loggers
+var (
+	compressionMu    sync.Mutex
+	compressionSlots = make(chan struct{}, 1)
+)
+
+// SetCompressionConcurrency sets how many rotated files may be compressed at the same time
+// by all loggers of the process. It defaults to 1 so compression never competes with the
+// application for more than one CPU.
+func SetCompressionConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	compressionMu.Lock()
+	defer compressionMu.Unlock()
+	compressionSlots = make(chan struct{}, n)
+}
+
+// acquireCompressionSlot blocks until a compression slot is free and returns its release function
+func acquireCompressionSlot() func() {
+	compressionMu.Lock()
+	slots := compressionSlots
+	compressionMu.Unlock()
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// compressFile compresses src into src plus the algorithm suffix and removes src once the
+// archive is complete. The archive is written under a temporary name and renamed into place,
+// so a crash never leaves a truncated archive under its final name.
+func compressFile(src string, c *Compression) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	release := acquireCompressionSlot()
+	defer release()
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open log backup: %w", err)
+	}
+	defer in.Close()
+
+	dst := src + c.suffix()
+	tmp := dst + partialSuffix
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed log backup: %w", err)
+	}
+
+	var sum hash.Hash
+	var target io.Writer = out
+	if c.Checksum {
+		sum = sha256.New()
+		target = io.MultiWriter(out, sum)
+	}
+	cw, err := c.newWriter(target)
+	if err == nil {
+		if _, err = io.Copy(cw, in); err == nil {
+			err = cw.Close()
+		}
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compress log backup: %w", err)
+	}
+
+	if sum != nil {
+		line := hex.EncodeToString(sum.Sum(nil)) + "  " + filepath.Base(dst) + "\n"
+		if err = os.WriteFile(dst+checksumSuffix, []byte(line), 0644); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write log backup checksum: %w", err)
+		}
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to compress log backup: %w", err)
+	}
+	return os.Remove(src)
+}
+
+// isArchive reports whether name has the extension of a compressed backup
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, gzipSuffix) || strings.HasSuffix(name, zstdSuffix)
+}
+
+// trimArchiveSuffix removes the compression extension from name
+func trimArchiveSuffix(name string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, gzipSuffix), zstdSuffix)
+}
+
+// recoverCompression cleans up after compressions interrupted by a crash in the directory of filename:
+// partial archives are removed so the backup is compressed again, sources whose archive was
+// completed are removed, and checksum files without an archive are dropped.
+func recoverCompression(filename string) error {
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to recover log compression: %w", err)
+	}
+
+	names := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		names[e.Name()] = true
+	}
+
+	for name := range names {
+		backup := trimArchiveSuffix(strings.TrimSuffix(strings.TrimSuffix(name, partialSuffix), checksumSuffix))
+		if _, ok := parseBackupName(filename, backup, time.UTC); !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		switch {
+		case strings.HasSuffix(name, partialSuffix) && isArchive(strings.TrimSuffix(name, partialSuffix)):
+			err = firstErr(err, removeIfExists(path))
+		case strings.HasSuffix(name, checksumSuffix):
+			if !names[strings.TrimSuffix(name, checksumSuffix)] {
+				err = firstErr(err, removeIfExists(path))
+			}
+		case isArchive(name):
+			if src := trimArchiveSuffix(name); names[src] {
+				err = firstErr(err, removeIfExists(filepath.Join(dir, src)))
+			}
+		}
+	}
+	return err
+}
+
+// removeIfExists removes path, ignoring files that are already gone
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// firstErr returns err unless it is nil, in which case next is returned
+func firstErr(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
+
+// WithCompression sets the compression of rotated files, overriding the gzip of Compress
+func WithCompression(compression Compression) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.Compression = &compression
+	}
+}
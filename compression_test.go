@@ -0,0 +1,139 @@
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFileZstdWithChecksum(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app-2024-01-01T00-00-00.000.log")
+	content := bytes.Repeat([]byte("compress me\n"), 1000)
+	require.NoError(t, os.WriteFile(src, content, 0644))
+
+	require.NoError(t, compressFile(src, &Compression{Algorithm: CompressionZstd, Level: 3, Checksum: true}))
+	assert.NoFileExists(t, src)
+
+	archive, err := os.ReadFile(src + zstdSuffix)
+	require.NoError(t, err)
+	dec, err := zstd.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	defer dec.Close()
+	got, err := io.ReadAll(dec)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	sum := sha256.Sum256(archive)
+	line, err := os.ReadFile(src + zstdSuffix + checksumSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:])+"  "+filepath.Base(src)+zstdSuffix+"\n", string(line))
+}
+
+func TestCompressFileGzipLevel(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app-2024-01-01T00-00-00.000.log")
+	content := bytes.Repeat([]byte("compress me\n"), 1000)
+	require.NoError(t, os.WriteFile(src, content, 0644))
+
+	require.NoError(t, compressFile(src, &Compression{Algorithm: CompressionGzip, Level: gzip.BestCompression}))
+
+	f, err := os.Open(src + gzipSuffix)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+	assert.NoFileExists(t, src+gzipSuffix+checksumSuffix)
+}
+
+func TestCompressionValidate(t *testing.T) {
+	assert.Error(t, (&Compression{Algorithm: "lz4"}).validate())
+	assert.Error(t, (&Compression{Algorithm: CompressionGzip, Level: 10}).validate())
+	assert.Error(t, (&Compression{Algorithm: CompressionZstd, Level: 23}).validate())
+	assert.NoError(t, (&Compression{Algorithm: CompressionZstd}).validate())
+}
+
+func TestRecoverCompression(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+
+	// Interrupted while writing: the partial archive goes, the source stays
+	partialSrc := writeBackup(t, filename, now.Add(-time.Hour), 10, false)
+	require.NoError(t, os.WriteFile(partialSrc+zstdSuffix+partialSuffix, []byte("partial"), 0644))
+	require.NoError(t, os.WriteFile(partialSrc+zstdSuffix+checksumSuffix, []byte("sum"), 0644))
+	// Interrupted before removing the source: the archive is complete
+	doneSrc := writeBackup(t, filename, now.Add(-2*time.Hour), 10, false)
+	require.NoError(t, os.WriteFile(doneSrc+gzipSuffix, []byte("archive"), 0644))
+	// The backups of a sibling log sharing the prefix are left to its own writer
+	sibling := writeBackup(t, filepath.Join(dir, "app-error.log"), now.Add(-time.Hour), 10, false)
+	require.NoError(t, os.WriteFile(sibling+gzipSuffix, []byte("archive"), 0644))
+	require.NoError(t, os.WriteFile(sibling+zstdSuffix+partialSuffix, []byte("partial"), 0644))
+
+	require.NoError(t, recoverCompression(filename))
+	assert.ElementsMatch(t, []string{
+		filepath.Base(partialSrc), filepath.Base(doneSrc) + gzipSuffix,
+		filepath.Base(sibling), filepath.Base(sibling) + gzipSuffix, filepath.Base(sibling) + zstdSuffix + partialSuffix,
+	}, listDir(t, dir))
+}
+
+func TestRetentionCompression(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	src := writeBackup(t, filename, time.Now().Add(-time.Hour), 100, false)
+	require.NoError(t, os.WriteFile(src+zstdSuffix+partialSuffix, []byte("partial"), 0644))
+
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename,
+		WithCompression(Compression{Algorithm: CompressionZstd, Checksum: true})))
+	defer logger.Close()
+	report, err := logger.ApplyRetention()
+	require.NoError(t, err)
+
+	require.Len(t, report.Compressed, 1)
+	assert.Equal(t, src, report.Compressed[0].Path)
+	assert.FileExists(t, src+zstdSuffix)
+	assert.FileExists(t, src+zstdSuffix+checksumSuffix)
+	assert.NoFileExists(t, src+zstdSuffix+partialSuffix)
+
+	// The archive is recognized as a compressed backup by later passes
+	backups, err := listBackups(filename, false)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.True(t, backups[0].Compressed)
+	assert.True(t, strings.HasSuffix(backups[0].Path, zstdSuffix))
+}
+
+func TestSetCompressionConcurrency(t *testing.T) {
+	defer SetCompressionConcurrency(1)
+	SetCompressionConcurrency(2)
+	first := acquireCompressionSlot()
+	second := acquireCompressionSlot()
+	acquired := make(chan struct{})
+	go func() {
+		release := acquireCompressionSlot()
+		close(acquired)
+		release()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("third compression started while two slots were taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	first()
+	<-acquired
+	second()
+}
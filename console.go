@@ -0,0 +1,276 @@
+// Package zlog provides the human readable renderer of ConsoleFormat
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog"
+)
+
+// ColorMode selects when ConsoleFormat colors its output
+type ColorMode int
+
+const (
+	// ColorAuto colors the output written to a terminal, unless the NO_COLOR environment variable is set
+	ColorAuto ColorMode = iota
+	// ColorAlways colors the output wherever it is written
+	ColorAlways
+	// ColorNever never colors the output
+	ColorNever
+)
+
+// ANSI colors usable in a console theme
+const (
+	ColorRed     = 31
+	ColorGreen   = 32
+	ColorYellow  = 33
+	ColorBlue    = 34
+	ColorMagenta = 35
+	ColorCyan    = 36
+	ColorGray    = 90
+)
+
+// DefaultConsoleTheme holds the colors of the levels missing from ConsoleConfig.Theme.
+// Notice is logged at warn level and shown in the color of LevelWarn.
+var DefaultConsoleTheme = map[hertzlog.Level]int{
+	hertzlog.LevelTrace: ColorGray,
+	hertzlog.LevelDebug: ColorBlue,
+	hertzlog.LevelInfo:  ColorGreen,
+	hertzlog.LevelWarn:  ColorYellow,
+	hertzlog.LevelError: ColorRed,
+	hertzlog.LevelFatal: ColorMagenta,
+}
+
+// ConsoleConfig customizes how ConsoleFormat renders events, wherever the console writer is
+// built: the main output, SetOutput, routes and outputs next to structured sinks
+type ConsoleConfig struct {
+	Color              ColorMode              // Color selects when the output is colored, ColorAuto by default
+	Theme              map[hertzlog.Level]int // Theme overrides the ANSI colors of DefaultConsoleTheme per level
+	TimeFormat         string                 // TimeFormat formats the timestamps, time.DateTime by default
+	FieldOrder         []string               // FieldOrder lists the fields shown first, in order; the others follow sorted
+	MultilineThreshold int                    // MultilineThreshold moves strings longer than it or with line breaks below the event line, 0 disables
+	PrettyErrors       bool                   // PrettyErrors shows error fields first and error chains and stacks one entry per line
+}
+
+// WithConsole sets how ConsoleFormat renders events
+func WithConsole(console ConsoleConfig) Option {
+	return func(c *config) {
+		c.console = console
+	}
+}
+
+// WithColor sets when ConsoleFormat colors its output, keeping the other console settings
+func WithColor(mode ColorMode) Option {
+	return func(c *config) {
+		c.console.Color = mode
+	}
+}
+
+// consoleExtraKey holds the fields moved below the event line between FormatPrepare and FormatExtra
+const consoleExtraKey = "\x00zlog.console.extra"
+
+// consoleField is a field rendered below the event line, one line per entry
+type consoleField struct {
+	name  string
+	lines []string
+}
+
+// prettyErrorKeys are the fields shown first with PrettyErrors
+var prettyErrorKeys = []string{ErrorMessageKey, ErrorTypeKey}
+
+// newConsoleWriter creates the human readable writer used by ConsoleFormat
+func newConsoleWriter(out io.Writer, console ConsoleConfig) *zerolog.ConsoleWriter {
+	colored := console.colored(out)
+	timeFormat := console.TimeFormat
+	if timeFormat == "" {
+		timeFormat = time.DateTime
+	}
+	order := console.FieldOrder
+	if console.PrettyErrors {
+		order = append(append([]string{}, prettyErrorKeys...), order...)
+	}
+	return &zerolog.ConsoleWriter{
+		Out:           out,
+		TimeFormat:    timeFormat,
+		NoColor:       !colored,
+		FieldsOrder:   order,
+		FieldsExclude: []string{consoleExtraKey, NoticeKey},
+		FormatLevel: func(i interface{}) string {
+			// Ensure full level name is shown instead of 3-letter abbreviation
+			ll, ok := i.(string)
+			if !ok {
+				ll = fmt.Sprintf("%s", i)
+			}
+			ll = strings.ToLower(ll)
+			padded := fmt.Sprintf("%-6s", ll)
+			if !colored {
+				return padded
+			}
+			return colorize(padded, console.levelColor(ll))
+		},
+		FormatFieldName: func(i interface{}) string {
+			name := fmt.Sprintf("%s=", i)
+			if !colored {
+				return name
+			}
+			if console.PrettyErrors && strings.HasPrefix(name, "error") {
+				return colorize(name, ColorRed)
+			}
+			return colorize(name, ColorCyan)
+		},
+		FormatPrepare: func(evt map[string]interface{}) error {
+			console.prepare(evt, order)
+			return nil
+		},
+		FormatExtra: func(evt map[string]interface{}, buf *bytes.Buffer) error {
+			extra, _ := evt[consoleExtraKey].([]consoleField)
+			for _, f := range extra {
+				name := f.name + ":"
+				if colored {
+					name = colorize(name, ColorCyan)
+				}
+				buf.WriteString("\n  " + name)
+				for _, line := range f.lines {
+					buf.WriteString("\n    " + line)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// prepare moves the fields rendered on lines of their own from evt to consoleExtraKey
+func (c ConsoleConfig) prepare(evt map[string]interface{}, order []string) {
+	if c.MultilineThreshold <= 0 && !c.PrettyErrors {
+		return
+	}
+	names := make([]string, 0, len(evt))
+	for name := range evt {
+		switch name {
+		case zerolog.LevelFieldName, zerolog.TimestampFieldName, zerolog.MessageFieldName, zerolog.CallerFieldName:
+			continue
+		}
+		names = append(names, name)
+	}
+	sortFields(names, order)
+	var extra []consoleField
+	for _, name := range names {
+		if lines, ok := c.multiline(name, evt[name]); ok {
+			extra = append(extra, consoleField{name: name, lines: lines})
+			delete(evt, name)
+		}
+	}
+	if len(extra) > 0 {
+		evt[consoleExtraKey] = extra
+	}
+}
+
+// multiline returns the lines of a value rendered below the event line
+func (c ConsoleConfig) multiline(name string, value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case string:
+		if c.MultilineThreshold > 0 && (len(v) > c.MultilineThreshold || strings.Contains(v, "\n")) {
+			return strings.Split(strings.TrimRight(v, "\n"), "\n"), true
+		}
+	case []interface{}:
+		if c.PrettyErrors && (name == ErrorChainKey || name == ErrorStackKey || name == StackKey) {
+			lines := make([]string, len(v))
+			for i, entry := range v {
+				lines[i] = fmt.Sprint(entry)
+			}
+			return lines, true
+		}
+	}
+	return nil, false
+}
+
+// sortFields sorts names like the console writer: the fields of order first, the others by name
+func sortFields(names []string, order []string) {
+	rank := make(map[string]int, len(order))
+	for i, name := range order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, iOrdered := rank[names[i]]
+		rj, jOrdered := rank[names[j]]
+		switch {
+		case iOrdered && jOrdered:
+			return ri < rj
+		case iOrdered != jOrdered:
+			return iOrdered
+		}
+		return names[i] < names[j]
+	})
+}
+
+// levelColor returns the color of the level named name
+func (c ConsoleConfig) levelColor(name string) int {
+	var level hertzlog.Level
+	switch name {
+	case "trace":
+		level = hertzlog.LevelTrace
+	case "debug":
+		level = hertzlog.LevelDebug
+	case "info":
+		level = hertzlog.LevelInfo
+	case "warn":
+		level = hertzlog.LevelWarn
+	case "error":
+		level = hertzlog.LevelError
+	case "fatal", "panic":
+		level = hertzlog.LevelFatal
+	default:
+		return 0
+	}
+	if color, ok := c.Theme[level]; ok {
+		return color
+	}
+	return DefaultConsoleTheme[level]
+}
+
+// colored reports whether the output written to out is colored
+func (c ConsoleConfig) colored(out io.Writer) bool {
+	switch c.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(out)
+}
+
+// isTerminal reports whether w writes to a terminal, looking through the writers wrapping it
+func isTerminal(w io.Writer) bool {
+	for w != nil {
+		if f, ok := w.(*os.File); ok {
+			return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+		}
+		children := childWriters(w)
+		if len(children) != 1 {
+			return false
+		}
+		w = children[0]
+	}
+	return false
+}
+
+// colorize wraps s in the ANSI escape codes of color, leaving it alone without a color
+func colorize(s string, color int) string {
+	if color == 0 {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
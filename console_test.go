@@ -0,0 +1,112 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withoutTime strips the timestamp of the console lines in s
+func withoutTime(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if len(line) > 20 && line[4] == '-' {
+			lines[i] = line[20:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestConsoleLooksTheSameAfterSetOutput(t *testing.T) {
+	var before, after bytes.Buffer
+	logger := New(WithOutput(&before))
+	logger.Warn("same")
+	logger.SetOutput(&after)
+	logger.Warn("same")
+	assert.Equal(t, "warn   same\n", withoutTime(before.String()))
+	assert.Equal(t, withoutTime(before.String()), withoutTime(after.String()))
+}
+
+func TestConsoleHidesNoticeMarker(t *testing.T) {
+	var out bytes.Buffer
+	New(WithOutput(&out)).Notice("noted")
+	assert.Equal(t, "warn   noted\n", withoutTime(out.String()))
+}
+
+func TestConsoleColors(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithColor(ColorAlways))
+	logger.Info("colored")
+	assert.Contains(t, out.String(), "\x1b[32minfo  \x1b[0m")
+
+	out.Reset()
+	logger = New(WithOutput(&out), WithConsole(ConsoleConfig{Color: ColorAlways, Theme: map[hertzlog.Level]int{hertzlog.LevelWarn: ColorMagenta}}))
+	logger.Notice("themed")
+	assert.Contains(t, out.String(), "\x1b[35mwarn  \x1b[0m")
+
+	// The color survives SetOutput
+	var moved bytes.Buffer
+	logger.SetOutput(&moved)
+	logger.Warn("moved")
+	assert.Contains(t, moved.String(), "\x1b[35mwarn  \x1b[0m")
+
+	out.Reset()
+	New(WithOutput(&out), WithColor(ColorNever)).Error("plain")
+	New(WithOutput(&out)).Error("not a terminal")
+	assert.NotContains(t, out.String(), "\x1b[")
+}
+
+func TestConsoleTerminalDetection(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	assert.False(t, isTerminal(w))
+	assert.False(t, isTerminal(&bytes.Buffer{}))
+	assert.True(t, ConsoleConfig{Color: ColorAlways}.colored(w))
+
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, ConsoleConfig{}.colored(os.Stdout))
+}
+
+func TestConsoleFieldOrder(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithConsole(ConsoleConfig{FieldOrder: []string{"user", "b"}}))
+	logger.WarnErr(nil, "ordered", "a", 1, "b", 2, "user", "ann")
+	assert.Equal(t, "warn   ordered user=ann b=2 a=1\n", withoutTime(out.String()))
+}
+
+func TestConsoleMultilineValues(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithConsole(ConsoleConfig{MultilineThreshold: 16}))
+	logger.WarnErr(nil, "query", "sql", "SELECT * FROM users WHERE id = 1", "n", 1, "body", "line one\nline two\n")
+	assert.Equal(t, "warn   query n=1\n"+
+		"  body:\n    line one\n    line two\n"+
+		"  sql:\n    SELECT * FROM users WHERE id = 1\n", withoutTime(out.String()))
+}
+
+func TestConsolePrettyErrors(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithStackTrace(hertzlog.LevelError), WithConsole(ConsoleConfig{PrettyErrors: true}))
+	logger.ErrorErr(fmt.Errorf("load config: %w", errors.New("missing file")), "startup failed", "attempt", 2)
+
+	lines := strings.Split(withoutTime(out.String()), "\n")
+	require.Greater(t, len(lines), 5)
+	assert.Equal(t, `error  startup failed error.message="load config: missing file" error.type=*fmt.wrapError attempt=2`, lines[0])
+	assert.Equal(t, []string{"  error.chain:", "    load config: missing file", "    missing file", "  stack:"}, lines[1:5])
+	assert.Contains(t, lines[5], "TestConsolePrettyErrors")
+}
+
+func TestConsoleConfigAppliesToRoutes(t *testing.T) {
+	var routed bytes.Buffer
+	logger := New(WithOutput(&bytes.Buffer{}), WithRouting(NewWriterRoute(&routed)), WithColor(ColorAlways))
+	logger.Error("routed")
+	assert.Contains(t, routed.String(), "\x1b[31merror \x1b[0m")
+}
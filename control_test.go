@@ -0,0 +1,154 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLevelAndOutputWhileLogging(t *testing.T) {
+	first, second := &syncBuffer{}, &syncBuffer{}
+	logger := New(WithOutput(first), WithFormat(JSONFormat), WithLevel(hertzlog.LevelDebug))
+	child := logger.Named("worker")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logger.Info("parent")
+					child.Warnf("child %d", 1)
+					logger.Named("short").Debug("lived")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		logger.SetLevel(hertzlog.LevelWarn)
+		logger.SetOutput(second)
+		child.Error("on second")
+		logger.SetLevel(hertzlog.LevelDebug)
+		logger.SetOutput(first)
+		child.Info("on first")
+	}
+	close(stop)
+	wg.Wait()
+	assert.NotEmpty(t, first.Bytes())
+	assert.NotEmpty(t, second.Bytes())
+}
+
+func TestSetOutputKeepsOptions(t *testing.T) {
+	var before, after bytes.Buffer
+	logger := New(WithOutput(&before), WithFormat(JSONFormat), WithName("api"), WithCaller(CallerShortPath),
+		WithZerologOptions(func(l zerolog.Logger) zerolog.Logger {
+			return l.With().Str("service", "billing").Logger()
+		}))
+	logger.SetOutput(&after)
+
+	logger.Info("moved")
+	want := lineAbove()
+	assert.Empty(t, before.String())
+	line := decodeLine(t, &after)
+	assert.Equal(t, "moved", line["message"])
+	assert.Equal(t, "api", line["logger"])
+	assert.Equal(t, "billing", line["service"])
+	assert.Equal(t, want, line["caller"])
+
+	var console bytes.Buffer
+	logger = New(WithOutput(&bytes.Buffer{}))
+	logger.SetOutput(&console)
+	logger.Warn("plain")
+	assert.Contains(t, console.String(), " warn   plain")
+}
+
+func TestChildrenFollowParent(t *testing.T) {
+	var before, after bytes.Buffer
+	logger := New(WithOutput(&before), WithFormat(JSONFormat))
+	child := logger.Named("db")
+
+	logger.SetLevel(hertzlog.LevelError)
+	child.Info("hidden")
+	assert.Empty(t, before.String())
+
+	logger.SetOutput(&after)
+	child.Error("failed")
+	line := decodeLine(t, &after)
+	assert.Equal(t, "db", line["logger"])
+	assert.Equal(t, "failed", line["message"])
+
+	// A child changes the level of the whole family
+	child.SetLevel(hertzlog.LevelDebug)
+	after.Reset()
+	logger.Debug("visible")
+	assert.Equal(t, "visible", decodeLine(t, &after)["message"])
+}
+
+func TestRotatingLoggerSetOutputKeepsLevel(t *testing.T) {
+	var out bytes.Buffer
+	rl := &RotatingLogger{baseLogger: New(WithOutput(&bytes.Buffer{}), WithFormat(JSONFormat))}
+	rl.SetLevel(hertzlog.LevelWarn)
+	rl.SetOutput(&out)
+	rl.Info("hidden")
+	rl.Warn("shown")
+	require.NotEmpty(t, out.String())
+	assert.Equal(t, "shown", decodeLine(t, &out)["message"])
+}
+
+func TestSetOutputKeepsWriterChain(t *testing.T) {
+	first, second, sink := &syncBuffer{}, &syncBuffer{}, &syncBuffer{}
+	logger := New(WithOutput(first), WithFormat(JSONFormat), WithSink(sink), WithAsync(16),
+		WithDurable(t.TempDir()), WithMetrics(nil))
+	logger.Info("before")
+	durable := logger.core().chain.durable
+	require.NotNil(t, durable)
+
+	logger.SetOutput(second)
+	logger.Info("after")
+	require.NoError(t, logger.Flush())
+	assert.Contains(t, string(first.Bytes()), `"before"`, "events queued before the switch reach the old output")
+	assert.NotContains(t, string(first.Bytes()), `"after"`)
+	assert.Contains(t, string(second.Bytes()), `"after"`)
+	assert.Contains(t, string(sink.Bytes()), `"after"`, "WithSink outputs are kept")
+	assert.Same(t, durable, logger.core().chain.durable, "the write-ahead buffer is reused")
+	assert.NotNil(t, logger.core().chain.async)
+	require.NoError(t, logger.Close())
+}
+
+func TestSetOutputKeepsFailoverAndRoutes(t *testing.T) {
+	var fallback bytes.Buffer
+	logger := New(WithFormat(JSONFormat), WithFallback(&fallback, 1, time.Hour), WithDiagnosticOutput(io.Discard))
+	logger.SetOutput(failingWriter{})
+	logger.Info("rescued")
+	assert.Equal(t, "rescued", decodeLine(t, &fallback)["message"])
+
+	var routed, other bytes.Buffer
+	logger = New(WithFormat(JSONFormat), WithRouting(NewWriterRoute(&routed)))
+	logger.SetOutput(&other)
+	logger.Info("routed")
+	assert.Equal(t, "routed", decodeLine(t, &routed)["message"])
+	assert.Empty(t, other.String(), "the routes replace the output")
+}
+
+func TestSetOutputKeepsFlightRecorderEvents(t *testing.T) {
+	var first, second bytes.Buffer
+	logger := New(WithOutput(&first), WithFormat(JSONFormat), WithFlightRecorder(FlightRecorderConfig{Level: hertzlog.LevelDebug}))
+	ctx := requestContext("r1")
+	logger.CtxDebugf(ctx, "buffered")
+	logger.SetOutput(&second)
+	logger.CtxErrorf(ctx, "failed")
+	assert.Empty(t, first.String())
+	assert.Equal(t, []string{"buffered", "failed"}, messages(&second))
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9 || js || wasip1
+
+package zlog
+
+// diskFree is not supported on this platform; the free space watermark is never enforced
+func diskFree(dir string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package zlog
+
+import "syscall"
+
+// diskFree returns the bytes available to unprivileged users on the filesystem holding dir
+func diskFree(dir string) (int64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return int64(st.Bavail) * int64(st.Bsize), true
+}
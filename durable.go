@@ -0,0 +1,555 @@
+// Package zlog provides a crash-safe write-ahead buffer in front of the output
+package zlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// segmentPrefix and segmentSuffix surround the sequence number in segment file names
+	segmentPrefix = "segment-"
+	segmentSuffix = ".wal"
+	// checkpointFile holds the position up to which segments were delivered to the output
+	checkpointFile = "checkpoint"
+	// recordHeaderSize is the size of the length and checksum preceding every record
+	recordHeaderSize = 8
+	// defaultSegmentSize is the size after which a new segment is started
+	defaultSegmentSize = 64 * megabyte
+	// defaultCheckpointInterval is how often delivered events are marked consumed
+	defaultCheckpointInterval = time.Second
+	// retryDelay and maxRetryDelay bound the wait between retries of an output that keeps failing
+	retryDelay    = 10 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// SyncPolicy decides when appended events are fsynced to the segment file, i.e. acknowledged
+// as durable. The zero value syncs on every write.
+type SyncPolicy struct {
+	Interval time.Duration // Interval syncs at most this long after a write, 0 disables the timer
+	Bytes    int           // Bytes syncs once this many bytes were appended since the last sync, 0 disables the threshold
+}
+
+// SyncEveryWrite syncs before every write returns; nothing acknowledged is ever lost
+func SyncEveryWrite() SyncPolicy { return SyncPolicy{} }
+
+// SyncEvery syncs every interval; a crash loses at most the events of the last interval
+func SyncEvery(interval time.Duration) SyncPolicy { return SyncPolicy{Interval: interval} }
+
+// SyncEveryBytes syncs once n bytes were appended; a crash loses at most n bytes of events
+func SyncEveryBytes(n int) SyncPolicy { return SyncPolicy{Bytes: n} }
+
+// everyWrite reports whether the policy syncs on every write
+func (p SyncPolicy) everyWrite() bool {
+	return p.Interval <= 0 && p.Bytes <= 0
+}
+
+// DurableOption configures a DurableWriter
+type DurableOption func(*durableConfig)
+
+// durableConfig holds the configuration of a DurableWriter
+type durableConfig struct {
+	policy             SyncPolicy
+	segmentSize        int64
+	checkpointInterval time.Duration
+	diagnostics        io.Writer
+}
+
+// WithSyncPolicy sets when appended events are synced, SyncEveryWrite by default
+func WithSyncPolicy(policy SyncPolicy) DurableOption {
+	return func(c *durableConfig) {
+		c.policy = policy
+	}
+}
+
+// WithSegmentSize sets the size in bytes after which a new segment file is started, 64 MB by default
+func WithSegmentSize(size int64) DurableOption {
+	return func(c *durableConfig) {
+		c.segmentSize = size
+	}
+}
+
+// WithCheckpointInterval sets how often events delivered to the output are marked consumed, 1s by default.
+// Events delivered after the last checkpoint are replayed after a crash.
+func WithCheckpointInterval(interval time.Duration) DurableOption {
+	return func(c *durableConfig) {
+		c.checkpointInterval = interval
+	}
+}
+
+// withDurableDiagnostics sets where failures of the output are reported, os.Stderr by default
+func withDurableDiagnostics(w io.Writer) DurableOption {
+	return func(c *durableConfig) {
+		c.diagnostics = w
+	}
+}
+
+// position is a location in the segment sequence
+type position struct {
+	seq    uint64
+	offset int64
+}
+
+// DurableWriter appends every event to a segment file in a directory before writing it to
+// its output, so events survive a crash of the process. Events count as consumed once the
+// output, and every writer below it, has been flushed; consumed segments are removed.
+// When the output fails, the events stay in the buffer and are written again, in order, by the
+// next Write or Flush, or at the next checkpoint; the failure is reported to stderr at most every
+// ten seconds and Write still succeeds, as the event is kept. At startup, events appended but not
+// consumed are replayed into the output first.
+// Delivery is at least once: events delivered just before a crash may be written again.
+type DurableWriter struct {
+	dir    string
+	sink   io.Writer
+	config durableConfig
+	diag   *diagnostics
+
+	mu        sync.Mutex
+	segment   *os.File
+	current   position
+	unsynced  int
+	delivered position  // delivered is the end of the last event written to the sink
+	stalled   bool      // stalled is set while events after delivered wait to be written to the sink again
+	retries   int       // retries counts the failed retries since the sink stalled
+	retryAt   time.Time // retryAt is when Write retries the sink next
+	closed    bool
+	recovered int
+
+	checkpointMu sync.Mutex // serializes checkpoints
+	done         chan struct{}
+	stopped      chan struct{}
+}
+
+// NewDurableWriter opens the write-ahead buffer in dir, replays the events a previous
+// process left unconsumed into sink and starts a new segment
+func NewDurableWriter(dir string, sink io.Writer, opts ...DurableOption) (*DurableWriter, error) {
+	config := durableConfig{segmentSize: defaultSegmentSize, checkpointInterval: defaultCheckpointInterval, diagnostics: os.Stderr}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create write-ahead buffer directory: %w", err)
+	}
+	w := &DurableWriter{dir: dir, sink: sink, config: config, diag: newDiagnostics(config.diagnostics), done: make(chan struct{}), stopped: make(chan struct{})}
+	last, err := w.replay()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.openSegment(last + 1); err != nil {
+		return nil, err
+	}
+	w.delivered = w.current
+	if err := w.writeCheckpoint(w.current); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// WithDurable writes every event to a write-ahead buffer in dir before handing it to the output,
+// see DurableWriter. The buffer wraps the output itself: WithFallback and WithErrorHandler only
+// see failures of the buffer, and events still queued by WithAsync are not durable yet. Failures
+// of the output go to the diagnostic log, see WithDiagnosticOutput. If the buffer cannot be
+// opened the logger writes to the output directly and reports the error on stderr.
+func WithDurable(dir string, opts ...DurableOption) Option {
+	return func(c *config) {
+		c.durableDir = dir
+		c.durableOptions = opts
+	}
+}
+
+// Write implements the io.Writer interface. p is appended to the segment, synced according to
+// the policy and then written to the output. Once appended, the event is kept until the output
+// accepts it, so only failures of the buffer itself are returned.
+func (w *DurableWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if w.current.offset >= w.config.segmentSize {
+		if err := w.rollSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	record := make([]byte, recordHeaderSize+len(p))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(p)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(p))
+	copy(record[recordHeaderSize:], p)
+	n, err := w.segment.Write(record)
+	w.current.offset += int64(n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to append to write-ahead buffer: %w", err)
+	}
+	w.unsynced += n
+	if w.config.policy.everyWrite() || (w.config.policy.Bytes > 0 && w.unsynced >= w.config.policy.Bytes) {
+		if err := w.sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.stalled {
+		// The events the sink rejected go first, so that it receives them in order
+		if !time.Now().Before(w.retryAt) {
+			_ = w.redeliver()
+		}
+		return len(p), nil
+	}
+	if _, err := w.sink.Write(p); err != nil {
+		// The event stays in the buffer and is written again by the next Write or Flush
+		w.stalled = true
+		w.diag.printf("write to %s failed, keeping events in the write-ahead buffer: %v", sinkName(w.sink, DefaultOutputSinkName), err)
+		return len(p), nil
+	}
+	w.delivered = w.current
+	return len(p), nil
+}
+
+// redeliver writes the events appended after the delivered position to the sink, advancing
+// the position past each one, until they are all delivered or the sink fails; w.mu must be held
+func (w *DurableWriter) redeliver() error {
+	for {
+		data, err := os.ReadFile(w.segmentPath(w.delivered.seq))
+		if err != nil {
+			return fmt.Errorf("failed to read write-ahead buffer segment: %w", err)
+		}
+		if w.delivered.seq == w.current.seq {
+			data = data[:min(int64(len(data)), w.current.offset)]
+		}
+		for {
+			event, end, ok := nextRecord(data, w.delivered.offset)
+			if !ok {
+				break
+			}
+			if _, err := w.sink.Write(event); err != nil {
+				w.retries++
+				w.retryAt = time.Now().Add(backoffDelay(w.retries-1, retryDelay, maxRetryDelay))
+				return err
+			}
+			w.delivered.offset = end
+		}
+		if w.delivered.seq == w.current.seq {
+			break
+		}
+		w.delivered = position{seq: w.delivered.seq + 1}
+	}
+	w.stalled, w.retries = false, 0
+	w.diag.printf("write to %s recovered, delivered the buffered events", sinkName(w.sink, DefaultOutputSinkName))
+	return nil
+}
+
+// sync flushes the segment to stable storage; w.mu must be held
+func (w *DurableWriter) sync() error {
+	if w.unsynced == 0 {
+		return nil
+	}
+	if err := w.segment.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead buffer: %w", err)
+	}
+	w.unsynced = 0
+	return nil
+}
+
+// run syncs on the policy interval, retries a failed output and checkpoints until Close
+func (w *DurableWriter) run() {
+	defer close(w.stopped)
+	checkpoint := time.NewTicker(w.config.checkpointInterval)
+	defer checkpoint.Stop()
+	var syncC <-chan time.Time
+	if w.config.policy.Interval > 0 {
+		t := time.NewTicker(w.config.policy.Interval)
+		defer t.Stop()
+		syncC = t.C
+	}
+	for {
+		select {
+		case <-syncC:
+			w.mu.Lock()
+			if !w.closed {
+				_ = w.sync()
+			}
+			w.mu.Unlock()
+		case <-checkpoint.C:
+			w.mu.Lock()
+			if w.stalled && !w.closed && !time.Now().Before(w.retryAt) {
+				_ = w.redeliver()
+			}
+			w.mu.Unlock()
+			_ = w.checkpoint()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Flush syncs the segment, retries the events the output failed to accept, flushes the
+// output and marks the delivered events consumed
+func (w *DurableWriter) Flush() error {
+	w.mu.Lock()
+	err := w.sync()
+	if w.stalled && !w.closed {
+		err = firstErr(err, w.redeliver())
+	}
+	w.mu.Unlock()
+	return firstErr(err, w.checkpoint())
+}
+
+// checkpoint flushes the writers below the sink and records the delivered position as consumed
+func (w *DurableWriter) checkpoint() error {
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+	w.mu.Lock()
+	delivered, sink := w.delivered, w.sink
+	w.mu.Unlock()
+
+	if err := flushWriters(sink); err != nil {
+		return err
+	}
+	if err := w.writeCheckpoint(delivered); err != nil {
+		return err
+	}
+	return w.removeConsumed(delivered.seq)
+}
+
+// currentSink returns the output the events are delivered to
+func (w *DurableWriter) currentSink() io.Writer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sink
+}
+
+// setSink makes the events be delivered to sink from now on, e.g. after SetOutput. The events
+// delivered before are flushed to the previous sink first, so the checkpoint stays valid.
+func (w *DurableWriter) setSink(sink io.Writer) error {
+	w.checkpointMu.Lock()
+	defer w.checkpointMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := flushWriters(w.sink)
+	w.sink = sink
+	return err
+}
+
+// flushWriters flushes every writer reachable through w
+func flushWriters(w io.Writer) error {
+	var err error
+	walkWriters(w, func(child io.Writer) {
+		if f, ok := child.(interface{ Flush() error }); ok {
+			err = firstErr(err, f.Flush())
+		}
+	})
+	return err
+}
+
+// Recovered returns the number of events replayed from a previous process at startup
+func (w *DurableWriter) Recovered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.recovered
+}
+
+// Close syncs the segment, retries the events the output failed to accept, flushes the output,
+// marks the delivered events consumed and stops the writer. Events the output still rejects
+// are replayed at the next start.
+func (w *DurableWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	err := w.sync()
+	if w.stalled {
+		err = firstErr(err, w.redeliver())
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	<-w.stopped
+	err = firstErr(err, w.checkpoint())
+	w.mu.Lock()
+	err = firstErr(err, w.segment.Close())
+	w.mu.Unlock()
+	return err
+}
+
+// openSegment creates the segment with sequence number seq; w.mu must be held or the writer unshared
+func (w *DurableWriter) openSegment(seq uint64) error {
+	f, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create write-ahead buffer segment: %w", err)
+	}
+	w.segment, w.current = f, position{seq: seq}
+	return nil
+}
+
+// rollSegment syncs and closes the current segment and starts the next one; w.mu must be held
+func (w *DurableWriter) rollSegment() error {
+	if err := w.sync(); err != nil {
+		return err
+	}
+	if err := w.segment.Close(); err != nil {
+		return err
+	}
+	return w.openSegment(w.current.seq + 1)
+}
+
+// segmentPath returns the file name of the segment with sequence number seq
+func (w *DurableWriter) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+// segments returns the sequence numbers of the segment files in the directory, in order
+func (w *DurableWriter) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list write-ahead buffer segments: %w", err)
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// replay writes the events not consumed by a previous process to the sink, removes the
+// replayed segments and returns the highest sequence number seen
+func (w *DurableWriter) replay() (uint64, error) {
+	ckpt, err := w.readCheckpoint()
+	if err != nil {
+		return 0, err
+	}
+	seqs, err := w.segments()
+	if err != nil {
+		return 0, err
+	}
+	last := ckpt.seq
+	for _, seq := range seqs {
+		if seq > last {
+			last = seq
+		}
+		if seq < ckpt.seq {
+			continue
+		}
+		from := int64(0)
+		if seq == ckpt.seq {
+			from = ckpt.offset
+		}
+		n, err := w.replaySegment(seq, from)
+		w.recovered += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.recovered > 0 {
+		if err := flushWriters(w.sink); err != nil {
+			return 0, err
+		}
+	}
+	for _, seq := range seqs {
+		if err := removeIfExists(w.segmentPath(seq)); err != nil {
+			return 0, err
+		}
+	}
+	return last, nil
+}
+
+// replaySegment writes the records of a segment from offset to the sink. A torn or corrupt
+// record, as left by a crash during an append, ends the segment.
+func (w *DurableWriter) replaySegment(seq uint64, offset int64) (int, error) {
+	data, err := os.ReadFile(w.segmentPath(seq))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read write-ahead buffer segment: %w", err)
+	}
+	replayed := 0
+	for pos := offset; ; {
+		event, end, ok := nextRecord(data, pos)
+		if !ok {
+			break
+		}
+		if _, err := w.sink.Write(event); err != nil {
+			return replayed, fmt.Errorf("failed to replay write-ahead buffer: %w", err)
+		}
+		replayed++
+		pos = end
+	}
+	return replayed, nil
+}
+
+// nextRecord returns the event of the record at pos in data and the end of the record.
+// It returns false at the end of data and at a torn or corrupt record.
+func nextRecord(data []byte, pos int64) ([]byte, int64, bool) {
+	if pos+recordHeaderSize > int64(len(data)) {
+		return nil, pos, false
+	}
+	size := int64(binary.LittleEndian.Uint32(data[pos : pos+4]))
+	sum := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+	end := pos + recordHeaderSize + size
+	if end > int64(len(data)) || crc32.ChecksumIEEE(data[pos+recordHeaderSize:end]) != sum {
+		return nil, pos, false
+	}
+	return data[pos+recordHeaderSize : end], end, true
+}
+
+// readCheckpoint returns the consumed position recorded in the directory, zero when there is none
+func (w *DurableWriter) readCheckpoint() (position, error) {
+	data, err := os.ReadFile(filepath.Join(w.dir, checkpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return position{}, nil
+	}
+	if err != nil {
+		return position{}, fmt.Errorf("failed to read write-ahead buffer checkpoint: %w", err)
+	}
+	var p position
+	if _, err := fmt.Sscanf(string(data), "%d %d", &p.seq, &p.offset); err != nil {
+		// A damaged checkpoint replays everything rather than losing events
+		return position{}, nil
+	}
+	return p, nil
+}
+
+// writeCheckpoint atomically records p as the consumed position
+func (w *DurableWriter) writeCheckpoint(p position) error {
+	path := filepath.Join(w.dir, checkpointFile)
+	tmp := path + partialSuffix
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", p.seq, p.offset)), 0644); err != nil {
+		return fmt.Errorf("failed to write write-ahead buffer checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write write-ahead buffer checkpoint: %w", err)
+	}
+	return nil
+}
+
+// removeConsumed removes the segments before seq, which are entirely consumed
+func (w *DurableWriter) removeConsumed(seq uint64) error {
+	seqs, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s < seq {
+			err = firstErr(err, removeIfExists(w.segmentPath(s)))
+		}
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lostWriter accepts events but never makes them durable, like a buffer lost in a crash
+type lostWriter struct{}
+
+func (lostWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestDurableWriterReplaysAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewDurableWriter(dir, lostWriter{}, WithCheckpointInterval(time.Hour))
+	require.NoError(t, err)
+	for _, msg := range []string{"one\n", "two\n", "three\n"} {
+		_, err := w.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+	// The process crashes here: w is never flushed or closed
+
+	var out bytes.Buffer
+	w2, err := NewDurableWriter(dir, &out)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Equal(t, "one\ntwo\nthree\n", out.String())
+	assert.Equal(t, 3, w2.Recovered())
+}
+
+func TestDurableWriterCheckpointMarksConsumed(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	w, err := NewDurableWriter(dir, &out, WithCheckpointInterval(time.Hour), WithSegmentSize(32))
+	require.NoError(t, err)
+	for _, msg := range []string{"first event\n", "second event\n", "third event\n"} {
+		_, err := w.Write([]byte(msg))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Flush())
+	seqs, err := w.segments()
+	require.NoError(t, err)
+	assert.Len(t, seqs, 1, "consumed segments are removed")
+
+	_, err = w.Write([]byte("after checkpoint\n"))
+	require.NoError(t, err)
+
+	var replayed bytes.Buffer
+	w2, err := NewDurableWriter(dir, &replayed)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Equal(t, "after checkpoint\n", replayed.String())
+}
+
+func TestDurableWriterCloseConsumesEverything(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	w, err := NewDurableWriter(dir, &out)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("event\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, err = w.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+
+	var replayed bytes.Buffer
+	w2, err := NewDurableWriter(dir, &replayed)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Empty(t, replayed.String())
+	assert.Equal(t, "event\n", out.String())
+}
+
+func TestDurableWriterIgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewDurableWriter(dir, lostWriter{}, WithCheckpointInterval(time.Hour))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("complete\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("torn\n"))
+	require.NoError(t, err)
+	// Cut the last record in half, as a crash during the append would
+	path := w.segmentPath(w.current.seq)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	var out bytes.Buffer
+	w2, err := NewDurableWriter(dir, &out)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Equal(t, "complete\n", out.String())
+}
+
+func TestDurableWriterSyncPolicy(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewDurableWriter(t.TempDir(), &out, WithSyncPolicy(SyncEveryBytes(40)), WithCheckpointInterval(time.Hour))
+	require.NoError(t, err)
+	defer w.Close()
+
+	w.Write([]byte("0123456789\n"))
+	assert.Equal(t, 19, w.unsynced, "below the threshold the record is not synced yet")
+	w.Write([]byte("0123456789012345678901\n"))
+	assert.Equal(t, 0, w.unsynced)
+
+	assert.True(t, SyncEveryWrite().everyWrite())
+	assert.False(t, SyncEvery(time.Millisecond).everyWrite())
+}
+
+func TestDurableWriterRetriesFailedOutput(t *testing.T) {
+	dir := t.TempDir()
+	out := &toggleWriter{}
+	var diag bytes.Buffer
+	w, err := NewDurableWriter(dir, out, WithSegmentSize(16), withDurableDiagnostics(&diag))
+	require.NoError(t, err)
+	out.broken.Store(true)
+	// The event is kept, so the write succeeds
+	_, err = w.Write([]byte("failed\n"))
+	require.NoError(t, err)
+	out.broken.Store(false)
+
+	// The next write delivers the failed event first
+	_, err = w.Write([]byte("next\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "failed\nnext\n", out.String())
+	require.NoError(t, w.Flush())
+	ckpt, err := w.readCheckpoint()
+	require.NoError(t, err)
+	assert.Equal(t, w.current, ckpt)
+	seqs, err := w.segments()
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{w.current.seq}, seqs)
+
+	// Flush retries as well, across segments
+	out.broken.Store(true)
+	_, err = w.Write([]byte("again\n"))
+	require.NoError(t, err)
+	out.broken.Store(false)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "failed\nnext\nagain\n", out.String())
+	require.NoError(t, w.Close())
+	// Reported once, the other messages are rate limited
+	assert.Equal(t, 1, strings.Count(diag.String(), "\n"), diag.String())
+	assert.Contains(t, diag.String(), "keeping events in the write-ahead buffer: permission denied")
+
+	var replayed bytes.Buffer
+	w2, err := NewDurableWriter(dir, &replayed)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Empty(t, replayed.String())
+}
+
+func TestDurableWriterFailedOutputIsReplayed(t *testing.T) {
+	dir := t.TempDir()
+	out := &toggleWriter{}
+	w, err := NewDurableWriter(dir, out, withDurableDiagnostics(io.Discard))
+	require.NoError(t, err)
+	out.broken.Store(true)
+	_, err = w.Write([]byte("lost\n"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("next\n"))
+	require.NoError(t, err)
+	assert.Error(t, w.Close())
+
+	var replayed bytes.Buffer
+	w2, err := NewDurableWriter(dir, &replayed)
+	require.NoError(t, err)
+	defer w2.Close()
+	assert.Equal(t, "lost\nnext\n", replayed.String())
+}
+
+func TestWithDurable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "wal")
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat), WithDurable(dir, WithSyncPolicy(SyncEvery(10*time.Millisecond))), WithAsync(16))
+	logger.Info("billed")
+	require.NoError(t, logger.Close())
+	assert.Contains(t, out.String(), `"message":"billed"`)
+
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+	require.NoError(t, err)
+	assert.NotEmpty(t, data)
+}
+
+func TestWithDurableKeepsEventsOfFailingOutput(t *testing.T) {
+	out := &toggleWriter{}
+	out.broken.Store(true)
+	var diag bytes.Buffer
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithMetrics(nil), WithDiagnosticOutput(&diag),
+		WithDurable(t.TempDir()))
+	defer logger.Close()
+	for i := 0; i < 5; i++ {
+		logger.Info("kept")
+	}
+	assert.Zero(t, logger.Stats().Dropped)
+	assert.Equal(t, 1, strings.Count(diag.String(), "\n"), diag.String())
+
+	out.broken.Store(false)
+	require.NoError(t, logger.Flush())
+	assert.Equal(t, 5, strings.Count(out.String(), `"message":"kept"`))
+}
+
+func TestWithDurableWrapsOutputBelowAsyncAndFallback(t *testing.T) {
+	out := &toggleWriter{}
+	out.broken.Store(true)
+	var fallback bytes.Buffer
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithDiagnosticOutput(io.Discard),
+		WithFallback(&fallback, 1, time.Hour), WithAsync(16), WithDurable(t.TempDir()))
+	dw := logger.core().chain.durable
+	require.NotNil(t, dw)
+	assert.Equal(t, &noticeWriter{Writer: out}, dw.currentSink(), "the buffer writes to the output itself")
+
+	logger.Info("first")
+	logger.Info("second")
+	_ = logger.Flush()
+	// The buffer keeps the events, so neither the queue nor the fallback acknowledges a lost one
+	assert.Empty(t, fallback.String())
+	assert.Empty(t, out.String())
+
+	out.broken.Store(false)
+	require.NoError(t, logger.Close())
+	assert.Regexp(t, `(?s)"message":"first".*"message":"second"`, out.String())
+}
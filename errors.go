@@ -0,0 +1,329 @@
+// Package zlog provides error-aware logging with error chains and stack traces
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Field names used for errors logged through the ErrorErr family of methods
+const (
+	ErrorTypeKey    = "error.type"
+	ErrorMessageKey = "error.message"
+	ErrorChainKey   = "error.chain"
+	ErrorStackKey   = "error.stack"
+	StackKey        = "stack"
+)
+
+// maxStackDepth bounds the number of frames captured for a stack trace
+const maxStackDepth = 64
+
+// StackTracer is implemented by errors that carry the stack trace of where they were created
+type StackTracer interface {
+	StackTrace() []uintptr
+}
+
+// defaultStackLevels are the levels for which call-site stack traces are captured by default
+var defaultStackLevels = []hertzlog.Level{hertzlog.LevelError, hertzlog.LevelFatal}
+
+// WithStackTrace sets the levels at which the ErrorErr family of methods captures
+// a stack trace of the logging call site. Calling it without levels disables capture.
+// By default stacks are captured at Error and Fatal.
+func WithStackTrace(levels ...hertzlog.Level) Option {
+	return func(c *config) {
+		c.stackLevels = newLevelSet(levels)
+	}
+}
+
+// levelSet is a set of hertzlog levels
+type levelSet uint16
+
+// newLevelSet creates a set containing levels
+func newLevelSet(levels []hertzlog.Level) levelSet {
+	var s levelSet
+	for _, l := range levels {
+		if l >= 0 && l < 16 {
+			s |= 1 << uint(l)
+		}
+	}
+	return s
+}
+
+// has reports whether level is in the set
+func (s levelSet) has(level hertzlog.Level) bool {
+	return level >= 0 && level < 16 && s&(1<<uint(level)) != 0
+}
+
+// WarnErr logs err at warn level with msg and optional key/value pairs
+func (zl *ZLogger) WarnErr(err error, msg string, kv ...interface{}) {
+	zl.logErr(nil, hertzlog.LevelWarn, err, msg, kv)
+}
+
+// ErrorErr logs err at error level with msg and optional key/value pairs.
+// The error is rendered with its type, message and full chain of wrapped causes.
+func (zl *ZLogger) ErrorErr(err error, msg string, kv ...interface{}) {
+	zl.logErr(nil, hertzlog.LevelError, err, msg, kv)
+}
+
+// FatalErr logs err at fatal level with msg and optional key/value pairs, then exits
+func (zl *ZLogger) FatalErr(err error, msg string, kv ...interface{}) {
+	zl.logErr(nil, hertzlog.LevelFatal, err, msg, kv)
+}
+
+// CtxWarnErr logs err at warn level with the trace fields of ctx
+func (zl *ZLogger) CtxWarnErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	zl.logErr(ctx, hertzlog.LevelWarn, err, msg, kv)
+}
+
+// CtxErrorErr logs err at error level with the trace fields of ctx and records it on the active span
+func (zl *ZLogger) CtxErrorErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	zl.logErr(ctx, hertzlog.LevelError, err, msg, kv)
+}
+
+// CtxFatalErr logs err at fatal level with the trace fields of ctx, then exits
+func (zl *ZLogger) CtxFatalErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	zl.logErr(ctx, hertzlog.LevelFatal, err, msg, kv)
+}
+
+// logErr is the shared implementation of the ErrorErr family; it must be called directly by them
+func (zl *ZLogger) logErr(ctx context.Context, level hertzlog.Level, err error, msg string, kv []interface{}) {
+	logEvt := zl.eventAt(level)
+	if logEvt == nil {
+		return
+	}
+
+	for k, v := range zl.getOtelFields(ctx) {
+		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
+	}
+	if err != nil {
+		appendError(logEvt, err)
+	}
+	if zl.state.stackLevels.has(level) {
+		// Skip runtime.Callers, callerStack, logErr and the exported method
+		logEvt = logEvt.Strs(StackKey, callerStack(4))
+	}
+	appendKeyValues(logEvt, kv)
+	logEvt.Msg(msg)
+
+	if ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		span.AddEvent("log", trace.WithAttributes(
+			attribute.String("message", msg),
+			attribute.String("level", levelName(level)),
+		))
+		if err != nil && level >= hertzlog.LevelError {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, msg)
+		}
+	}
+}
+
+// eventAt starts an event at the zerolog level matching a hertzlog level, nil when disabled
+func (zl *ZLogger) eventAt(level hertzlog.Level) *zerolog.Event {
+	switch level {
+	case hertzlog.LevelTrace:
+		return zl.current().Trace()
+	case hertzlog.LevelDebug:
+		return zl.current().Debug()
+	case hertzlog.LevelInfo:
+		return zl.current().Info()
+	case hertzlog.LevelNotice:
+		return zl.notice()
+	case hertzlog.LevelWarn:
+		return zl.current().Warn()
+	case hertzlog.LevelError:
+		return zl.current().Error()
+	case hertzlog.LevelFatal:
+		return zl.current().Fatal()
+	default:
+		return zl.current().Info()
+	}
+}
+
+// levelName returns the lower-case name of a hertzlog level
+func levelName(level hertzlog.Level) string {
+	switch level {
+	case hertzlog.LevelTrace:
+		return "trace"
+	case hertzlog.LevelDebug:
+		return "debug"
+	case hertzlog.LevelInfo:
+		return "info"
+	case hertzlog.LevelNotice:
+		return "notice"
+	case hertzlog.LevelWarn:
+		return "warn"
+	case hertzlog.LevelError:
+		return "error"
+	case hertzlog.LevelFatal:
+		return "fatal"
+	default:
+		return "info"
+	}
+}
+
+// appendError adds the typed attributes, the cause chain and the origin stack of err to the event
+func appendError(e *zerolog.Event, err error) {
+	e.Str(ErrorTypeKey, errorType(err)).
+		Str(ErrorMessageKey, err.Error())
+	if chain := ErrorChain(err); len(chain) > 1 {
+		e.Strs(ErrorChainKey, chain)
+	}
+	if st := findStackTracer(err); st != nil {
+		e.Strs(ErrorStackKey, formatFrames(st.StackTrace()))
+	}
+}
+
+// errorObject renders an error used as a key/value field as a nested object
+type errorObject struct {
+	err error
+}
+
+// MarshalZerologObject implements the zerolog.LogObjectMarshaler interface
+func (o errorObject) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("type", errorType(o.err)).Str("message", o.err.Error())
+	if chain := ErrorChain(o.err); len(chain) > 1 {
+		e.Strs("chain", chain)
+	}
+}
+
+// errorType returns the dynamic type name of err, looking through stack annotations
+func errorType(err error) string {
+	for {
+		se, ok := err.(*stackError)
+		if !ok {
+			return fmt.Sprintf("%T", err)
+		}
+		err = se.err
+	}
+}
+
+// ErrorChain returns the messages of err and every error it wraps, depth first.
+// Both single wrapping (errors.Unwrap) and multiple wrapping (errors.Join) are followed;
+// wrappers that do not change the message, such as stack annotations, are collapsed.
+func ErrorChain(err error) []string {
+	var chain []string
+	walkErrors(err, func(e error) bool {
+		msg := e.Error()
+		if len(chain) == 0 || chain[len(chain)-1] != msg {
+			chain = append(chain, msg)
+		}
+		return true
+	})
+	return chain
+}
+
+// walkErrors calls fn for err and every error it wraps until fn returns false
+func walkErrors(err error, fn func(error) bool) bool {
+	if err == nil {
+		return true
+	}
+	if !fn(err) {
+		return false
+	}
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		return walkErrors(u.Unwrap(), fn)
+	case interface{ Unwrap() []error }:
+		for _, child := range u.Unwrap() {
+			if !walkErrors(child, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// findStackTracer returns the innermost error of the chain that carries a stack trace
+func findStackTracer(err error) StackTracer {
+	var found StackTracer
+	walkErrors(err, func(e error) bool {
+		if st, ok := e.(StackTracer); ok {
+			found = st
+		}
+		return true
+	})
+	return found
+}
+
+// callerStack captures the current goroutine's stack, skipping skip frames
+func callerStack(skip int) []string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip, pcs)
+	return formatFrames(pcs[:n])
+}
+
+// formatFrames renders program counters as "function file:line" entries
+func formatFrames(pcs []uintptr) []string {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	out := make([]string, 0, len(pcs))
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" || frame.File != "" {
+			out = append(out, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// appendKeyValues adds alternating key/value pairs to the event.
+// Error values are rendered as objects; a trailing key without value is logged under "!BADKEY".
+func appendKeyValues(e *zerolog.Event, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 >= len(kv) {
+			e.Interface("!BADKEY", kv[i])
+			return
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		if err, ok := kv[i+1].(error); ok {
+			e.Object(key, errorObject{err: err})
+			continue
+		}
+		e.Interface(key, kv[i+1])
+	}
+}
+
+// NewStackError wraps err with the stack trace of the caller, implementing StackTracer
+func NewStackError(err error) error {
+	if err == nil {
+		return nil
+	}
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, pcs)
+	return &stackError{err: err, stack: pcs[:n]}
+}
+
+// stackError is an error annotated with the stack of its creation
+type stackError struct {
+	err   error
+	stack []uintptr
+}
+
+// Error implements the error interface
+func (s *stackError) Error() string { return s.err.Error() }
+
+// Unwrap returns the wrapped error
+func (s *stackError) Unwrap() error { return s.err }
+
+// StackTrace implements the StackTracer interface
+func (s *stackError) StackTrace() []uintptr { return s.stack }
@@ -0,0 +1,110 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	return entry
+}
+
+func TestErrorErrRendersChain(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+
+	_, openErr := os.Open("/definitely/not/here")
+	err := fmt.Errorf("load config: %w", openErr)
+	logger.ErrorErr(err, "startup failed", "attempt", 3)
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, "startup failed", entry["message"])
+	assert.Equal(t, "*fmt.wrapError", entry[ErrorTypeKey])
+	assert.Equal(t, err.Error(), entry[ErrorMessageKey])
+	assert.Equal(t, []interface{}{err.Error(), openErr.Error(), "no such file or directory"}, entry[ErrorChainKey])
+	assert.Equal(t, float64(3), entry["attempt"])
+	assert.NotEmpty(t, entry[StackKey])
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	stack := entry[StackKey].([]interface{})
+	assert.Contains(t, stack[0], "TestErrorErrRendersChain")
+}
+
+func TestErrorErrJoinedErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithStackTrace())
+
+	err := errors.Join(errors.New("first"), fmt.Errorf("second: %w", errors.New("cause")))
+	logger.ErrorErr(err, "multiple failures")
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, []interface{}{"first\nsecond: cause", "first", "second: cause", "cause"}, entry[ErrorChainKey])
+	assert.NotContains(t, entry, StackKey)
+}
+
+func TestStackTraceLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithStackTrace(hertzlog.LevelWarn))
+
+	logger.WarnErr(errors.New("slow"), "degraded")
+	assert.Contains(t, decodeLine(t, buf), StackKey)
+
+	buf.Reset()
+	logger.ErrorErr(errors.New("boom"), "failed")
+	assert.NotContains(t, decodeLine(t, buf), StackKey)
+}
+
+func TestStackTracerError(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithStackTrace())
+
+	err := fmt.Errorf("handler: %w", NewStackError(errors.New("bad input")))
+	logger.ErrorErr(err, "request failed")
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, []interface{}{"handler: bad input", "bad input"}, entry[ErrorChainKey])
+	stack := entry[ErrorStackKey].([]interface{})
+	require.NotEmpty(t, stack)
+	assert.Contains(t, stack[0], "TestStackTracerError")
+}
+
+func TestErrorValuesInKeyValues(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithStackTrace())
+
+	logger.ErrorErr(nil, "cleanup failed", "cause", fmt.Errorf("close: %w", errors.New("busy")), "dangling")
+
+	entry := decodeLine(t, buf)
+	assert.NotContains(t, entry, ErrorTypeKey)
+	assert.Equal(t, map[string]interface{}{
+		"type":    "*fmt.wrapError",
+		"message": "close: busy",
+		"chain":   []interface{}{"close: busy", "busy"},
+	}, entry["cause"])
+	assert.Equal(t, "dangling", entry["!BADKEY"])
+}
+
+func TestErrorErrConsoleFormat(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(ConsoleFormat), WithStackTrace())
+
+	logger.ErrorErr(fmt.Errorf("outer: %w", errors.New("inner")), "console error")
+
+	out := buf.String()
+	assert.Contains(t, out, "console error")
+	assert.Contains(t, out, ErrorTypeKey+"=*fmt.wrapError")
+	assert.True(t, strings.Contains(out, ErrorChainKey+"="))
+}
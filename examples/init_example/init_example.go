@@ -18,7 +18,7 @@ func InitLog(LogFileName, logFormat string, level hlog.Level) {
 		zlog.WithLevel(level),
 		zlog.WithFormat(zlog.GetLogFormat(logFormat)),
 		zlog.WithRotation(rc, nil),
-		zlog.CallerWithSkipFrameCount(3),
+		zlog.WithCaller(zlog.CallerShortPath),
 		//zlog.WithOutput(os.Stdout),
 	)
 	hlog.SetLogger(lo)
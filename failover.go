@@ -0,0 +1,223 @@
+// Package zlog provides write error reporting and failover to a secondary output
+package zlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultFallbackFailures is the number of consecutive failures after which WithFallback switches outputs
+	defaultFallbackFailures = 3
+	// defaultFallbackRetry is how often the primary output is retried while the fallback is in use
+	defaultFallbackRetry = 30 * time.Second
+	// diagnosticInterval bounds how often the internal diagnostic log reports write failures
+	diagnosticInterval = 10 * time.Second
+)
+
+// WriteError is the error passed to the ErrorHandler when writing an event fails
+type WriteError struct {
+	Sink        string // Sink is the name of the output that failed
+	Err         error  // Err is the error returned by the output
+	Consecutive int    // Consecutive is the number of failed writes in a row, including this one
+	FellBack    bool   // FellBack reports whether the event was written to the fallback output instead
+}
+
+// Error implements the error interface
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("zlog: write to %s failed: %v", e.Sink, e.Err)
+}
+
+// Unwrap returns the error of the output
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// ErrorHandler is called with a *WriteError every time writing an event fails.
+// It runs on the writing goroutine and must not log through the failing logger;
+// failures that happen while a handler runs are only reported to the diagnostic log.
+type ErrorHandler func(err error)
+
+// WithErrorHandler reports every failed write of the output to handler
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(c *config) {
+		c.errorHandler = handler
+	}
+}
+
+// WithFallback switches to fallback, e.g. os.Stderr or a FileWriter on another disk, after
+// failures consecutive write errors of the output. While the fallback is in use the output
+// is retried every retryInterval with the next event and switched back to once it succeeds.
+// Non-positive values select 3 failures and 30 seconds.
+func WithFallback(fallback io.Writer, failures int, retryInterval time.Duration) Option {
+	return func(c *config) {
+		if failures <= 0 {
+			failures = defaultFallbackFailures
+		}
+		if retryInterval <= 0 {
+			retryInterval = defaultFallbackRetry
+		}
+		c.fallback, c.fallbackFailures, c.fallbackRetry = fallback, failures, retryInterval
+	}
+}
+
+// WithDiagnosticOutput sets where write failures and output switches are reported, at most once
+// every ten seconds, when WithErrorHandler, WithFallback or WithDurable is used. It defaults to os.Stderr;
+// nil disables the diagnostic log.
+func WithDiagnosticOutput(w io.Writer) Option {
+	return func(c *config) {
+		c.diagnostics = w
+		c.diagnosticsSet = true
+	}
+}
+
+// diagnosticOutput returns where the diagnostic log of the logger is written, nil when disabled
+func (c *config) diagnosticOutput() io.Writer {
+	if c.diagnosticsSet {
+		return c.diagnostics
+	}
+	return os.Stderr
+}
+
+// failoverWriter reports write errors of its primary output and switches to a fallback output
+// after repeated failures. Events it cannot deliver are counted as dropped and not returned as
+// errors, so zerolog does not print its own unthrottled message for every one of them.
+type failoverWriter struct {
+	primary      io.Writer
+	fallback     io.Writer
+	primaryName  string
+	fallbackName string
+	threshold    int
+	retry        time.Duration
+	handler      ErrorHandler
+	diag         *diagnostics
+	metrics      *metricsRecorder
+	clock        Clock
+
+	mu         sync.Mutex
+	failures   int
+	failedOver bool
+	nextRetry  time.Time
+
+	handling atomic.Bool
+}
+
+// newFailoverWriter creates the error handling writer configured by cfg around primary
+func newFailoverWriter(primary io.Writer, cfg *config) *failoverWriter {
+	return &failoverWriter{
+		primary:      primary,
+		fallback:     hideNotice(cfg.fallback),
+		primaryName:  sinkName(primary, DefaultOutputSinkName),
+		fallbackName: sinkName(cfg.fallback, "fallback"),
+		threshold:    cfg.fallbackFailures,
+		retry:        cfg.fallbackRetry,
+		handler:      cfg.errorHandler,
+		diag:         newDiagnostics(cfg.diagnosticOutput()),
+		clock:        cfg.clock,
+	}
+}
+
+// Write implements the io.Writer interface
+func (f *failoverWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	if f.failedOver && f.clock.Now().Before(f.nextRetry) {
+		f.mu.Unlock()
+		return f.writeFallback(p)
+	}
+	_, err := f.primary.Write(p)
+	if err == nil {
+		if f.failedOver {
+			f.diag.printf("write to %s recovered, leaving fallback output", f.primaryName)
+		}
+		f.failures, f.failedOver = 0, false
+		f.mu.Unlock()
+		return len(p), nil
+	}
+
+	f.failures++
+	werr := &WriteError{Sink: f.primaryName, Err: err, Consecutive: f.failures}
+	switched := false
+	if f.fallback != nil && (f.failedOver || f.failures >= f.threshold) {
+		switched = !f.failedOver
+		f.failedOver = true
+		f.nextRetry = f.clock.Now().Add(f.retry)
+		werr.FellBack = true
+	}
+	f.mu.Unlock()
+
+	f.report(werr)
+	if switched {
+		f.diag.printf("switching to fallback output after %d consecutive write failures", werr.Consecutive)
+	}
+	if werr.FellBack {
+		return f.writeFallback(p)
+	}
+	f.dropped()
+	return len(p), nil
+}
+
+// writeFallback writes p to the fallback output
+func (f *failoverWriter) writeFallback(p []byte) (int, error) {
+	if _, err := f.fallback.Write(p); err != nil {
+		f.report(&WriteError{Sink: f.fallbackName, Err: err, Consecutive: 1})
+		f.dropped()
+	}
+	return len(p), nil
+}
+
+// report passes err to the handler and the diagnostic log, never re-entering the handler
+func (f *failoverWriter) report(err *WriteError) {
+	f.diag.printf("write to %s failed: %v", err.Sink, err.Err)
+	if f.handler == nil || !f.handling.CompareAndSwap(false, true) {
+		return
+	}
+	defer f.handling.Store(false)
+	f.handler(err)
+}
+
+// dropped counts an event that reached no output
+func (f *failoverWriter) dropped() {
+	if f.metrics != nil {
+		f.metrics.recordDropped()
+	}
+}
+
+// diagnostics is zlog's own rate-limited log of output failures. It writes directly to its
+// output, never through a logger, so a failing logger cannot recurse into it.
+type diagnostics struct {
+	out io.Writer
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// newDiagnostics creates a diagnostic log writing to out, nil when out is nil
+func newDiagnostics(out io.Writer) *diagnostics {
+	if out == nil {
+		return nil
+	}
+	return &diagnostics{out: out}
+}
+
+// printf writes a message unless one was written within diagnosticInterval, in which case it is counted
+func (d *diagnostics) printf(format string, args ...interface{}) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if !d.last.IsZero() && now.Sub(d.last) < diagnosticInterval {
+		d.suppressed++
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if d.suppressed > 0 {
+		msg += fmt.Sprintf(" (%d similar messages suppressed)", d.suppressed)
+	}
+	d.last, d.suppressed = now, 0
+	fmt.Fprintf(d.out, "zlog: %s\n", msg)
+}
@@ -0,0 +1,123 @@
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toggleWriter fails while broken is set
+type toggleWriter struct {
+	bytes.Buffer
+	broken atomic.Bool
+}
+
+func (w *toggleWriter) Write(p []byte) (int, error) {
+	if w.broken.Load() {
+		return 0, errors.New("permission denied")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestErrorHandlerReceivesWriteErrors(t *testing.T) {
+	var errs []error
+	var diag bytes.Buffer
+	logger := New(
+		WithOutput(NamedWriter("app.log", failingWriter{})),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+		WithDiagnosticOutput(&diag),
+		WithMetrics(nil),
+	)
+	logger.Info("lost")
+	logger.Info("lost again")
+
+	require.Len(t, errs, 2)
+	var werr *WriteError
+	require.ErrorAs(t, errs[1], &werr)
+	assert.Equal(t, "app.log", werr.Sink)
+	assert.Equal(t, 2, werr.Consecutive)
+	assert.False(t, werr.FellBack)
+	assert.EqualError(t, werr.Err, "disk full")
+	assert.Equal(t, uint64(2), logger.Stats().Dropped)
+
+	// The diagnostic log is rate limited
+	assert.Equal(t, 1, strings.Count(diag.String(), "\n"))
+	assert.Contains(t, diag.String(), "zlog: write to app.log failed: disk full")
+}
+
+func TestFallbackAndRetry(t *testing.T) {
+	primary := &toggleWriter{}
+	var fallback bytes.Buffer
+	var handled []*WriteError
+	cfg := &config{errorHandler: func(err error) {
+		var werr *WriteError
+		if errors.As(err, &werr) {
+			handled = append(handled, werr)
+		}
+	}}
+	WithFallback(&fallback, 2, time.Minute)(cfg)
+	WithDiagnosticOutput(nil)(cfg)
+	f := newFailoverWriter(primary, cfg)
+	now := time.Now()
+	f.clock = ClockFunc(func() time.Time { return now })
+
+	primary.broken.Store(true)
+	f.Write([]byte("one\n"))
+	assert.Empty(t, fallback.String(), "below the threshold the event is lost")
+	f.Write([]byte("two\n"))
+	assert.Equal(t, "two\n", fallback.String())
+	require.Len(t, handled, 2)
+	assert.True(t, handled[1].FellBack)
+
+	// The primary is not retried before the interval
+	primary.broken.Store(false)
+	f.Write([]byte("three\n"))
+	assert.Equal(t, "two\nthree\n", fallback.String())
+	assert.Empty(t, primary.String())
+
+	now = now.Add(time.Minute)
+	f.Write([]byte("four\n"))
+	f.Write([]byte("five\n"))
+	assert.Equal(t, "four\nfive\n", primary.String())
+	assert.Equal(t, "two\nthree\n", fallback.String())
+}
+
+func TestErrorHandlerLoggingDoesNotRecurse(t *testing.T) {
+	var logger *ZLogger
+	calls := 0
+	logger = New(
+		WithOutput(failingWriter{}),
+		WithDiagnosticOutput(nil),
+		WithErrorHandler(func(err error) {
+			calls++
+			logger.Error("write failed") // fails again, but is not reported back to the handler
+		}),
+	)
+	logger.Info("lost")
+	assert.Equal(t, 1, calls)
+}
+
+func TestFileWriterRecreatesDeletedDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	filename := filepath.Join(dir, "app.log")
+	w := NewFileWriter(&RotateConfig{Filename: filename})
+	defer w.Close()
+	now := time.Now()
+	w.clock.set(ClockFunc(func() time.Time { return now }))
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(dir))
+	now = now.Add(identityCheckInterval)
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", readFile(t, filename))
+}
@@ -0,0 +1,20 @@
+//go:build windows || plan9 || js || wasip1
+
+package zlog
+
+import "os"
+
+// lockFile is not supported on this platform; MultiProcess only relies on appending writes
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is not supported on this platform
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// fileOwner is not supported on this platform; new files keep the default owner
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
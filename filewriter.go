@@ -0,0 +1,599 @@
+// Package zlog provides the rotating file writer behind RotatingLogger
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxSize is the rotation size used when RotateConfig.MaxSize is 0, as lumberjack did
+	defaultMaxSize = 100 * megabyte
+	// defaultFileMode is the permission of new log files, as lumberjack used
+	defaultFileMode os.FileMode = 0600
+	// defaultFlushInterval bounds how long buffered events wait when no FlushInterval is configured
+	defaultFlushInterval = time.Second
+	// lockSuffix is the extension of the advisory lock file used with MultiProcess
+	lockSuffix = ".lock"
+	// identityCheckInterval bounds how often a writer checks whether its file was moved or deleted
+	identityCheckInterval = time.Second
+)
+
+// FileOwner is the numeric owner of log files created by a FileWriter
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// FileWriter is a rotating log file writer. The file is rotated when it would grow beyond
+// MaxSize and, with RotationInterval, when an interval boundary is crossed; rotated files are
+// renamed to "name-<timestamp>.ext" like lumberjack did, so existing backups keep being managed.
+// The file is opened on the first write. Close stops every goroutine of the writer.
+type FileWriter struct {
+	config   *RotateConfig
+	filename string
+	clock    *clockSource
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	buf       []byte
+	next      time.Time // next time triggered rotation, zero without RotationInterval
+	lastCheck time.Time // last time the file identity was checked with MultiProcess
+	closed    bool
+	lock      *fileLock
+
+	metrics   *metricsRecorder
+	retention *retentionManager
+	events    *lifecycle
+
+	flushStop chan struct{}
+	flushDone chan struct{}
+}
+
+// NewFileWriter creates a rotating file writer for config.
+// It starts the retention worker when a retention policy is configured and the
+// flush worker when writes are buffered; both stop on Close.
+func NewFileWriter(config *RotateConfig) *FileWriter {
+	w := &FileWriter{config: config, filename: config.Filename, clock: newClockSource(config.Clock)}
+	if config.hasLifecycleHooks() {
+		w.events = newLifecycle(config)
+	}
+	// Create the directory early; on failure it is tried again, and the error returned, on every write until it succeeds
+	if err := EnsureDirectoryExists(config.Filename); err != nil {
+		w.events.reportError(err)
+	}
+	if config.MultiProcess {
+		w.lock = newFileLock(config.Filename + lockSuffix)
+	}
+	if config.hasRetention() && !config.ExternalRotation {
+		w.retention = newRetentionManager(config, w.events, w.clock)
+		if config.MultiProcess {
+			w.retention.lock = newFileLock(config.Filename + lockSuffix)
+		}
+		w.retention.trigger()
+	}
+	if config.ExternalRotation {
+		registerReopen(w)
+	}
+	if config.BufferSize > 0 {
+		w.buf = make([]byte, 0, config.BufferSize)
+		interval := config.FlushInterval
+		if interval <= 0 {
+			interval = defaultFlushInterval
+		}
+		w.flushStop, w.flushDone = make(chan struct{}), make(chan struct{})
+		go w.flushLoop(interval)
+	}
+	return w
+}
+
+// Write implements the io.Writer interface. Every call is written to the file as a whole,
+// so events of several processes appending to the same file never interleave.
+func (w *FileWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	writeLen := int64(len(p))
+	external := w.config.ExternalRotation
+	if !external && writeLen > w.maxSize() {
+		return 0, fmt.Errorf("write length %d exceeds maximum file size %d", writeLen, w.maxSize())
+	}
+	if w.file != nil {
+		w.checkIdentity()
+	}
+	if w.file == nil {
+		if external {
+			err = w.reopenOrCreate()
+		} else {
+			err = w.openExistingOrNew(writeLen)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if !external && (w.size+writeLen > w.maxSize() || w.timeToRotate()) {
+		if err = w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.buf == nil {
+		n, err = w.file.Write(p)
+		w.wrote(int64(n))
+		if err != nil {
+			return n, err
+		}
+	} else {
+		if len(w.buf)+len(p) > cap(w.buf) {
+			if err = w.flush(); err != nil {
+				return 0, err
+			}
+		}
+		if len(p) > cap(w.buf) {
+			n, err = w.file.Write(p)
+			w.wrote(int64(n))
+			if err != nil {
+				return n, err
+			}
+		} else {
+			w.buf = append(w.buf, p...)
+			w.size += writeLen
+			n = len(p)
+		}
+	}
+	if w.retention != nil {
+		w.retention.maybeCheckFreeSpace()
+	}
+	return n, nil
+}
+
+// wrote accounts n bytes written to the file. With MultiProcess the size is taken from the
+// file offset, which includes what other processes appended.
+func (w *FileWriter) wrote(n int64) {
+	if w.config.MultiProcess {
+		if off, err := w.file.Seek(0, io.SeekCurrent); err == nil {
+			w.size = off
+			return
+		}
+	}
+	w.size += n
+}
+
+// Flush writes buffered events to the file
+func (w *FileWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+// flush writes the buffer to the file; w.mu must be held
+func (w *FileWriter) flush() error {
+	if len(w.buf) == 0 || w.file == nil {
+		return nil
+	}
+	_, err := w.file.Write(w.buf)
+	w.buf = w.buf[:0]
+	if err == nil && w.config.MultiProcess {
+		w.wrote(0)
+	}
+	return err
+}
+
+// flushLoop flushes the buffer every interval until Close
+func (w *FileWriter) flushLoop(interval time.Duration) {
+	defer close(w.flushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = w.Flush()
+		case <-w.flushStop:
+			return
+		}
+	}
+}
+
+// Rotate closes the current file, renames it to a backup and starts a new one
+func (w *FileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	return w.rotate()
+}
+
+// rotate performs a rotation; w.mu must be held
+func (w *FileWriter) rotate() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.lock != nil {
+		if err := w.lock.lock(); err != nil {
+			return err
+		}
+		defer w.lock.unlock()
+		if w.file != nil && !w.sameFile() {
+			// Another process rotated the file while the lock was awaited
+			if err := w.reopen(); err != nil {
+				return err
+			}
+			w.scheduleNext(w.now())
+			return nil
+		}
+	}
+
+	mode, owner := w.newFileAttributes()
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	rotatedAt := w.now()
+	backup := ""
+	if _, err := os.Stat(w.filename); err == nil {
+		backup = w.backupName(rotatedAt)
+		if err := os.Rename(w.filename, backup); err != nil {
+			return fmt.Errorf("can't rename log file: %w", err)
+		}
+	}
+	if err := w.openNew(mode, owner); err != nil {
+		return err
+	}
+	w.scheduleNext(rotatedAt)
+
+	if w.metrics != nil {
+		w.metrics.recordRotation(w.filename)
+	}
+	if backup != "" {
+		w.events.rotated(RotateEvent{Filename: w.filename, Backup: backup, Size: fileSize(backup), Time: rotatedAt})
+	}
+	if w.retention != nil {
+		w.retention.trigger()
+	}
+	return nil
+}
+
+// openExistingOrNew opens the log file for appending, rotating it first when writeLen
+// would not fit or its rotation boundary has passed since it was last written
+func (w *FileWriter) openExistingOrNew(writeLen int64) error {
+	info, err := os.Stat(w.filename)
+	if os.IsNotExist(err) {
+		if err := w.openNew(w.newFileAttributes()); err != nil {
+			return err
+		}
+		w.scheduleNext(w.now())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting log file info: %w", err)
+	}
+
+	w.scheduleNext(info.ModTime())
+	if info.Size()+writeLen >= w.maxSize() || w.timeToRotate() {
+		return w.rotate()
+	}
+	if err := w.reopen(); err != nil {
+		// The file cannot be appended to, start a new one
+		return w.rotate()
+	}
+	return nil
+}
+
+// reopen closes the current file, if any, and opens the log file for appending
+func (w *FileWriter) reopen() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	w.lastCheck = w.now()
+	return nil
+}
+
+// openNew creates the log file with the given mode and owner
+func (w *FileWriter) openNew(mode os.FileMode, owner *FileOwner) error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return fmt.Errorf("can't make directories for new logfile: %w", err)
+	}
+	// O_APPEND keeps whole writes of several processes from overwriting each other
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("can't open new logfile: %w", err)
+	}
+	if owner != nil {
+		if err := file.Chown(owner.UID, owner.GID); err != nil && w.config.Owner != nil {
+			file.Close()
+			return fmt.Errorf("can't change owner of new logfile: %w", err)
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.size = file, info.Size()
+	w.lastCheck = w.now()
+	return nil
+}
+
+// newFileAttributes returns the mode and owner of the next log file: the configured ones,
+// or those of the current file so a rotation keeps them
+func (w *FileWriter) newFileAttributes() (os.FileMode, *FileOwner) {
+	mode, owner := w.config.FileMode, w.config.Owner
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		if mode == 0 {
+			mode = defaultFileMode
+		}
+		return mode, owner
+	}
+	if mode == 0 {
+		mode = info.Mode().Perm()
+	}
+	if owner == nil {
+		if uid, gid, ok := fileOwner(info); ok && (uid != os.Geteuid() || gid != os.Getegid()) {
+			owner = &FileOwner{UID: uid, GID: gid}
+		}
+	}
+	return mode, owner
+}
+
+// checkIdentity reopens the log file when it was moved or deleted, e.g. rotated by another process
+// or removed together with its directory
+func (w *FileWriter) checkIdentity() {
+	now := w.now()
+	if now.Sub(w.lastCheck) < identityCheckInterval {
+		return
+	}
+	w.lastCheck = now
+	if !w.sameFile() {
+		// Moved or deleted: an error leaves the file closed and the next write opens it again
+		if err := w.flush(); err == nil {
+			_ = w.reopen()
+		}
+		return
+	}
+	if info, err := w.file.Stat(); err == nil && info.Size() < w.size-int64(len(w.buf)) {
+		// Truncated in place, e.g. by copytruncate; appending continues at the new end
+		w.size = info.Size() + int64(len(w.buf))
+	}
+}
+
+// sameFile reports whether the open file is still the one at the log file path
+func (w *FileWriter) sameFile() bool {
+	open, err := w.file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(w.filename)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(open, current)
+}
+
+// closeFile closes the open file, if any
+func (w *FileWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// now returns the time of the clock of the writer
+func (w *FileWriter) now() time.Time {
+	return w.clock.Now()
+}
+
+// setDefaultClock makes rotation and retention follow clock unless RotateConfig.Clock is set
+func (w *FileWriter) setDefaultClock(clock Clock) {
+	w.clock.setDefault(clock)
+}
+
+// maxSize returns the rotation size in bytes
+func (w *FileWriter) maxSize() int64 {
+	if w.config.MaxSize == 0 {
+		return defaultMaxSize
+	}
+	return int64(w.config.MaxSize) * megabyte
+}
+
+// location returns the time zone of backup names and rotation boundaries
+func (w *FileWriter) location() *time.Location {
+	if w.config.LocalTime {
+		return time.Local
+	}
+	return time.UTC
+}
+
+// backupName returns an unused backup name for a rotation at t
+func (w *FileWriter) backupName(t time.Time) string {
+	dir := filepath.Dir(w.filename)
+	base := filepath.Base(w.filename)
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)]
+	for {
+		name := filepath.Join(dir, prefix+"-"+t.In(w.location()).Format(backupTimeFormat)+ext)
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		// Two rotations within the same millisecond
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// scheduleNext computes the next time triggered rotation after t
+func (w *FileWriter) scheduleNext(t time.Time) {
+	if w.config.RotationInterval <= 0 {
+		return
+	}
+	w.next = nextBoundary(t, w.config.RotationInterval, w.location())
+}
+
+// timeToRotate reports whether the time triggered rotation is due
+func (w *FileWriter) timeToRotate() bool {
+	return !w.next.IsZero() && !w.now().Before(w.next)
+}
+
+// nextBoundary returns the first boundary of interval after t. Boundaries are aligned to
+// midnight in loc, so hourly rotation happens on the hour and daily rotation at midnight.
+func nextBoundary(t time.Time, interval time.Duration, loc *time.Location) time.Time {
+	local := t.In(loc)
+	y, m, d := local.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if interval >= 24*time.Hour {
+		return midnight.Add(interval)
+	}
+	return midnight.Add((local.Sub(midnight)/interval + 1) * interval)
+}
+
+// Close flushes buffered events, closes the file and stops the workers of the writer.
+// Writes after Close fail with ErrWriterClosed.
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	err := w.flush()
+	err = firstErr(err, w.closeFile())
+	w.mu.Unlock()
+
+	if w.config.ExternalRotation {
+		unregisterReopen(w)
+	}
+	if w.flushStop != nil {
+		close(w.flushStop)
+		<-w.flushDone
+	}
+	if w.retention != nil {
+		w.retention.stop()
+	}
+	if w.lock != nil {
+		err = firstErr(err, w.lock.close())
+	}
+	if w.events != nil {
+		w.events.close()
+	}
+	return err
+}
+
+// setMetrics attaches a recorder that counts rotations of this file
+func (w *FileWriter) setMetrics(m *metricsRecorder) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.metrics = m
+}
+
+// SinkName returns the log file name, under which write statistics are reported
+func (w *FileWriter) SinkName() string {
+	return w.filename
+}
+
+// WithRotationInterval rotates the log file at every boundary of interval, e.g. time.Hour or 24*time.Hour
+func WithRotationInterval(interval time.Duration) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.RotationInterval = interval
+	}
+}
+
+// WithBufferSize buffers up to size bytes of events in memory, written at the latest after flushInterval
+func WithBufferSize(size int, flushInterval time.Duration) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.BufferSize = size
+		c.FlushInterval = flushInterval
+	}
+}
+
+// WithFileMode sets the permission of new log files
+func WithFileMode(mode os.FileMode) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.FileMode = mode
+	}
+}
+
+// WithFileOwner sets the numeric owner of new log files
+func WithFileOwner(uid, gid int) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.Owner = &FileOwner{UID: uid, GID: gid}
+	}
+}
+
+// WithMultiProcess coordinates rotation and retention with other processes writing the same file
+func WithMultiProcess(multiProcess bool) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.MultiProcess = multiProcess
+	}
+}
+
+// WithRotationClock sets the clock of rotation and retention decisions
+func WithRotationClock(clock Clock) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.Clock = clock
+	}
+}
+
+// fileLock is an advisory lock on a file shared by the processes writing the same log file.
+// Each fileLock has its own file descriptor so locks taken by different goroutines of a
+// process exclude each other as well.
+type fileLock struct {
+	path string
+	file *os.File
+}
+
+// newFileLock creates a lock on path; the file is opened on first use
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+// lock takes the lock, waiting for other holders to release it
+func (l *fileLock) lock() error {
+	if l.file == nil {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("can't open lock file: %w", err)
+		}
+		l.file = f
+	}
+	if err := lockFile(l.file); err != nil {
+		return fmt.Errorf("can't lock log file: %w", err)
+	}
+	return nil
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() {
+	if l.file != nil {
+		_ = unlockFile(l.file)
+	}
+}
+
+// close releases the file descriptor of the lock
+func (l *fileLock) close() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
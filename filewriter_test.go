@@ -0,0 +1,201 @@
+package zlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backupsOf returns the names of the rotated files of filename
+func backupsOf(t *testing.T, filename string) []string {
+	t.Helper()
+	backups, err := listBackups(filename, false)
+	require.NoError(t, err)
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = filepath.Base(b.Path)
+	}
+	return names
+}
+
+func TestFileWriterRotatesBySize(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := NewFileWriter(&RotateConfig{Filename: filename, MaxSize: 1})
+	defer w.Close()
+
+	first := bytes.Repeat([]byte("a"), 600*1024)
+	second := bytes.Repeat([]byte("b"), 600*1024)
+	_, err := w.Write(first)
+	require.NoError(t, err)
+	_, err = w.Write(second)
+	require.NoError(t, err)
+
+	names := backupsOf(t, filename)
+	require.Len(t, names, 1)
+	assert.True(t, strings.HasPrefix(names[0], "app-"))
+	backup, err := os.ReadFile(filepath.Join(filepath.Dir(filename), names[0]))
+	require.NoError(t, err)
+	assert.Equal(t, first, backup)
+	current, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, second, current)
+
+	_, err = w.Write(make([]byte, 2*megabyte))
+	assert.Error(t, err)
+}
+
+func TestFileWriterRotatesOversizedFileOnOpen(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(filename, make([]byte, megabyte), 0644))
+	w := NewFileWriter(&RotateConfig{Filename: filename, MaxSize: 1})
+	defer w.Close()
+
+	_, err := w.Write([]byte("line\n"))
+	require.NoError(t, err)
+	assert.Len(t, backupsOf(t, filename), 1)
+	assert.Equal(t, int64(5), fileSize(filename))
+}
+
+func TestFileWriterRotatesByTime(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	now := time.Date(2024, 5, 1, 10, 59, 0, 0, time.UTC)
+	w := NewFileWriter(&RotateConfig{Filename: filename, RotationInterval: time.Hour})
+	w.clock.set(ClockFunc(func() time.Time { return now }))
+	defer w.Close()
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	now = now.Add(30 * time.Second)
+	_, err = w.Write([]byte("same hour\n"))
+	require.NoError(t, err)
+	assert.Empty(t, backupsOf(t, filename))
+
+	now = now.Add(time.Minute)
+	_, err = w.Write([]byte("next hour\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app-2024-05-01T11-00-30.000.log"}, backupsOf(t, filename))
+}
+
+func TestNextBoundary(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	at := time.Date(2024, 5, 1, 10, 20, 0, 0, loc)
+	assert.Equal(t, time.Date(2024, 5, 1, 11, 0, 0, 0, loc), nextBoundary(at, time.Hour, loc))
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, loc), nextBoundary(at, 15*time.Minute, loc))
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, loc), nextBoundary(at, 24*time.Hour, loc))
+}
+
+func TestFileWriterBuffered(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := NewFileWriter(&RotateConfig{Filename: filename, BufferSize: 4096, FlushInterval: time.Hour})
+
+	_, err := w.Write([]byte("buffered\n"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), fileSize(filename))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, int64(9), fileSize(filename))
+
+	_, err = w.Write([]byte("on close\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, int64(18), fileSize(filename))
+
+	_, err = w.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+}
+
+func TestFileWriterFileMode(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := NewFileWriter(GetDefaultRotateConfig(filename, WithFileMode(0640)))
+	defer w.Close()
+
+	_, err := w.Write([]byte("line\n"))
+	require.NoError(t, err)
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Rotation keeps the mode of the previous file
+	require.NoError(t, os.Chmod(filename, 0604))
+	w.config.FileMode = 0
+	require.NoError(t, w.Rotate())
+	info, err = os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0604), info.Mode().Perm())
+}
+
+func TestFileWriterMultiProcess(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	// Two writers with their own descriptors stand in for two processes
+	first := NewFileWriter(&RotateConfig{Filename: filename, MultiProcess: true})
+	defer first.Close()
+	second := NewFileWriter(&RotateConfig{Filename: filename, MultiProcess: true})
+	defer second.Close()
+	now := time.Now()
+	second.clock.set(ClockFunc(func() time.Time { return now }))
+
+	_, err := first.Write([]byte("first\n"))
+	require.NoError(t, err)
+	_, err = second.Write([]byte("second\n"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), second.size, "size includes what the other process appended")
+
+	require.NoError(t, first.Rotate())
+	// The second writer notices the rotation instead of renaming the new file again
+	require.NoError(t, second.Rotate())
+	assert.Len(t, backupsOf(t, filename), 1)
+
+	now = now.Add(identityCheckInterval)
+	_, err = second.Write([]byte("after\n"))
+	require.NoError(t, err)
+	current, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", string(current))
+	assert.FileExists(t, filename+lockSuffix)
+}
+
+func TestWithRotationClosedByLogger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	config := GetDefaultRotateConfig(filename, WithBufferSize(4096, time.Hour))
+	logger := New(WithRotationAndFormat(config, JSONFormat))
+	require.Len(t, logger.state.closers, 1)
+	fw := logger.state.closers[0].(*FileWriter)
+
+	logger.Info("buffered")
+	assert.Equal(t, int64(0), fileSize(filename))
+	require.NoError(t, logger.Flush())
+	assert.NotZero(t, fileSize(filename))
+
+	logger.Info("on close")
+	require.NoError(t, logger.Close())
+	current, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(current), "on close")
+	_, err = fw.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+
+	var out bytes.Buffer
+	logger = New(WithRotation(GetDefaultRotateConfig(filepath.Join(t.TempDir(), "both.log")), &out))
+	require.Len(t, logger.state.closers, 1)
+	require.NoError(t, logger.Close())
+	_, err = logger.state.closers[0].(*FileWriter).Write([]byte("late\n"))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+}
+
+func TestRotatingLoggerFileWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename))
+	defer logger.Close()
+
+	fw := logger.FileWriter()
+	require.NotNil(t, fw)
+	assert.Same(t, fw, logger.GetRotatingWriter())
+	logger.Info("before rotation")
+	require.NoError(t, fw.Rotate())
+	assert.Len(t, backupsOf(t, filename), 1)
+}
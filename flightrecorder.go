@@ -0,0 +1,317 @@
+// Package zlog provides a flight recorder logging the debug events of failed requests
+package zlog
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// defaultFlightEvents is the number of events buffered per request
+	defaultFlightEvents = 100
+	// defaultFlightContexts is the number of requests buffered at once
+	defaultFlightContexts = 1000
+	// defaultFlightTTL is how long the buffer of an idle request is kept
+	defaultFlightTTL = time.Minute
+)
+
+// FlightRecorderConfig configures the flight recorder enabled with WithFlightRecorder
+type FlightRecorderConfig struct {
+	Level       hertzlog.Level // Level is the lowest level buffered, LevelTrace by default
+	MaxEvents   int            // MaxEvents bounds the events buffered per request, the oldest are dropped; 100 by default
+	MaxContexts int            // MaxContexts bounds the requests buffered at once, the least recently active are dropped; 1000 by default
+	TTL         time.Duration  // TTL drops the buffer of a request idle for longer, 1 minute by default
+}
+
+// WithFlightRecorder buffers the events below the logger level that carry a request ID or
+// trace ID, as added by the Ctx* methods, instead of discarding them. When an Error or Fatal
+// event is logged for the same request, its buffered events are written first, in order;
+// FinishRequest discards them once the request ended successfully.
+func WithFlightRecorder(recorder FlightRecorderConfig) Option {
+	return func(c *config) {
+		c.flightRecorder = &recorder
+	}
+}
+
+// flightRecorder is a zerolog.LevelWriter in front of the output holding back the events
+// below threshold per request
+type flightRecorder struct {
+	next      atomic.Pointer[io.Writer]
+	config    FlightRecorderConfig
+	clock     Clock
+	metrics   *metricsRecorder // metrics counts the buffered events once they are written, nil without WithMetrics
+	threshold atomic.Int32     // threshold is the zerolog.Level events are written at
+
+	mu       sync.Mutex
+	contexts map[string]*list.Element
+	lru      *list.List // lru holds the *flightBuffer of every request, most recently active first
+}
+
+// flightBuffer holds the buffered events of one request
+type flightBuffer struct {
+	key     string
+	events  []flightEvent
+	updated time.Time
+}
+
+// flightEvent is a buffered event
+type flightEvent struct {
+	level zerolog.Level
+	p     []byte
+}
+
+// flightIDs are the fields identifying the request of an event
+type flightIDs struct {
+	RequestID string `json:"request_id"`
+	TraceID   string `json:"trace_id"`
+}
+
+// key returns the buffer key of the request, preferring the request ID
+func (ids flightIDs) key() string {
+	if ids.RequestID != "" {
+		return "request:" + ids.RequestID
+	}
+	if ids.TraceID != "" {
+		return "trace:" + ids.TraceID
+	}
+	return ""
+}
+
+// newFlightRecorder creates a flight recorder writing to next the events at or above level
+func newFlightRecorder(next io.Writer, config FlightRecorderConfig, level hertzlog.Level, clock Clock, metrics *metricsRecorder) *flightRecorder {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = defaultFlightEvents
+	}
+	if config.MaxContexts <= 0 {
+		config.MaxContexts = defaultFlightContexts
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultFlightTTL
+	}
+	f := &flightRecorder{
+		config:   config,
+		clock:    clock,
+		metrics:  metrics,
+		contexts: make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	f.setLevel(level)
+	f.setNext(next)
+	return f
+}
+
+// out returns the writer the recorder writes to
+func (f *flightRecorder) out() io.Writer {
+	return *f.next.Load()
+}
+
+// setNext replaces the writer the recorder writes to, keeping the buffered events
+func (f *flightRecorder) setNext(next io.Writer) {
+	f.next.Store(&next)
+}
+
+// loggerLevel returns the level of the zerolog logger, low enough for the recorder to see the buffered levels
+func (f *flightRecorder) loggerLevel() zerolog.Level {
+	return min(f.level(), toZerologLevel(f.config.Level))
+}
+
+// level returns the level events are written at
+func (f *flightRecorder) level() zerolog.Level {
+	return zerolog.Level(f.threshold.Load())
+}
+
+// written reports whether an event at level is written right away rather than buffered
+func (f *flightRecorder) written(level zerolog.Level) bool {
+	return level == zerolog.NoLevel || level >= f.level()
+}
+
+// setLevel changes the level events are written at
+func (f *flightRecorder) setLevel(level hertzlog.Level) {
+	f.threshold.Store(int32(toZerologLevel(level)))
+}
+
+// Write implements the io.Writer interface for events without level
+func (f *flightRecorder) Write(p []byte) (int, error) {
+	return f.out().Write(p)
+}
+
+// WriteLevel implements the zerolog.LevelWriter interface
+func (f *flightRecorder) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level == zerolog.NoLevel {
+		return f.out().Write(p)
+	}
+	if level >= f.level() {
+		f.mu.Lock()
+		pending := f.lru.Len() > 0
+		f.mu.Unlock()
+		if level >= zerolog.ErrorLevel && pending {
+			if err := f.flush(decodeFlightIDs(p).key()); err != nil {
+				return 0, err
+			}
+		}
+		return f.out().Write(p)
+	}
+	if key := decodeFlightIDs(p).key(); key != "" {
+		f.buffer(key, level, p)
+	}
+	return len(p), nil
+}
+
+// flightSampler samples the events written right away, the buffered ones are kept whole
+type flightSampler struct {
+	zerolog.Sampler
+	flight *flightRecorder
+}
+
+// Sample implements the zerolog.Sampler interface
+func (s *flightSampler) Sample(lvl zerolog.Level) bool {
+	return !s.flight.written(lvl) || s.Sampler.Sample(lvl)
+}
+
+// flightHook runs its hook for the events written right away only
+type flightHook struct {
+	zerolog.Hook
+	flight *flightRecorder
+}
+
+// Run implements the zerolog.Hook interface
+func (h flightHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if h.flight.written(level) {
+		h.Hook.Run(e, level, msg)
+	}
+}
+
+// decodeFlightIDs reads the request identifiers of a JSON event without decoding all of it
+func decodeFlightIDs(p []byte) flightIDs {
+	return flightIDs{RequestID: stringField(p, `"request_id":"`), TraceID: stringField(p, `"trace_id":"`)}
+}
+
+// stringField returns the value of the last string field of the JSON event p starting with prefix,
+// the quoted key followed by the opening quote of the value; like a JSON decoder, the last one wins
+func stringField(p []byte, prefix string) string {
+	i := bytes.LastIndex(p, []byte(prefix))
+	if i < 0 {
+		return ""
+	}
+	value := p[i+len(prefix):]
+	end := bytes.IndexByte(value, '"')
+	if end < 0 {
+		return ""
+	}
+	if bytes.IndexByte(value[:end], '\\') < 0 {
+		return string(value[:end])
+	}
+	// The value holds escapes, the closing quote is found by the decoder
+	var s string
+	_ = json.NewDecoder(bytes.NewReader(p[i+len(prefix)-1:])).Decode(&s)
+	return s
+}
+
+// buffer keeps a copy of the event p at level for the request key
+func (f *flightRecorder) buffer(key string, level zerolog.Level, p []byte) {
+	now := f.clock.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var b *flightBuffer
+	if el, ok := f.contexts[key]; ok {
+		b = el.Value.(*flightBuffer)
+		f.lru.MoveToFront(el)
+	} else {
+		b = &flightBuffer{key: key}
+		f.contexts[key] = f.lru.PushFront(b)
+	}
+	b.updated = now
+	if len(b.events) >= f.config.MaxEvents {
+		b.events = append(b.events[:0], b.events[1:]...)
+	}
+	b.events = append(b.events, flightEvent{level: level, p: append([]byte(nil), p...)})
+	for el := f.lru.Back(); el != nil; el = f.lru.Back() {
+		if f.lru.Len() <= f.config.MaxContexts && now.Sub(el.Value.(*flightBuffer).updated) <= f.config.TTL {
+			break
+		}
+		f.remove(el)
+	}
+}
+
+// remove drops the buffer of el; f.mu must be held
+func (f *flightRecorder) remove(el *list.Element) {
+	delete(f.contexts, el.Value.(*flightBuffer).key)
+	f.lru.Remove(el)
+}
+
+// take removes and returns the events buffered for key
+func (f *flightRecorder) take(key string) []flightEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	el, ok := f.contexts[key]
+	if !ok {
+		return nil
+	}
+	f.remove(el)
+	return el.Value.(*flightBuffer).events
+}
+
+// flush writes the events buffered for key in order, counting them as emitted
+func (f *flightRecorder) flush(key string) error {
+	if key == "" {
+		return nil
+	}
+	for _, e := range f.take(key) {
+		if _, err := f.out().Write(e.p); err != nil {
+			return err
+		}
+		if f.metrics != nil {
+			f.metrics.recordEvent(e.level, stringField(e.p, `"`+LoggerNameKey+`":"`))
+		}
+	}
+	return nil
+}
+
+// discard drops the events buffered for the request of ctx
+func (f *flightRecorder) discard(ctx context.Context) {
+	f.take(contextFlightIDs(ctx).key())
+}
+
+// contextFlightIDs returns the request identifiers the Ctx* methods log for ctx
+func contextFlightIDs(ctx context.Context) flightIDs {
+	var ids flightIDs
+	if ctx == nil {
+		return ids
+	}
+	if reqID := ctx.Value(ReqIDKey); reqID != nil {
+		ids.RequestID = fmt.Sprintf("%v", reqID)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		ids.TraceID = sc.TraceID().String()
+	}
+	return ids
+}
+
+// FinishRequest discards the events the flight recorder buffered for the request of ctx;
+// call it when the request ended without error. It does nothing without WithFlightRecorder.
+func (zl *ZLogger) FinishRequest(ctx context.Context) {
+	if flight := zl.core().flight; flight != nil {
+		flight.discard(ctx)
+	}
+}
+
+// HertzFlightRecorder returns a Hertz middleware calling FinishRequest once later handlers
+// returned, so the buffered events of a request are only kept until it ends
+func HertzFlightRecorder(logger *ZLogger) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		defer logger.FinishRequest(c)
+		ctx.Next(c)
+	}
+}
@@ -0,0 +1,145 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestContext returns a context carrying a request ID as read by the Ctx* methods
+func requestContext(id string) context.Context {
+	return context.WithValue(context.Background(), ReqIDKey, id)
+}
+
+// messages returns the messages of the JSON lines in out
+func messages(out *bytes.Buffer) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		msgs = append(msgs, decodeEvent([]byte(line)).Message)
+	}
+	return msgs
+}
+
+func TestFlightRecorderFlushesOnError(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat), WithFlightRecorder(FlightRecorderConfig{}))
+	failed, succeeded := requestContext("r1"), requestContext("r2")
+
+	logger.Debug("no request")
+	logger.CtxDebugf(failed, "loading %d", 1)
+	logger.CtxTracef(succeeded, "other request")
+	logger.CtxInfof(failed, "handling")
+	logger.CtxDebugf(failed, "loading %d", 2)
+	assert.Equal(t, []string{"handling"}, messages(&out))
+
+	logger.CtxErrorf(failed, "failed")
+	assert.Equal(t, []string{"handling", "loading 1", "loading 2", "failed"}, messages(&out))
+	assert.Contains(t, out.String(), `"level":"debug"`)
+
+	// Only the failed request was flushed, and only once
+	out.Reset()
+	logger.CtxErrorf(failed, "failed again")
+	assert.Equal(t, []string{"failed again"}, messages(&out))
+	logger.FinishRequest(succeeded)
+	out.Reset()
+	logger.CtxErrorf(succeeded, "late error")
+	assert.Equal(t, []string{"late error"}, messages(&out))
+}
+
+func TestFlightRecorderUsesTraceID(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat),
+		WithFlightRecorder(FlightRecorderConfig{Level: hertzlog.LevelDebug}))
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	logger.CtxTracef(ctx, "below the recorder level")
+	logger.CtxDebugf(ctx, "query")
+	logger.Named("db").ErrorErr(fmt.Errorf("boom"), "unrelated")
+	logger.CtxErrorf(ctx, "failed")
+	assert.Equal(t, []string{"unrelated", "query", "failed"}, messages(&out))
+}
+
+func TestFlightRecorderBounds(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFormat(JSONFormat),
+		WithFlightRecorder(FlightRecorderConfig{MaxEvents: 2, MaxContexts: 2, TTL: time.Hour}))
+	for i := 0; i < 3; i++ {
+		logger.CtxDebugf(requestContext("r1"), "r1 %d", i)
+	}
+	logger.CtxDebugf(requestContext("r2"), "r2")
+	logger.CtxDebugf(requestContext("r3"), "r3")
+	assert.Len(t, logger.core().flight.contexts, 2)
+
+	logger.CtxErrorf(requestContext("r1"), "r1 failed")
+	assert.Equal(t, []string{"r1 failed"}, messages(&out), "the least recently active request was dropped")
+	logger.CtxErrorf(requestContext("r3"), "r3 failed")
+	assert.Equal(t, []string{"r1 failed", "r3", "r3 failed"}, messages(&out))
+
+	logger.core().flight.config.TTL = time.Nanosecond
+	logger.CtxDebugf(requestContext("r4"), "r4")
+	time.Sleep(time.Millisecond)
+	logger.CtxDebugf(requestContext("r5"), "r5")
+	assert.NotContains(t, logger.core().flight.contexts, "request:r4", "idle requests expire")
+	assert.Contains(t, logger.core().flight.contexts, "request:r5")
+
+	limited := newFlightRecorder(&out, FlightRecorderConfig{MaxEvents: 2}, hertzlog.LevelInfo, SystemClock, nil)
+	for i := 0; i < 3; i++ {
+		limited.buffer("k", zerolog.DebugLevel, []byte(fmt.Sprint(i)))
+	}
+	assert.Equal(t, []flightEvent{{zerolog.DebugLevel, []byte("1")}, {zerolog.DebugLevel, []byte("2")}}, limited.take("k"))
+}
+
+func TestFlightRecorderSetLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithFlightRecorder(FlightRecorderConfig{}))
+	ctx := requestContext("r1")
+
+	logger.SetLevel(hertzlog.LevelDebug)
+	logger.CtxDebugf(ctx, "visible")
+	logger.CtxTracef(ctx, "buffered")
+	require.Contains(t, out.String(), "visible")
+	assert.NotContains(t, out.String(), "buffered")
+	logger.CtxErrorf(ctx, "failed")
+	assert.Contains(t, out.String(), "buffered", "console output renders the flushed events too")
+}
+
+func TestFlightRecorderCountsWrittenEvents(t *testing.T) {
+	var out bytes.Buffer
+	sampler := &zerolog.BasicSampler{N: 2}
+	logger := New(WithOutput(&out), WithFormat(JSONFormat), WithLevel(hertzlog.LevelInfo), WithMetrics(nil),
+		WithSampler(sampler), WithFlightRecorder(FlightRecorderConfig{}))
+	ctx := requestContext("r1")
+
+	for i := 0; i < 5; i++ {
+		logger.CtxDebugf(ctx, "loading %d", i)
+	}
+	stats := logger.Stats()
+	assert.Zero(t, stats.Events["debug"], "buffered events are not counted")
+	assert.Zero(t, stats.Sampled)
+
+	logger.CtxErrorf(ctx, "failed")
+	assert.Len(t, messages(&out), 6, "buffered events are not sampled")
+	stats = logger.Stats()
+	assert.Equal(t, uint64(5), stats.Events["debug"])
+	assert.Equal(t, uint64(1), stats.Events["error"])
+}
+
+func TestDecodeFlightIDs(t *testing.T) {
+	ids := decodeFlightIDs([]byte(`{"level":"debug","message":"\"request_id\":\"x\"","request_id":"r1","trace_id":"t\"1"}`))
+	assert.Equal(t, flightIDs{RequestID: "r1", TraceID: `t"1`}, ids)
+	assert.Equal(t, flightIDs{}, decodeFlightIDs([]byte(`{"level":"debug"}`)))
+}
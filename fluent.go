@@ -0,0 +1,189 @@
+// Package zlog provides an output for Fluentd and Fluent Bit using the Forward protocol
+package zlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultFluentAddress is the default address of the forward input
+	defaultFluentAddress = "127.0.0.1:24224"
+	// defaultFluentTag is the tag of events logged without a logger name
+	defaultFluentTag = "zlog"
+)
+
+// FluentConfig configures a Fluent Forward sink
+type FluentConfig struct {
+	Network    string          // Network is "tcp", the default, or "unix"
+	Address    string          // Address is the host:port or socket path of the forward input, 127.0.0.1:24224 by default
+	Tag        string          // Tag is the tag of events without a logger name, "zlog" by default; named loggers use Tag.name
+	RequireAck bool            // RequireAck makes every chunk wait for the acknowledgement of the server
+	Batching   PublisherConfig // Batching configures the queue, batches and retries; its Publisher is ignored
+}
+
+// FluentPublisher is a Publisher sending batches as Fluent Forward PackedForward messages,
+// one per tag, with EventTime timestamps. It connects on first use and reconnects on the
+// next batch after a failure.
+type FluentPublisher struct {
+	config FluentConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewFluentPublisher creates a FluentPublisher for config
+func NewFluentPublisher(config FluentConfig) (*FluentPublisher, error) {
+	switch config.Network {
+	case "":
+		config.Network = "tcp"
+	case "tcp", "unix":
+	default:
+		return nil, fmt.Errorf("zlog: unsupported fluent network %q", config.Network)
+	}
+	if config.Address == "" {
+		if config.Network == "unix" {
+			return nil, errors.New("zlog: fluent socket path is required")
+		}
+		config.Address = defaultFluentAddress
+	}
+	if config.Tag == "" {
+		config.Tag = defaultFluentTag
+	}
+	return &FluentPublisher{config: config}, nil
+}
+
+// NewFluentSink creates a PublisherSink sending events to a Fluentd or Fluent Bit forward input.
+// Use AtLeastOnce delivery to keep retrying batches while the server is unreachable.
+func NewFluentSink(config FluentConfig) (*PublisherSink, error) {
+	p, err := NewFluentPublisher(config)
+	if err != nil {
+		return nil, err
+	}
+	batching := config.Batching
+	batching.Publisher = p
+	s, err := NewPublisherSink(batching)
+	if err != nil {
+		return nil, err
+	}
+	s.name = "fluent"
+	return s, nil
+}
+
+// Publish implements the Publisher interface
+func (p *FluentPublisher) Publish(ctx context.Context, batch []Message) error {
+	var tags []string
+	entries := map[string][]byte{}
+	sizes := map[string]int{}
+	for _, msg := range batch {
+		tag, entry := p.encode(decodeEvent(msg.Value))
+		if _, ok := entries[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		entries[tag] = append(entries[tag], entry...)
+		sizes[tag]++
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, p.config.Network, p.config.Address)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultPublishTimeout)
+	}
+	_ = p.conn.SetDeadline(deadline)
+	for _, tag := range tags {
+		if err := p.send(tag, entries[tag], sizes[tag]); err != nil {
+			_ = p.conn.Close()
+			p.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// encode returns the tag of an event and its [time, record] entry
+func (p *FluentPublisher) encode(e logEvent) (string, []byte) {
+	tag := p.config.Tag
+	if name, ok := e.Fields[LoggerNameKey].(string); ok && name != "" {
+		tag += "." + name
+	}
+	record := make(map[string]interface{}, len(e.Fields)+2)
+	for k, v := range e.Fields {
+		record[k] = v
+	}
+	record[zerolog.MessageFieldName] = e.Message
+	if e.Level != zerolog.NoLevel {
+		record[zerolog.LevelFieldName] = e.Level.String()
+	}
+	entry := append([]byte{0x92}, appendMsgpack(nil, eventTime(e.Time))...)
+	return tag, appendMsgpack(entry, record)
+}
+
+// send writes one PackedForward message and waits for its acknowledgement when required; p.mu must be held
+func (p *FluentPublisher) send(tag string, entries []byte, size int) error {
+	option := map[string]interface{}{"size": size}
+	var chunk string
+	if p.config.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+	msg := appendMsgpack(nil, []interface{}{tag, entries, option})
+	if _, err := p.conn.Write(msg); err != nil {
+		return err
+	}
+	if !p.config.RequireAck {
+		return nil
+	}
+
+	var resp []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := p.conn.Read(buf)
+		resp = append(resp, buf[:n]...)
+		v, _, decodeErr := decodeMsgpack(resp)
+		if decodeErr == nil {
+			if m, ok := v.(map[string]interface{}); ok && m["ack"] == chunk {
+				return nil
+			}
+			return fmt.Errorf("zlog: unexpected fluent acknowledgement %v", v)
+		}
+		if !errors.Is(decodeErr, errShortMsgpack) {
+			return decodeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the connection
+func (p *FluentPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
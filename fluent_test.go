@@ -0,0 +1,193 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// forwardEntry is an event received by a forwardServer
+type forwardEntry struct {
+	Tag    string
+	Time   time.Time
+	Record map[string]interface{}
+}
+
+// forwardServer is a minimal Fluent Forward input decoding PackedForward messages and acknowledging chunks
+type forwardServer struct {
+	listener net.Listener
+	noAck    bool // noAck makes the server swallow chunks without acknowledging them
+
+	mu       sync.Mutex
+	entries  []forwardEntry
+	messages int
+}
+
+// newForwardServer starts a forwardServer on a local port
+func newForwardServer(t *testing.T) *forwardServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &forwardServer{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+	return s
+}
+
+// serve decodes the messages of one connection
+func (s *forwardServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+		for {
+			v, rest, decodeErr := decodeMsgpack(data)
+			if errors.Is(decodeErr, errShortMsgpack) {
+				break
+			}
+			require.NoError(t, decodeErr)
+			data = rest
+			msg := v.([]interface{})
+			require.Len(t, msg, 3)
+			tag := msg[0].(string)
+			option := msg[2].(map[string]interface{})
+			var entries []forwardEntry
+			for packed := msg[1].([]byte); len(packed) > 0; {
+				entry, rest, err := decodeMsgpack(packed)
+				require.NoError(t, err)
+				packed = rest
+				pair := entry.([]interface{})
+				entries = append(entries, forwardEntry{Tag: tag, Time: time.Time(pair[0].(eventTime)),
+					Record: pair[1].(map[string]interface{})})
+			}
+			assert.Equal(t, int64(len(entries)), option["size"])
+			s.mu.Lock()
+			noAck := s.noAck
+			if !noAck {
+				s.entries = append(s.entries, entries...)
+				s.messages++
+			}
+			s.mu.Unlock()
+			if chunk, ok := option["chunk"]; ok && !noAck {
+				_, _ = conn.Write(appendMsgpack(nil, map[string]interface{}{"ack": chunk}))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// received returns the entries received so far
+func (s *forwardServer) received() []forwardEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]forwardEntry(nil), s.entries...)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	in := []interface{}{nil, true, false, int64(5), int64(-3), int64(300), int64(-70000), int64(1) << 40, 1.5,
+		"short", string(make([]byte, 40)), string(make([]byte, 70000)), []byte{1, 2}, eventTime(now),
+		map[string]interface{}{"a": int64(1), "b": []interface{}{"x"}}}
+	b := appendMsgpack(nil, in)
+	out, rest, err := decodeMsgpack(b)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, in, out)
+
+	v, _, err := decodeMsgpack(appendMsgpack(nil, json.Number("12")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), v)
+	v, _, err = decodeMsgpack(appendMsgpack(nil, json.Number("0.25")))
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, v)
+	_, _, err = decodeMsgpack(b[:len(b)-1])
+	assert.ErrorIs(t, err, errShortMsgpack)
+}
+
+func TestFluentSinkTagsByLoggerName(t *testing.T) {
+	server := newForwardServer(t)
+	s, err := NewFluentSink(FluentConfig{Address: server.listener.Addr().String(), Tag: "app", RequireAck: true,
+		Batching: PublisherConfig{FlushInterval: time.Hour}})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "fluent", s.SinkName())
+	logger := New(WithOutput(s))
+
+	logger.Info("started")
+	logger.Named("access").Infof("GET %s", "/")
+	logger.Named("access").CtxErrorf(context.Background(), "failed")
+	require.NoError(t, logger.Flush())
+
+	entries := server.received()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "app", entries[0].Tag)
+	assert.Equal(t, "started", entries[0].Record["message"])
+	assert.Equal(t, "info", entries[0].Record["level"])
+	assert.WithinDuration(t, time.Now(), entries[0].Time, time.Minute)
+	assert.Equal(t, "app.access", entries[1].Tag)
+	assert.Equal(t, "GET /", entries[1].Record["message"])
+	assert.Equal(t, "access", entries[1].Record["logger"])
+	assert.Equal(t, "error", entries[2].Record["level"])
+	server.mu.Lock()
+	assert.Equal(t, 2, server.messages, "one PackedForward message per tag")
+	server.mu.Unlock()
+}
+
+func TestFluentSinkReconnectsAndRetries(t *testing.T) {
+	server := newForwardServer(t)
+	server.noAck = true
+	s, err := NewFluentSink(FluentConfig{Address: server.listener.Addr().String(), RequireAck: true,
+		Batching: PublisherConfig{Delivery: AtLeastOnce, Timeout: 100 * time.Millisecond,
+			MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Write([]byte(`{"level":"warn","time":"2024-01-02T03:04:05Z","message":"a","count":3}`))
+	time.Sleep(300 * time.Millisecond)
+	server.mu.Lock()
+	server.noAck = false
+	server.mu.Unlock()
+	require.NoError(t, s.Flush())
+
+	entries := server.received()
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "zlog", entries[0].Tag)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), entries[0].Time.UTC())
+	assert.Equal(t, int64(3), entries[0].Record["count"])
+	assert.Zero(t, s.Dropped())
+}
+
+func TestFluentPublisherFailsWithoutServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	p, err := NewFluentPublisher(FluentConfig{Address: addr})
+	require.NoError(t, err)
+	defer p.Close()
+	err = p.Publish(context.Background(), []Message{{Value: []byte(`{"message":"a"}`)}})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, io.EOF)
+
+	_, err = NewFluentPublisher(FluentConfig{Network: "udp"})
+	assert.Error(t, err)
+}
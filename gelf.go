@@ -0,0 +1,237 @@
+// Package zlog provides a GELF output for Graylog over UDP and TCP
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultGELFChunkSize is the size of UDP chunks, fitting a typical MTU
+	defaultGELFChunkSize = 1420
+	// gelfChunkHeaderSize is the size of the magic bytes, message id, sequence number and count of a chunk
+	gelfChunkHeaderSize = 12
+	// maxGELFChunks is the largest number of chunks a message may be split into
+	maxGELFChunks = 128
+)
+
+// GELFCompression is the compression of GELF messages sent over UDP
+type GELFCompression int
+
+const (
+	// GELFGzip compresses UDP messages with gzip, the default
+	GELFGzip GELFCompression = iota
+	// GELFZlib compresses UDP messages with zlib
+	GELFZlib
+	// GELFUncompressed sends UDP messages as plain JSON
+	GELFUncompressed
+)
+
+// GELFConfig configures a GELFWriter
+type GELFConfig struct {
+	Network     string            // Network is "udp", the default, or "tcp"
+	Address     string            // Address is the host:port of the Graylog input
+	Host        string            // Host is the host field, os.Hostname by default
+	Compression GELFCompression   // Compression applies to UDP; TCP messages are never compressed
+	ChunkSize   int               // ChunkSize is the size of UDP datagrams, 1420 by default
+	Fields      map[string]string // Fields are added to every message as additional fields
+}
+
+// GELFWriter sends events to Graylog as GELF 1.1 messages. The message becomes short_message,
+// or full_message with its first line as short_message when it spans several lines; the level
+// becomes the syslog severity and every other field an additional field, e.g. _trace_id.
+// UDP messages larger than a datagram are chunked; TCP messages are delimited by a null byte.
+type GELFWriter struct {
+	config GELFConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGELFWriter creates a GELFWriter for config and connects to the input
+func NewGELFWriter(config GELFConfig) (*GELFWriter, error) {
+	switch config.Network {
+	case "":
+		config.Network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("zlog: unsupported GELF network %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, errors.New("zlog: GELF address is required")
+	}
+	if config.Host == "" {
+		config.Host, _ = os.Hostname()
+	}
+	if config.ChunkSize <= gelfChunkHeaderSize {
+		config.ChunkSize = defaultGELFChunkSize
+	}
+	g := &GELFWriter{config: config}
+	conn, err := net.DialTimeout(config.Network, config.Address, syslogTimeout)
+	if err != nil {
+		return nil, err
+	}
+	g.conn = conn
+	return g, nil
+}
+
+// Write implements the io.Writer interface. p is a JSON event of the logger; any other
+// output is sent as the message of an informational event.
+func (g *GELFWriter) Write(p []byte) (int, error) {
+	msg, err := g.encode(decodeEvent(p))
+	if err != nil {
+		return 0, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return 0, ErrWriterClosed
+	}
+	if g.config.Network == "udp" {
+		err = g.sendUDP(msg)
+	} else {
+		err = g.sendTCP(append(msg, 0))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encode renders an event as a GELF message
+func (g *GELFWriter) encode(e logEvent) ([]byte, error) {
+	msg := map[string]interface{}{
+		"version":   "1.1",
+		"host":      g.config.Host,
+		"timestamp": math.Round(float64(e.Time.UnixNano())/1e6) / 1e3,
+		"level":     int(severityOf(e)),
+	}
+	short := e.Message
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = short[:i]
+		msg["full_message"] = e.Message
+	}
+	if short == "" {
+		short = "-"
+	}
+	msg["short_message"] = short
+	for k, v := range g.config.Fields {
+		msg[gelfFieldName(k)] = v
+	}
+	for k, v := range e.Fields {
+		if n, ok := v.(json.Number); ok {
+			msg[gelfFieldName(k)] = n
+		} else {
+			msg[gelfFieldName(k)] = fieldString(v)
+		}
+	}
+	return json.Marshal(msg)
+}
+
+// gelfFieldName returns the additional field name of an event field: prefixed with an
+// underscore, made of word characters, dots and dashes, and never the reserved _id
+func gelfFieldName(name string) string {
+	name = "_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "_id" {
+		return "__id"
+	}
+	return name
+}
+
+// sendUDP compresses msg and sends it in one datagram or in chunks; g.mu must be held
+func (g *GELFWriter) sendUDP(msg []byte) error {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch g.config.Compression {
+	case GELFGzip:
+		zw = gzip.NewWriter(&buf)
+	case GELFZlib:
+		zw = zlib.NewWriter(&buf)
+	}
+	if zw != nil {
+		_, _ = zw.Write(msg)
+		_ = zw.Close()
+		msg = buf.Bytes()
+	}
+	if len(msg) <= g.config.ChunkSize {
+		_, err := g.conn.Write(msg)
+		return err
+	}
+
+	payload := g.config.ChunkSize - gelfChunkHeaderSize
+	count := (len(msg) + payload - 1) / payload
+	if count > maxGELFChunks {
+		return fmt.Errorf("zlog: GELF message of %d bytes needs more than %d chunks", len(msg), maxGELFChunks)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, g.config.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*payload, len(msg))
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*payload:end]...)
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendTCP writes a null-terminated message, reconnecting once when the connection was lost; g.mu must be held
+func (g *GELFWriter) sendTCP(msg []byte) error {
+	_ = g.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := g.conn.Write(msg); err == nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", g.config.Address, syslogTimeout)
+	if err != nil {
+		return err
+	}
+	_ = g.conn.Close()
+	g.conn = conn
+	_ = g.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err = g.conn.Write(msg)
+	return err
+}
+
+// SinkName returns the name statistics are reported under
+func (g *GELFWriter) SinkName() string {
+	return "gelf"
+}
+
+// structured marks GELFWriter as decoding JSON events
+func (g *GELFWriter) structured() {}
+
+// Close closes the connection
+func (g *GELFWriter) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
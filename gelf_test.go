@@ -0,0 +1,130 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// gunzipGELF decompresses a GELF message and decodes it
+func gunzipGELF(t *testing.T, data []byte) map[string]interface{} {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal(plain, &msg))
+	return msg
+}
+
+func TestGELFOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+
+	w, err := NewGELFWriter(GELFConfig{Address: conn.LocalAddr().String(), Host: "host1", Fields: map[string]string{"service": "billing"}})
+	require.NoError(t, err)
+	defer w.Close()
+	logger := New(WithOutput(w))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	logger.CtxWarnf(ctx, "payment retried\nattempt 2")
+
+	msg := gunzipGELF(t, []byte(receive(t, received)))
+	assert.Equal(t, "1.1", msg["version"])
+	assert.Equal(t, "host1", msg["host"])
+	assert.Equal(t, "payment retried", msg["short_message"])
+	assert.Equal(t, "payment retried\nattempt 2", msg["full_message"])
+	assert.Equal(t, float64(SeverityWarning), msg["level"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", msg["_trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", msg["_span_id"])
+	assert.Equal(t, "billing", msg["_service"])
+	assert.NotZero(t, msg["timestamp"])
+	assert.NotContains(t, msg, "_level")
+
+	logger.CtxNoticef(ctx, "payment settled")
+	msg = gunzipGELF(t, []byte(receive(t, received)))
+	assert.Equal(t, float64(SeverityNotice), msg["level"])
+	assert.NotContains(t, msg, "_zlog.notice")
+}
+
+func TestGELFChunking(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+
+	w, err := NewGELFWriter(GELFConfig{Address: conn.LocalAddr().String(), ChunkSize: 100, Compression: GELFUncompressed})
+	require.NoError(t, err)
+	defer w.Close()
+	_, err = w.Write([]byte(`{"level":"info","message":"` + strings.Repeat("x", 500) + `"}`))
+	require.NoError(t, err)
+
+	first := []byte(receive(t, received))
+	require.Equal(t, []byte{0x1e, 0x0f}, first[:2])
+	count := int(first[11])
+	chunks := [][]byte{first}
+	for len(chunks) < count {
+		chunks = append(chunks, []byte(receive(t, received)))
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i][10] < chunks[j][10] })
+	var whole []byte
+	for _, c := range chunks {
+		assert.Equal(t, first[2:10], c[2:10], "chunks share the message id")
+		assert.LessOrEqual(t, len(c), 100)
+		whole = append(whole, c[gelfChunkHeaderSize:]...)
+	}
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal(whole, &msg))
+	assert.Equal(t, strings.Repeat("x", 500), msg["short_message"])
+}
+
+func TestGELFOverTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	messages := make(chan string, 4)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			messages <- strings.TrimSuffix(msg, "\x00")
+		}
+	}()
+
+	w, err := NewGELFWriter(GELFConfig{Network: "tcp", Address: l.Addr().String()})
+	require.NoError(t, err)
+	defer w.Close()
+	w.Write([]byte(`{"level":"error","message":"a","id":7,"user.name":"u1"}`))
+	w.Write([]byte(`{"level":"info","message":"b"}`))
+
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(receive(t, messages)), &msg))
+	assert.Equal(t, "a", msg["short_message"])
+	assert.Equal(t, float64(SeverityError), msg["level"])
+	assert.Equal(t, float64(7), msg["__id"])
+	assert.Equal(t, "u1", msg["_user.name"])
+	require.NoError(t, json.Unmarshal([]byte(receive(t, messages)), &msg))
+	assert.Equal(t, "b", msg["short_message"])
+}
@@ -0,0 +1,629 @@
+// Package zlog provides a batching HTTP output for Loki, Elasticsearch and NDJSON endpoints
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultHTTPBatchSize is the number of events after which a batch is sent
+	defaultHTTPBatchSize = 1000
+	// defaultHTTPBatchBytes is the size in bytes after which a batch is sent
+	defaultHTTPBatchBytes = megabyte
+	// defaultHTTPFlushInterval is how long events wait for a batch to fill
+	defaultHTTPFlushInterval = time.Second
+	// defaultHTTPRetries is the number of retries of a failed request
+	defaultHTTPRetries = 5
+	// defaultHTTPMinBackoff and defaultHTTPMaxBackoff bound the delay between retries
+	defaultHTTPMinBackoff = 500 * time.Millisecond
+	defaultHTTPMaxBackoff = 30 * time.Second
+	// defaultHTTPTimeout bounds a single request when no Client is configured
+	defaultHTTPTimeout = 10 * time.Second
+	// defaultSpoolSize is the size of the on-disk queue in MB
+	defaultSpoolSize = 100
+	// maxQueuedBatches is the number of full batches kept in memory while a request is in flight
+	maxQueuedBatches = 16
+	// spoolPrefix and spoolSuffix surround the sequence number of spooled batch files
+	spoolPrefix = "batch-"
+	spoolSuffix = ".ndjson"
+)
+
+// HTTPFormat is the request format of an HTTPSink
+type HTTPFormat int
+
+const (
+	// HTTPFormatNDJSON posts the events as newline delimited JSON
+	HTTPFormatNDJSON HTTPFormat = iota
+	// HTTPFormatLoki posts to the Loki push API, /loki/api/v1/push
+	HTTPFormatLoki
+	// HTTPFormatElasticsearch posts to the Elasticsearch bulk API, /_bulk
+	HTTPFormatElasticsearch
+)
+
+// HTTPSinkConfig configures an HTTPSink
+type HTTPSinkConfig struct {
+	URL           string            // URL is the endpoint events are posted to
+	Format        HTTPFormat        // Format is HTTPFormatNDJSON by default
+	Client        *http.Client      // Client sends the requests, a client with a 10 second timeout by default
+	Headers       map[string]string // Headers are added to every request, e.g. Authorization
+	BatchSize     int               // BatchSize is the number of events per request, 1000 by default
+	BatchBytes    int               // BatchBytes is the size of the events per request, 1 MB by default
+	FlushInterval time.Duration     // FlushInterval is how long events wait for a batch to fill, 1 second by default
+	Gzip          bool              // Gzip compresses request bodies
+	MaxRetries    int               // MaxRetries is the number of retries of a failed request, 5 by default, negative disables retries
+	MinBackoff    time.Duration     // MinBackoff is the delay before the first retry, 500ms by default
+	MaxBackoff    time.Duration     // MaxBackoff bounds the delay between retries, 30 seconds by default
+	Labels        map[string]string // Labels are the static Loki stream labels
+	LabelFields   []string          // LabelFields are the event fields that become Loki stream labels, e.g. "level"
+	Index         string            // Index is the Elasticsearch index or data stream, "logs" by default
+	SpoolDir      string            // SpoolDir keeps batches on disk while the endpoint is down; empty drops them
+	SpoolMaxSize  int               // SpoolMaxSize is the size of the spool in MB, 100 by default; the oldest batches are dropped beyond it
+}
+
+// HTTPSink batches events by count, size and time and posts them to an HTTP endpoint on a
+// background goroutine. Failed requests are retried with exponential backoff and jitter,
+// honoring Retry-After on 429 and 503 responses. Batches that still fail are written to
+// SpoolDir and sent, oldest first, once the endpoint is back, also after a restart.
+type HTTPSink struct {
+	config HTTPSinkConfig
+
+	mu         sync.Mutex
+	batch      [][]byte
+	batchBytes int
+	queue      [][][]byte
+	closed     bool
+
+	// down, probeAttempt and nextProbe are only used by the sending goroutine
+	down         bool
+	probeAttempt int
+	nextProbe    time.Time
+	spoolSeq     atomic.Uint64
+
+	dropped  atomic.Uint64
+	metrics  atomic.Pointer[metricsRecorder]
+	wake     chan struct{}
+	flushReq chan chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewHTTPSink creates an HTTPSink for config and starts sending, beginning with batches a
+// previous process left in the spool
+func NewHTTPSink(config HTTPSinkConfig) (*HTTPSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("zlog: http sink URL is required")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultHTTPBatchSize
+	}
+	if config.BatchBytes <= 0 {
+		config.BatchBytes = defaultHTTPBatchBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultHTTPFlushInterval
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultHTTPRetries
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultHTTPMinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultHTTPMaxBackoff
+	}
+	if config.Index == "" {
+		config.Index = "logs"
+	}
+	if config.SpoolMaxSize <= 0 {
+		config.SpoolMaxSize = defaultSpoolSize
+	}
+	if config.SpoolDir != "" {
+		if err := os.MkdirAll(config.SpoolDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create spool directory: %w", err)
+		}
+	}
+
+	s := &HTTPSink{
+		config:   config,
+		wake:     make(chan struct{}, 1),
+		flushReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	s.spoolSeq.Store(uint64(time.Now().UnixNano()))
+	go s.run()
+	return s, nil
+}
+
+// Write implements the io.Writer interface; p is copied into the current batch
+func (s *HTTPSink) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	if json.Valid(line) {
+		line = append([]byte(nil), stripNotice(line)...)
+	} else {
+		line, _ = json.Marshal(map[string]string{zerolog.MessageFieldName: string(line)})
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrWriterClosed
+	}
+	s.batch = append(s.batch, line)
+	s.batchBytes += len(line)
+	full := len(s.batch) >= s.config.BatchSize || s.batchBytes >= s.config.BatchBytes
+	if full {
+		s.enqueue()
+	}
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// enqueue moves the current batch to the send queue, dropping the oldest queued batch when
+// the queue is full; s.mu must be held
+func (s *HTTPSink) enqueue() {
+	if len(s.batch) == 0 {
+		return
+	}
+	s.queue = append(s.queue, s.batch)
+	s.batch, s.batchBytes = nil, 0
+	if len(s.queue) > maxQueuedBatches {
+		s.recordDropped(len(s.queue[0]))
+		s.queue = s.queue[1:]
+	}
+}
+
+// run sends the queued batches until the sink is closed
+func (s *HTTPSink) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	s.process()
+	for {
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+			s.mu.Lock()
+			s.enqueue()
+			s.mu.Unlock()
+		case ack := <-s.flushReq:
+			s.mu.Lock()
+			s.enqueue()
+			s.mu.Unlock()
+			s.process()
+			close(ack)
+			continue
+		case <-s.done:
+			// Every remaining batch gets a single attempt before it is spooled
+			s.mu.Lock()
+			s.enqueue()
+			s.mu.Unlock()
+			s.process()
+			return
+		}
+		s.process()
+	}
+}
+
+// process sends the queued batches, then the spooled ones
+func (s *HTTPSink) process() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			break
+		}
+		batch := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		s.deliver(batch)
+	}
+	s.drainSpool()
+}
+
+// deliver sends a batch, spooling or dropping it when the endpoint cannot be reached
+func (s *HTTPSink) deliver(batch [][]byte) {
+	if s.down && s.config.SpoolDir != "" {
+		s.spool(batch)
+		return
+	}
+	err := s.send(batch, true)
+	if err == nil {
+		s.down = false
+		return
+	}
+	var perm *permanentError
+	if errors.As(err, &perm) || s.config.SpoolDir == "" {
+		s.recordDropped(len(batch))
+		if !errors.As(err, &perm) {
+			s.markDown()
+		}
+		return
+	}
+	s.markDown()
+	s.spool(batch)
+}
+
+// markDown records that the endpoint failed and schedules the next probe with backoff
+func (s *HTTPSink) markDown() {
+	if !s.down {
+		s.down, s.probeAttempt = true, 0
+	}
+	s.nextProbe = time.Now().Add(backoffDelay(s.probeAttempt, s.config.MinBackoff, s.config.MaxBackoff))
+	s.probeAttempt++
+}
+
+// permanentError is a request failure that retrying cannot fix, such as a 400 response
+type permanentError struct {
+	status int
+}
+
+// Error implements the error interface
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("zlog: http sink request rejected with status %d", e.status)
+}
+
+// retryableError is a request failure worth retrying, optionally after a delay requested by the server
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+	hasRetry   bool // hasRetry is set when the server sent a valid Retry-After header
+}
+
+// Error implements the error interface
+func (e *retryableError) Error() string { return e.err.Error() }
+
+// send posts a batch, retrying retryable failures when retry is set and the sink is not closing
+func (s *HTTPSink) send(batch [][]byte, retry bool) error {
+	body, contentType, err := s.encode(batch)
+	if err != nil {
+		return &permanentError{}
+	}
+	for attempt := 0; ; attempt++ {
+		err := s.post(body, contentType, len(batch))
+		if err == nil {
+			return nil
+		}
+		var rerr *retryableError
+		if !errors.As(err, &rerr) || !retry || attempt >= s.config.MaxRetries {
+			return err
+		}
+		wait := rerr.retryAfter
+		if !rerr.hasRetry {
+			wait = backoffDelay(attempt, s.config.MinBackoff, s.config.MaxBackoff)
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.done:
+			return err
+		}
+	}
+}
+
+// post performs a single request
+func (s *HTTPSink) post(body []byte, contentType string, events int) error {
+	var reader io.Reader = bytes.NewReader(body)
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		reader = &buf
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.config.URL, reader)
+	if err != nil {
+		return &permanentError{}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, megabyte))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if s.config.Format == HTTPFormatElasticsearch {
+			s.recordDropped(bulkFailures(data))
+		}
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"))
+		return &retryableError{
+			err:        fmt.Errorf("zlog: http sink request failed with status %d", resp.StatusCode),
+			retryAfter: retryAfter,
+			hasRetry:   ok,
+		}
+	}
+	return &permanentError{status: resp.StatusCode}
+}
+
+// encode renders a batch in the request format
+func (s *HTTPSink) encode(batch [][]byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch s.config.Format {
+	case HTTPFormatLoki:
+		body, err := s.encodeLoki(batch)
+		return body, "application/json", err
+	case HTTPFormatElasticsearch:
+		action, err := json.Marshal(map[string]map[string]string{"index": {"_index": s.config.Index}})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, line := range batch {
+			buf.Write(action)
+			buf.WriteByte('\n')
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	default:
+		for _, line := range batch {
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// lokiStream is a stream of the Loki push API
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeLoki groups a batch into Loki streams by the labels of its events
+func (s *HTTPSink) encodeLoki(batch [][]byte) ([]byte, error) {
+	streams := map[string]*lokiStream{}
+	var order []string
+	for _, line := range batch {
+		e := decodeEvent(line)
+		labels := make(map[string]string, len(s.config.Labels)+len(s.config.LabelFields))
+		for k, v := range s.config.Labels {
+			labels[k] = v
+		}
+		for _, field := range s.config.LabelFields {
+			if field == zerolog.LevelFieldName && e.Level != zerolog.NoLevel {
+				labels[field] = e.Level.String()
+			} else if v, ok := e.Fields[field]; ok {
+				labels[field] = fieldString(v)
+			}
+		}
+		key := labelKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), string(line)})
+	}
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		push.Streams = append(push.Streams, streams[key])
+	}
+	return json.Marshal(push)
+}
+
+// labelKey returns a canonical representation of a label set
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
+
+// bulkFailures returns the number of items an Elasticsearch bulk response reports as failed
+func bulkFailures(data []byte) int {
+	var resp struct {
+		Errors bool                              `json:"errors"`
+		Items  []map[string]struct{ Status int } `json:"items"`
+	}
+	if json.Unmarshal(data, &resp) != nil || !resp.Errors {
+		return 0
+	}
+	failed := 0
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 300 {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// backoffDelay returns the delay before retry attempt, doubling from base up to limit with jitter
+func backoffDelay(attempt int, base, limit time.Duration) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	// Jitter in the upper half keeps retries of many processes apart
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// spool writes a batch to the on-disk queue, dropping the oldest batches beyond SpoolMaxSize
+func (s *HTTPSink) spool(batch [][]byte) {
+	path := filepath.Join(s.config.SpoolDir, fmt.Sprintf("%s%020d%s", spoolPrefix, s.spoolSeq.Add(1), spoolSuffix))
+	data := append(bytes.Join(batch, []byte("\n")), '\n')
+	tmp := path + partialSuffix
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		s.recordDropped(len(batch))
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		s.recordDropped(len(batch))
+		return
+	}
+
+	files := s.spooled()
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files)-1 && total > int64(s.config.SpoolMaxSize)*megabyte; i++ {
+		if data, err := os.ReadFile(files[i]); err == nil {
+			s.recordDropped(bytes.Count(data, []byte("\n")))
+		}
+		_ = os.Remove(files[i])
+		total -= sizes[i]
+	}
+}
+
+// spooled returns the spooled batch files, oldest first
+func (s *HTTPSink) spooled() []string {
+	entries, err := os.ReadDir(s.config.SpoolDir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), spoolPrefix) && strings.HasSuffix(e.Name(), spoolSuffix) {
+			files = append(files, filepath.Join(s.config.SpoolDir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// drainSpool sends the spooled batches oldest first, stopping at the first failure.
+// While the endpoint is down it only probes once the backoff has elapsed.
+func (s *HTTPSink) drainSpool() {
+	if s.config.SpoolDir == "" || (s.down && time.Now().Before(s.nextProbe)) {
+		return
+	}
+	for _, file := range s.spooled() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		batch := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+		err = s.send(batch, false)
+		var perm *permanentError
+		if err != nil && !errors.As(err, &perm) {
+			s.markDown()
+			return
+		}
+		if err != nil {
+			s.recordDropped(len(batch))
+		}
+		s.down = false
+		_ = os.Remove(file)
+	}
+}
+
+// recordDropped counts n events that will never reach the endpoint
+func (s *HTTPSink) recordDropped(n int) {
+	if n <= 0 {
+		return
+	}
+	s.dropped.Add(uint64(n))
+	if m := s.metrics.Load(); m != nil {
+		for i := 0; i < n; i++ {
+			m.recordDropped()
+		}
+	}
+}
+
+// setMetrics attaches a recorder counting dropped events
+func (s *HTTPSink) setMetrics(m *metricsRecorder) {
+	s.metrics.Store(m)
+}
+
+// Dropped returns the number of events dropped because they were rejected or could not be queued or spooled
+func (s *HTTPSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// SinkName returns the name statistics are reported under
+func (s *HTTPSink) SinkName() string {
+	return "http"
+}
+
+// structured marks HTTPSink as decoding JSON events
+func (s *HTTPSink) structured() {}
+
+// Flush blocks until every event written before the call has been sent, spooled or dropped
+func (s *HTTPSink) Flush() error {
+	ack := make(chan struct{})
+	select {
+	case s.flushReq <- ack:
+		<-ack
+	case <-s.stopped:
+	}
+	return nil
+}
+
+// Close sends the remaining events with a single attempt each, spooling those that fail, and stops the sink
+func (s *HTTPSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.done)
+	<-s.stopped
+	return nil
+}
@@ -0,0 +1,211 @@
+package zlog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is an HTTP endpoint recording the bodies it receives
+type collector struct {
+	mu      sync.Mutex
+	bodies  []string
+	headers []http.Header
+	status  atomic.Int32 // status is returned instead of 200 when set
+	server  *httptest.Server
+}
+
+// newCollector starts a collector
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := int(c.status.Load()); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+		c.mu.Lock()
+		c.bodies = append(c.bodies, string(data))
+		c.headers = append(c.headers, r.Header.Clone())
+		c.mu.Unlock()
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// received returns the bodies received so far
+func (c *collector) received() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.bodies...)
+}
+
+func TestHTTPSinkBatchesNDJSON(t *testing.T) {
+	c := newCollector(t)
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, BatchSize: 2, FlushInterval: time.Hour,
+		Headers: map[string]string{"Authorization": "Bearer token"}})
+	require.NoError(t, err)
+	logger := New(WithOutput(s))
+
+	logger.Info("one")
+	logger.Info("two")
+	logger.Info("three")
+	assert.Eventually(t, func() bool { return len(c.received()) == 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, logger.Flush())
+	bodies := c.received()
+	require.Len(t, bodies, 2)
+	assert.Equal(t, 2, strings.Count(bodies[0], "\n"))
+	assert.Contains(t, bodies[0], `"message":"one"`)
+	assert.Contains(t, bodies[1], `"message":"three"`)
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/x-ndjson", c.headers[0].Get("Content-Type"))
+	require.NoError(t, s.Close())
+}
+
+func TestHTTPSinkHidesNoticeKey(t *testing.T) {
+	c := newCollector(t)
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	logger := New(WithOutput(s))
+
+	logger.Notice("noted")
+	require.NoError(t, logger.Flush())
+	bodies := c.received()
+	require.Len(t, bodies, 1)
+	assert.Contains(t, bodies[0], `"message":"noted"`)
+	assert.NotContains(t, bodies[0], NoticeKey)
+	require.NoError(t, s.Close())
+}
+
+func TestHTTPSinkLokiGzip(t *testing.T) {
+	c := newCollector(t)
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, Format: HTTPFormatLoki, Gzip: true,
+		Labels: map[string]string{"app": "billing"}, LabelFields: []string{"level", "region"}})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Write([]byte(`{"level":"info","region":"eu","time":"2024-01-02T03:04:05Z","message":"a"}` + "\n"))
+	s.Write([]byte(`{"level":"error","region":"eu","message":"b"}` + "\n"))
+	s.Write([]byte(`{"level":"info","region":"eu","message":"c"}` + "\n"))
+	require.NoError(t, s.Flush())
+
+	bodies := c.received()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "gzip", c.headers[0].Get("Content-Encoding"))
+	var push struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &push))
+	require.Len(t, push.Streams, 2)
+	assert.Equal(t, map[string]string{"app": "billing", "level": "info", "region": "eu"}, push.Streams[0].Stream)
+	require.Len(t, push.Streams[0].Values, 2)
+	assert.Equal(t, "1704164645000000000", push.Streams[0].Values[0][0])
+	assert.Contains(t, push.Streams[0].Values[0][1], `"message":"a"`)
+	assert.Equal(t, "error", push.Streams[1].Stream["level"])
+}
+
+func TestHTTPSinkElasticsearchBulk(t *testing.T) {
+	c := newCollector(t)
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, Format: HTTPFormatElasticsearch, Index: "billing"})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Write([]byte(`{"message":"a"}`))
+	s.Write([]byte("not json\n"))
+	require.NoError(t, s.Flush())
+	bodies := c.received()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, `{"index":{"_index":"billing"}}`+"\n"+`{"message":"a"}`+"\n"+
+		`{"index":{"_index":"billing"}}`+"\n"+`{"message":"not json"}`+"\n", bodies[0])
+
+	assert.Equal(t, 1, bulkFailures([]byte(`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429}}]}`)))
+}
+
+func TestHTTPSinkRetriesHonorRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	// The backoff alone would take far longer than the test
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: server.URL, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Write([]byte(`{"message":"a"}`))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Zero(t, s.Dropped())
+}
+
+func TestHTTPSinkDropsRejectedBatches(t *testing.T) {
+	c := newCollector(t)
+	c.status.Store(http.StatusBadRequest)
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, SpoolDir: t.TempDir()})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Write([]byte(`{"message":"a"}`))
+	require.NoError(t, s.Flush())
+	assert.Equal(t, uint64(1), s.Dropped())
+	assert.Empty(t, s.spooled(), "a rejected batch is not retried later")
+}
+
+func TestHTTPSinkSpoolsWhileDown(t *testing.T) {
+	c := newCollector(t)
+	c.status.Store(http.StatusServiceUnavailable)
+	dir := t.TempDir()
+	s, err := NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, SpoolDir: dir, MaxRetries: -1, MinBackoff: time.Hour})
+	require.NoError(t, err)
+
+	s.Write([]byte(`{"message":"a"}`))
+	require.NoError(t, s.Flush())
+	s.Write([]byte(`{"message":"b"}`))
+	require.NoError(t, s.Close())
+	assert.Len(t, s.spooled(), 2)
+	assert.Empty(t, c.received())
+
+	// A new process sends the spooled batches once the endpoint is back
+	c.status.Store(0)
+	s, err = NewHTTPSink(HTTPSinkConfig{URL: c.server.URL, SpoolDir: dir})
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Flush())
+	assert.Equal(t, []string{`{"message":"a"}` + "\n", `{"message":"b"}` + "\n"}, c.received())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		d := backoffDelay(attempt, 100, 1000)
+		assert.GreaterOrEqual(t, d, max/2)
+		assert.LessOrEqual(t, d, max)
+	}
+	d, ok := parseRetryAfter("2")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, d)
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
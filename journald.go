@@ -0,0 +1,169 @@
+// Package zlog provides a systemd journal output speaking the native journal protocol
+package zlog
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultJournalSocket is the socket journald receives native protocol entries on
+	DefaultJournalSocket = "/run/systemd/journal/socket"
+	// maxJournalFieldName is the longest field name journald accepts
+	maxJournalFieldName = 64
+)
+
+// JournalConfig configures a JournalWriter
+type JournalConfig struct {
+	Socket     string            // Socket is the journal socket, DefaultJournalSocket by default
+	Identifier string            // Identifier is sent as SYSLOG_IDENTIFIER, the name of the executable by default
+	Fields     map[string]string // Fields are added to every entry, e.g. {"SERVICE_VERSION": "1.2.0"}
+}
+
+// JournalWriter sends events to systemd-journald over its native protocol. Event fields become
+// journal fields with upper case names, e.g. trace_id becomes TRACE_ID and can be searched with
+// `journalctl TRACE_ID=...`; the level becomes PRIORITY and the caller CODE_FILE and CODE_LINE.
+// Entries too large for a datagram are passed in a sealed memfd on Linux.
+type JournalWriter struct {
+	config JournalConfig
+	addr   *net.UnixAddr
+	fields []byte // fields holds the encoded constant fields of every entry
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournalWriter creates a JournalWriter for config and opens the journal socket
+func NewJournalWriter(config JournalConfig) (*JournalWriter, error) {
+	if config.Socket == "" {
+		config.Socket = DefaultJournalSocket
+	}
+	if config.Identifier == "" {
+		config.Identifier = filepath.Base(os.Args[0])
+	}
+	j := &JournalWriter{config: config, addr: &net.UnixAddr{Name: config.Socket, Net: "unixgram"}}
+	j.fields = appendJournalField(nil, "SYSLOG_IDENTIFIER", config.Identifier)
+	names := make([]string, 0, len(config.Fields))
+	for name := range config.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if key := journalFieldName(name); key != "" {
+			j.fields = appendJournalField(j.fields, key, config.Fields[name])
+		}
+	}
+	conn, err := net.DialUnix("unixgram", nil, j.addr)
+	if err != nil {
+		return nil, err
+	}
+	j.conn = conn
+	return j, nil
+}
+
+// Write implements the io.Writer interface. p is a JSON event of the logger; any other
+// output is sent as the MESSAGE of an entry with informational priority.
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	entry := j.encode(decodeEvent(p))
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return 0, ErrWriterClosed
+	}
+	_, err := j.conn.Write(entry)
+	if err != nil && isMessageTooLarge(err) {
+		err = sendJournalMemfd(j.conn, entry)
+	} else if err != nil {
+		// journald may have been restarted, invalidating the connected socket
+		if conn, derr := net.DialUnix("unixgram", nil, j.addr); derr == nil {
+			_ = j.conn.Close()
+			j.conn = conn
+			_, err = j.conn.Write(entry)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encode renders an event as a native protocol entry
+func (j *JournalWriter) encode(e logEvent) []byte {
+	b := appendJournalField(nil, "MESSAGE", e.Message)
+	b = appendJournalField(b, "PRIORITY", string(rune('0'+severityOf(e))))
+	b = append(b, j.fields...)
+	for _, k := range e.keys() {
+		value := fieldString(e.Fields[k])
+		if k == zerolog.CallerFieldName {
+			if i := strings.LastIndexByte(value, ':'); i > 0 {
+				b = appendJournalField(b, "CODE_FILE", value[:i])
+				b = appendJournalField(b, "CODE_LINE", value[i+1:])
+				continue
+			}
+		}
+		if name := journalFieldName(k); name != "" {
+			b = appendJournalField(b, name, value)
+		}
+	}
+	return b
+}
+
+// appendJournalField appends a field to an entry, using the binary form for values containing newlines
+func appendJournalField(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	if !strings.Contains(value, "\n") {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// journalFieldName turns an event field name into a valid journal field name: upper case
+// letters, digits and underscores, not starting with an underscore or a digit
+func journalFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "F_" + name
+	}
+	return truncate(name, maxJournalFieldName)
+}
+
+// SinkName returns the name statistics are reported under
+func (j *JournalWriter) SinkName() string {
+	return "journald"
+}
+
+// structured marks JournalWriter as decoding JSON events
+func (j *JournalWriter) structured() {}
+
+// Close closes the journal socket
+func (j *JournalWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
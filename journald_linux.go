@@ -0,0 +1,47 @@
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// isMessageTooLarge reports whether a datagram was rejected for its size
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, unix.EMSGSIZE) || errors.Is(err, unix.ENOBUFS)
+}
+
+// sendJournalMemfd passes entry to journald in a sealed memory file, as sd_journal_send does
+// for entries that do not fit in a datagram
+func sendJournalMemfd(conn *net.UnixConn, entry []byte) error {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return fmt.Errorf("failed to create journal memfd: %w", err)
+	}
+	defer unix.Close(fd)
+	for written := 0; written < len(entry); {
+		n, err := unix.Write(fd, entry[written:])
+		if err != nil {
+			return fmt.Errorf("failed to write journal memfd: %w", err)
+		}
+		written += n
+	}
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return fmt.Errorf("failed to seal journal memfd: %w", err)
+	}
+	// The socket is connected, which WriteMsgUnix refuses for datagrams, so sendmsg is called directly
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := raw.Write(func(s uintptr) bool {
+		serr = unix.Sendmsg(int(s), nil, unix.UnixRights(fd), nil, 0)
+		return serr != unix.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,131 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sys/unix"
+)
+
+// fakeJournal listens on a unix datagram socket like journald
+type fakeJournal struct {
+	conn *net.UnixConn
+	path string
+}
+
+// newFakeJournal listens on a socket in a temporary directory
+func newFakeJournal(t *testing.T) *fakeJournal {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &fakeJournal{conn: conn, path: path}
+}
+
+// receive reads the next entry, from the datagram or from a passed memfd, and parses its fields
+func (f *fakeJournal) receive(t *testing.T) map[string]string {
+	t.Helper()
+	buf := make([]byte, 1<<20)
+	oob := make([]byte, 1024)
+	require.NoError(t, f.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, oobn, _, _, err := f.conn.ReadMsgUnix(buf, oob)
+	require.NoError(t, err)
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		require.NoError(t, err)
+		fds, err := unix.ParseUnixRights(&msgs[0])
+		require.NoError(t, err)
+		file := os.NewFile(uintptr(fds[0]), "memfd")
+		defer file.Close()
+		// The file offset is shared with the sender, like journald read from the start
+		_, err = file.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		var content bytes.Buffer
+		_, err = content.ReadFrom(file)
+		require.NoError(t, err)
+		data = content.Bytes()
+	}
+	return parseJournalEntry(t, data)
+}
+
+// parseJournalEntry decodes the native journal protocol
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		line := bytes.IndexByte(data, '\n')
+		require.GreaterOrEqual(t, line, 0)
+		if eq := bytes.IndexByte(data[:line], '='); eq >= 0 {
+			fields[string(data[:eq])] = string(data[eq+1 : line])
+			data = data[line+1:]
+			continue
+		}
+		name := string(data[:line])
+		size := binary.LittleEndian.Uint64(data[line+1 : line+9])
+		fields[name] = string(data[line+9 : line+9+int(size)])
+		data = data[line+9+int(size)+1:]
+	}
+	return fields
+}
+
+func TestJournalWriterFields(t *testing.T) {
+	journal := newFakeJournal(t)
+	w, err := NewJournalWriter(JournalConfig{Socket: journal.path, Identifier: "billing", Fields: map[string]string{"service_version": "1.2.0"}})
+	require.NoError(t, err)
+	defer w.Close()
+	logger := New(WithOutput(w), WithCaller(CallerShortPath), WithStackTrace())
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	logger.CtxErrorf(ctx, "charge failed\nretrying")
+
+	entry := journal.receive(t)
+	assert.Equal(t, "charge failed\nretrying", entry["MESSAGE"])
+	assert.Equal(t, "3", entry["PRIORITY"])
+	assert.Equal(t, "billing", entry["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "1.2.0", entry["SERVICE_VERSION"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["TRACE_ID"])
+	assert.Equal(t, "00f067aa0ba902b7", entry["SPAN_ID"])
+	assert.True(t, strings.HasSuffix(entry["CODE_FILE"], "journald_linux_test.go"), entry["CODE_FILE"])
+	assert.NotEmpty(t, entry["CODE_LINE"])
+
+	logger.Notice("notice")
+	notice := journal.receive(t)
+	assert.Equal(t, "5", notice["PRIORITY"])
+	assert.NotContains(t, notice, "ZLOG_NOTICE")
+	logger.Debug("hidden")
+	logger.Info("info")
+	assert.Equal(t, "6", journal.receive(t)["PRIORITY"])
+}
+
+func TestJournalWriterLargeEntryUsesMemfd(t *testing.T) {
+	journal := newFakeJournal(t)
+	w, err := NewJournalWriter(JournalConfig{Socket: journal.path})
+	require.NoError(t, err)
+	defer w.Close()
+
+	message := strings.Repeat("x", 8<<20)
+	_, err = w.Write([]byte(`{"level":"info","message":"` + message + `"}`))
+	require.NoError(t, err)
+	assert.True(t, journal.receive(t)["MESSAGE"] == message, "the entry is passed in a memfd")
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert.Equal(t, "TRACE_ID", journalFieldName("trace_id"))
+	assert.Equal(t, "ERROR_MESSAGE", journalFieldName("error.message"))
+	assert.Equal(t, "PRIVATE", journalFieldName("_private"))
+	assert.Equal(t, "F_2XX", journalFieldName("2xx"))
+	assert.Len(t, journalFieldName(strings.Repeat("a", 100)), maxJournalFieldName)
+}
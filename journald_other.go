@@ -0,0 +1,18 @@
+//go:build !linux
+
+package zlog
+
+import (
+	"errors"
+	"net"
+)
+
+// isMessageTooLarge reports whether a datagram was rejected for its size; journald only exists on Linux
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+// sendJournalMemfd is not supported outside Linux
+func sendJournalMemfd(conn *net.UnixConn, entry []byte) error {
+	return errors.New("zlog: journal memfd is only supported on Linux")
+}
@@ -0,0 +1,262 @@
+// Package zlog provides lifecycle hooks and archiving for rotated log files
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RotateEvent describes a rotation of the log file
+type RotateEvent struct {
+	Filename string    // Filename is the active log file, which starts empty
+	Backup   string    // Backup is the path the previous content was renamed to
+	Size     int64     // Size is the size of the backup in bytes
+	Time     time.Time // Time is when the rotation happened
+}
+
+// CompressEvent describes the compression of a rotated file
+type CompressEvent struct {
+	Source         string    // Source is the uncompressed backup, removed on success
+	Archive        string    // Archive is the compressed file
+	Size           int64     // Size is the size of the source in bytes
+	CompressedSize int64     // CompressedSize is the size of the archive in bytes, 0 on failure
+	Time           time.Time // Time is when the compression finished
+	Err            error     // Err is the reason the compression failed, nil on success
+}
+
+// DeleteEvent describes the removal of a rotated file by retention
+type DeleteEvent struct {
+	Path   string    // Path is the removed backup
+	Size   int64     // Size is the size of the backup in bytes
+	Reason string    // Reason is the retention rule that removed the backup, e.g. RetentionMaxAge
+	Time   time.Time // Time is when the backup was removed
+	Err    error     // Err is the reason the removal failed, nil on success
+}
+
+// Archiver moves rotated files out of the log directory, e.g. to archival storage.
+// Archive is called from a background goroutine once a backup is final, that is
+// compressed when compression is configured; the file is expected to be gone on success.
+// On error the backup stays in place and is offered again by the next retention pass.
+type Archiver interface {
+	Archive(ctx context.Context, path string) error
+}
+
+// DirArchiver is an Archiver that moves rotated files, and their checksum files, into a local directory
+type DirArchiver struct {
+	Dir string
+}
+
+// NewDirArchiver creates an Archiver moving rotated files into dir, which is created when missing
+func NewDirArchiver(dir string) *DirArchiver {
+	return &DirArchiver{Dir: dir}
+}
+
+// Archive implements the Archiver interface
+func (a *DirArchiver) Archive(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	if _, err := os.Stat(path + checksumSuffix); err == nil {
+		if err := moveFile(path+checksumSuffix, filepath.Join(a.Dir, filepath.Base(path)+checksumSuffix)); err != nil {
+			return err
+		}
+	}
+	return moveFile(path, filepath.Join(a.Dir, filepath.Base(path)))
+}
+
+// moveFile renames src to dst, copying the content when they are on different filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to archive log backup: %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+partialSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to archive log backup: %w", err)
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(dst+partialSuffix, dst)
+	}
+	if err != nil {
+		os.Remove(dst + partialSuffix)
+		return fmt.Errorf("failed to archive log backup: %w", err)
+	}
+	return os.Remove(src)
+}
+
+// hasLifecycleHooks reports whether any lifecycle hook or archiver is configured
+func (c *RotateConfig) hasLifecycleHooks() bool {
+	return c.OnRotate != nil || c.OnCompress != nil || c.OnDelete != nil || c.OnHookError != nil || c.Archiver != nil
+}
+
+// lifecycle runs the hooks of a RotateConfig in order on a background goroutine,
+// so slow hooks never hold up writes or retention
+type lifecycle struct {
+	config *RotateConfig
+
+	mu      sync.Mutex
+	pending []func()
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+// newLifecycle creates a dispatcher for the hooks of config and starts its goroutine
+func newLifecycle(config *RotateConfig) *lifecycle {
+	l := &lifecycle{config: config, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+// run invokes queued hooks until the dispatcher is closed and drained
+func (l *lifecycle) run() {
+	defer close(l.done)
+	for range l.wake {
+		for {
+			l.mu.Lock()
+			batch, closed := l.pending, l.closed
+			l.pending = nil
+			l.mu.Unlock()
+			if len(batch) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			for _, fn := range batch {
+				fn()
+			}
+		}
+	}
+}
+
+// enqueue schedules fn; once the dispatcher is closed fn runs on the calling goroutine
+func (l *lifecycle) enqueue(fn func()) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		fn()
+		return
+	}
+	l.pending = append(l.pending, fn)
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close runs the hooks still queued and stops the goroutine
+func (l *lifecycle) close() {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	<-l.done
+}
+
+// call invokes a hook, reporting a panic as an error
+func (l *lifecycle) call(name string, fn func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			l.reportError(fmt.Errorf("zlog: %s hook panicked: %v", name, v))
+		}
+	}()
+	fn()
+}
+
+// rotated dispatches a RotateEvent to OnRotate
+func (l *lifecycle) rotated(e RotateEvent) {
+	if l == nil || l.config.OnRotate == nil {
+		return
+	}
+	l.enqueue(func() { l.call("OnRotate", func() { l.config.OnRotate(e) }) })
+}
+
+// compressed dispatches a CompressEvent to OnCompress
+func (l *lifecycle) compressed(e CompressEvent) {
+	if l == nil || l.config.OnCompress == nil {
+		return
+	}
+	l.enqueue(func() { l.call("OnCompress", func() { l.config.OnCompress(e) }) })
+}
+
+// deleted dispatches a DeleteEvent to OnDelete
+func (l *lifecycle) deleted(e DeleteEvent) {
+	if l == nil || l.config.OnDelete == nil {
+		return
+	}
+	l.enqueue(func() { l.call("OnDelete", func() { l.config.OnDelete(e) }) })
+}
+
+// reportError passes an error of a hook, the archiver or a background retention pass to OnHookError
+func (l *lifecycle) reportError(err error) {
+	if l == nil || err == nil || l.config.OnHookError == nil {
+		return
+	}
+	l.enqueue(func() {
+		defer func() { _ = recover() }()
+		l.config.OnHookError(err)
+	})
+}
+
+// WithOnRotate sets the hook called after every rotation of the log file
+func WithOnRotate(fn func(RotateEvent)) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.OnRotate = fn
+	}
+}
+
+// WithOnCompress sets the hook called after every compression of a rotated file
+func WithOnCompress(fn func(CompressEvent)) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.OnCompress = fn
+	}
+}
+
+// WithOnDelete sets the hook called after retention removes a rotated file
+func WithOnDelete(fn func(DeleteEvent)) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.OnDelete = fn
+	}
+}
+
+// WithOnHookError sets the callback receiving errors of hooks, the archiver and background retention passes
+func WithOnHookError(fn func(error)) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.OnHookError = fn
+	}
+}
+
+// WithArchiver sets the Archiver rotated files are handed to once final
+func WithArchiver(archiver Archiver) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.Archiver = archiver
+	}
+}
@@ -0,0 +1,155 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventLog collects lifecycle events delivered on the hook goroutine
+type eventLog struct {
+	mu         sync.Mutex
+	rotated    []RotateEvent
+	compressed []CompressEvent
+	deleted    []DeleteEvent
+	errs       []error
+}
+
+func (l *eventLog) options() []RotateConfigOption {
+	return []RotateConfigOption{
+		WithOnRotate(func(e RotateEvent) { l.mu.Lock(); l.rotated = append(l.rotated, e); l.mu.Unlock() }),
+		WithOnCompress(func(e CompressEvent) { l.mu.Lock(); l.compressed = append(l.compressed, e); l.mu.Unlock() }),
+		WithOnDelete(func(e DeleteEvent) { l.mu.Lock(); l.deleted = append(l.deleted, e); l.mu.Unlock() }),
+		WithOnHookError(func(err error) { l.mu.Lock(); l.errs = append(l.errs, err); l.mu.Unlock() }),
+	}
+}
+
+func TestOnRotateManual(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	var events eventLog
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, events.options()...))
+	logger.Info("before rotation")
+	require.NoError(t, logger.Rotate())
+	require.NoError(t, logger.Close())
+
+	require.Len(t, events.rotated, 1)
+	e := events.rotated[0]
+	assert.Equal(t, filename, e.Filename)
+	assert.Equal(t, dir, filepath.Dir(e.Backup))
+	assert.NotEqual(t, filename, e.Backup)
+	assert.Greater(t, e.Size, int64(0))
+	assert.WithinDuration(t, time.Now(), e.Time, time.Minute)
+	assert.Empty(t, events.errs)
+}
+
+func TestOnRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	var events eventLog
+	config := GetDefaultRotateConfig(filename, append(events.options(), WithMaxSize(1), WithCompress(false))...)
+	w := NewFileWriter(config)
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 2; i++ {
+		_, err := w.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	require.Len(t, events.rotated, 1)
+	assert.Equal(t, int64(len(chunk)), events.rotated[0].Size)
+	assert.FileExists(t, events.rotated[0].Backup)
+}
+
+func TestLifecycleCompressDeleteArchive(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(t.TempDir(), "archive")
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	newest := writeBackup(t, filename, now.Add(-time.Hour), 100, false)
+	oldest := writeBackup(t, filename, now.Add(-2*time.Hour), 100, false)
+
+	var events eventLog
+	config := GetDefaultRotateConfig(filename, append(events.options(),
+		WithMaxBackups(1),
+		WithCompression(Compression{Algorithm: CompressionGzip, Checksum: true}),
+		WithArchiver(NewDirArchiver(archiveDir)))...)
+	logger := NewRotatingLogger(config)
+	report, err := logger.ApplyRetention()
+	require.NoError(t, err)
+	require.NoError(t, logger.Close())
+
+	require.Len(t, report.Archived, 1)
+	assert.Equal(t, newest+gzipSuffix, report.Archived[0].Path)
+
+	require.Len(t, events.deleted, 1)
+	assert.Equal(t, oldest, events.deleted[0].Path)
+	assert.Equal(t, RetentionMaxBackups, events.deleted[0].Reason)
+	assert.NoError(t, events.deleted[0].Err)
+
+	require.Len(t, events.compressed, 1)
+	c := events.compressed[0]
+	assert.Equal(t, newest, c.Source)
+	assert.Equal(t, newest+gzipSuffix, c.Archive)
+	assert.Equal(t, int64(100), c.Size)
+	assert.Greater(t, c.CompressedSize, int64(0))
+	assert.NoError(t, c.Err)
+
+	base := filepath.Base(newest) + gzipSuffix
+	assert.Equal(t, []string{base, base + checksumSuffix}, listDir(t, archiveDir))
+	assert.NoFileExists(t, newest+gzipSuffix)
+}
+
+// failingArchiver rejects every file
+type failingArchiver struct{}
+
+func (failingArchiver) Archive(context.Context, string) error {
+	return errors.New("storage unavailable")
+}
+
+func TestArchiverErrorKeepsBackup(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	backup := writeBackup(t, filename, time.Now().Add(-time.Hour), 100, true)
+
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithArchiver(failingArchiver{})))
+	defer logger.Close()
+	_, err := logger.ApplyRetention()
+	assert.ErrorContains(t, err, "storage unavailable")
+	assert.FileExists(t, backup)
+}
+
+func TestHookPanicIsReported(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var errs []error
+	config := GetDefaultRotateConfig(filepath.Join(dir, "app.log"),
+		WithOnRotate(func(RotateEvent) { panic("boom") }),
+		WithOnHookError(func(err error) { mu.Lock(); errs = append(errs, err); mu.Unlock() }))
+	logger := NewRotatingLogger(config)
+	logger.Info("before rotation")
+	require.NoError(t, logger.Rotate())
+	require.NoError(t, logger.Close())
+
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "OnRotate hook panicked: boom")
+}
+
+func TestMoveFileAcrossDirectories(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "a.log")
+	dst := filepath.Join(t.TempDir(), "b.log")
+	require.NoError(t, os.WriteFile(src, []byte("content"), 0644))
+	require.NoError(t, moveFile(src, dst))
+	assert.NoFileExists(t, src)
+	got, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(got))
+}
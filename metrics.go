@@ -0,0 +1,564 @@
+// Package zlog provides self-instrumentation of the logging pipeline
+package zlog
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// instrumentationName is the name of the OpenTelemetry meter used by zlog
+const instrumentationName = "github.com/v-mars/zlog"
+
+// DefaultOutputSinkName is the sink name reported for outputs that carry no name of their own
+const DefaultOutputSinkName = "output"
+
+// writeLatencyBounds are the upper bounds of the in-process write latency histogram buckets
+var writeLatencyBounds = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// Stats is a point-in-time snapshot of the telemetry a logger records about itself
+type Stats struct {
+	Events map[string]uint64 // Events counts the log events emitted, keyed by level name
+	// Loggers counts the events of the loggers named with WithName or Named, keyed by logger
+	// name then level name; Events also counts them
+	Loggers   map[string]map[string]uint64
+	Sinks     map[string]SinkStats // Sinks holds write statistics keyed by sink name
+	Dropped   uint64               // Dropped counts events lost because the output rejected them
+	Sampled   uint64               // Sampled counts events discarded by the sampler
+	Rotations uint64               // Rotations counts log file rotations
+	Files     map[string]int64     // Files holds the current size in bytes of each rotating log file
+	// QueueDepth and QueueCapacity describe the async queues feeding the outputs
+	QueueDepth    int
+	QueueCapacity int
+}
+
+// SinkStats holds write statistics for a single sink
+type SinkStats struct {
+	Bytes   uint64           // Bytes is the number of bytes written successfully
+	Writes  uint64           // Writes is the number of write calls
+	Errors  uint64           // Errors is the number of failed write calls
+	Latency LatencyHistogram // Latency is the distribution of write call durations
+}
+
+// LatencyHistogram is a non-cumulative bucketed histogram of durations
+type LatencyHistogram struct {
+	Bounds []time.Duration // Bounds are the inclusive upper bounds of each bucket
+	Counts []uint64        // Counts has len(Bounds)+1 entries, the last one counting overflows
+	Sum    time.Duration   // Sum is the total of all observed durations
+	Count  uint64          // Count is the number of observations
+}
+
+// TotalEvents returns the number of events emitted across all levels
+func (s Stats) TotalEvents() uint64 {
+	var total uint64
+	for _, n := range s.Events {
+		total += n
+	}
+	return total
+}
+
+// SinkNames returns the names of all sinks in the snapshot, sorted
+func (s Stats) SinkNames() []string {
+	names := make([]string, 0, len(s.Sinks))
+	for name := range s.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithMetrics enables self-instrumentation of the logger.
+// Counters are always kept in-process and readable through Stats; when mp is not nil
+// they are also exported as OpenTelemetry instruments.
+func WithMetrics(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.metrics = newMetricsRecorder(mp)
+	}
+}
+
+// WithSampler sets a zerolog sampler; events it discards are counted in Stats.Sampled
+func WithSampler(sampler zerolog.Sampler) Option {
+	return func(c *config) {
+		c.sampler = sampler
+	}
+}
+
+// metricsRecorder collects zlog's own telemetry
+type metricsRecorder struct {
+	events    levelCounters
+	dropped   atomic.Uint64
+	sampled   atomic.Uint64
+	rotations atomic.Uint64
+
+	mu      sync.Mutex
+	loggers map[string]*levelCounters // loggers counts the events of each named logger
+	sinks   map[string]*sinkCounters
+	files   map[string]struct{}
+	queues  []*AsyncWriter
+
+	instruments *otelInstruments
+}
+
+// levelCounters count events indexed by zerolog level + 1
+type levelCounters [8]atomic.Uint64
+
+// snapshot returns the counts of the levels with events, keyed by level name
+func (c *levelCounters) snapshot() map[string]uint64 {
+	counts := make(map[string]uint64)
+	for i := range c {
+		if n := c[i].Load(); n > 0 {
+			counts[zerolog.Level(i-1).String()] = n
+		}
+	}
+	return counts
+}
+
+// sinkCounters are the live counters of a single sink
+type sinkCounters struct {
+	bytes   atomic.Uint64
+	writes  atomic.Uint64
+	errors  atomic.Uint64
+	sum     atomic.Int64
+	buckets []atomic.Uint64
+}
+
+// otelInstruments are the OpenTelemetry instruments mirroring the in-process counters
+type otelInstruments struct {
+	events    metric.Int64Counter
+	bytes     metric.Int64Counter
+	errors    metric.Int64Counter
+	latency   metric.Float64Histogram
+	dropped   metric.Int64Counter
+	sampled   metric.Int64Counter
+	rotations metric.Int64Counter
+	queue     metric.Int64ObservableGauge
+}
+
+// newMetricsRecorder creates a recorder, registering OpenTelemetry instruments when mp is not nil
+func newMetricsRecorder(mp metric.MeterProvider) *metricsRecorder {
+	r := &metricsRecorder{loggers: make(map[string]*levelCounters), sinks: make(map[string]*sinkCounters), files: make(map[string]struct{})}
+	if mp != nil {
+		meter := mp.Meter(instrumentationName)
+		r.instruments = newOtelInstruments(meter)
+		if r.instruments.queue != nil {
+			_, _ = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+				depth, _ := r.queueDepth()
+				o.ObserveInt64(r.instruments.queue, int64(depth))
+				return nil
+			}, r.instruments.queue)
+		}
+	}
+	return r
+}
+
+// newOtelInstruments creates zlog's instruments; instruments that fail to register are left nil
+func newOtelInstruments(meter metric.Meter) *otelInstruments {
+	in := &otelInstruments{}
+	in.events, _ = meter.Int64Counter("zlog.events",
+		metric.WithDescription("Number of log events emitted"), metric.WithUnit("{event}"))
+	in.bytes, _ = meter.Int64Counter("zlog.sink.bytes",
+		metric.WithDescription("Number of bytes written to a sink"), metric.WithUnit("By"))
+	in.errors, _ = meter.Int64Counter("zlog.sink.errors",
+		metric.WithDescription("Number of failed writes to a sink"), metric.WithUnit("{error}"))
+	in.latency, _ = meter.Float64Histogram("zlog.sink.write.duration",
+		metric.WithDescription("Duration of writes to a sink"), metric.WithUnit("s"))
+	in.dropped, _ = meter.Int64Counter("zlog.events.dropped",
+		metric.WithDescription("Number of log events lost before reaching a sink"), metric.WithUnit("{event}"))
+	in.sampled, _ = meter.Int64Counter("zlog.events.sampled",
+		metric.WithDescription("Number of log events discarded by sampling"), metric.WithUnit("{event}"))
+	in.rotations, _ = meter.Int64Counter("zlog.rotations",
+		metric.WithDescription("Number of log file rotations"), metric.WithUnit("{rotation}"))
+	in.queue, _ = meter.Int64ObservableGauge("zlog.async.queue.depth",
+		metric.WithDescription("Number of log events waiting in async queues"), metric.WithUnit("{event}"))
+	return in
+}
+
+// eventCounter is the hook counting the events of the logger named name
+type eventCounter struct {
+	metrics *metricsRecorder
+	name    string
+	counts  *levelCounters // counts are the counters of the name, nil for unnamed loggers
+}
+
+// eventHook returns the hook counting the events emitted by the logger named name
+func (r *metricsRecorder) eventHook(name string) *eventCounter {
+	return &eventCounter{metrics: r, name: name, counts: r.loggerCounters(name)}
+}
+
+// Run implements the zerolog.Hook interface, counting every emitted event
+func (h *eventCounter) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	h.metrics.countEvent(level, h.name, h.counts)
+}
+
+// loggerCounters returns the event counters of the logger named name, nil for unnamed loggers
+func (r *metricsRecorder) loggerCounters(name string) *levelCounters {
+	if name == "" {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.loggers[name]
+	if !ok {
+		c = &levelCounters{}
+		r.loggers[name] = c
+	}
+	return c
+}
+
+// recordEvent counts an emitted event at level of the logger named name
+func (r *metricsRecorder) recordEvent(level zerolog.Level, name string) {
+	r.countEvent(level, name, r.loggerCounters(name))
+}
+
+// countEvent counts an emitted event at level in the totals and in counts, the counters of name
+func (r *metricsRecorder) countEvent(level zerolog.Level, name string, counts *levelCounters) {
+	idx := int(level) + 1
+	if idx < 0 || idx >= len(r.events) {
+		return
+	}
+	r.events[idx].Add(1)
+	if counts != nil {
+		counts[idx].Add(1)
+	}
+	if r.instruments != nil && r.instruments.events != nil {
+		attrs := []attribute.KeyValue{attribute.String("level", level.String())}
+		if name != "" {
+			attrs = append(attrs, attribute.String(LoggerNameKey, name))
+		}
+		r.instruments.events.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	}
+}
+
+// recordDropped counts an event that never reached its sinks
+func (r *metricsRecorder) recordDropped() {
+	r.dropped.Add(1)
+	if r.instruments != nil && r.instruments.dropped != nil {
+		r.instruments.dropped.Add(context.Background(), 1)
+	}
+}
+
+// recordSampled counts an event discarded by the sampler
+func (r *metricsRecorder) recordSampled(level zerolog.Level) {
+	r.sampled.Add(1)
+	if r.instruments != nil && r.instruments.sampled != nil {
+		r.instruments.sampled.Add(context.Background(), 1,
+			metric.WithAttributes(attribute.String("level", level.String())))
+	}
+}
+
+// recordRotation counts a rotation of the given file
+func (r *metricsRecorder) recordRotation(filename string) {
+	r.rotations.Add(1)
+	if r.instruments != nil && r.instruments.rotations != nil {
+		r.instruments.rotations.Add(context.Background(), 1,
+			metric.WithAttributes(attribute.String("file", filename)))
+	}
+}
+
+// recordWrite records the outcome of a single write to the named sink
+func (r *metricsRecorder) recordWrite(sink string, n int, elapsed time.Duration, err error) {
+	c := r.sinkCounters(sink)
+	c.writes.Add(1)
+	c.bytes.Add(uint64(n))
+	c.sum.Add(int64(elapsed))
+	c.buckets[latencyBucket(elapsed)].Add(1)
+	if err != nil {
+		c.errors.Add(1)
+	}
+
+	if r.instruments == nil {
+		return
+	}
+	ctx := context.Background()
+	attrs := metric.WithAttributes(attribute.String("sink", sink))
+	if r.instruments.bytes != nil && n > 0 {
+		r.instruments.bytes.Add(ctx, int64(n), attrs)
+	}
+	if r.instruments.latency != nil {
+		r.instruments.latency.Record(ctx, elapsed.Seconds(), attrs)
+	}
+	if r.instruments.errors != nil && err != nil {
+		r.instruments.errors.Add(ctx, 1, attrs)
+	}
+}
+
+// sinkCounters returns the counters of the named sink, creating them on first use
+func (r *metricsRecorder) sinkCounters(sink string) *sinkCounters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.sinks[sink]
+	if !ok {
+		c = &sinkCounters{buckets: make([]atomic.Uint64, len(writeLatencyBounds)+1)}
+		r.sinks[sink] = c
+	}
+	return c
+}
+
+// addFile registers a rotating log file whose size is reported in Stats
+func (r *metricsRecorder) addFile(filename string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[filename] = struct{}{}
+}
+
+// addQueue registers an async queue whose depth is reported in Stats
+func (r *metricsRecorder) addQueue(a *AsyncWriter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, q := range r.queues {
+		if q == a {
+			return
+		}
+	}
+	r.queues = append(r.queues, a)
+}
+
+// queueDepth returns the summed depth and capacity of all registered async queues
+func (r *metricsRecorder) queueDepth() (depth, capacity int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, q := range r.queues {
+		depth += q.QueueDepth()
+		capacity += q.QueueCapacity()
+	}
+	return depth, capacity
+}
+
+// latencyBucket returns the histogram bucket index for d
+func latencyBucket(d time.Duration) int {
+	for i, bound := range writeLatencyBounds {
+		if d <= bound {
+			return i
+		}
+	}
+	return len(writeLatencyBounds)
+}
+
+// snapshot returns the current values of all counters
+func (r *metricsRecorder) snapshot() Stats {
+	s := Stats{
+		Events:    r.events.snapshot(),
+		Loggers:   make(map[string]map[string]uint64),
+		Sinks:     make(map[string]SinkStats),
+		Dropped:   r.dropped.Load(),
+		Sampled:   r.sampled.Load(),
+		Rotations: r.rotations.Load(),
+		Files:     make(map[string]int64),
+	}
+	s.QueueDepth, s.QueueCapacity = r.queueDepth()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, c := range r.loggers {
+		if events := c.snapshot(); len(events) > 0 {
+			s.Loggers[name] = events
+		}
+	}
+	for name, c := range r.sinks {
+		h := LatencyHistogram{
+			Bounds: append([]time.Duration(nil), writeLatencyBounds...),
+			Counts: make([]uint64, len(c.buckets)),
+			Sum:    time.Duration(c.sum.Load()),
+		}
+		for i := range c.buckets {
+			h.Counts[i] = c.buckets[i].Load()
+			h.Count += h.Counts[i]
+		}
+		s.Sinks[name] = SinkStats{
+			Bytes:   c.bytes.Load(),
+			Writes:  c.writes.Load(),
+			Errors:  c.errors.Load(),
+			Latency: h,
+		}
+	}
+	for filename := range r.files {
+		s.Files[filename] = fileSize(filename)
+	}
+	return s
+}
+
+// fileSize returns the size of filename, or 0 when it cannot be determined
+func fileSize(filename string) int64 {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// sampler wraps s so that discarded events are counted
+func (r *metricsRecorder) sampler(s zerolog.Sampler) zerolog.Sampler {
+	return &countingSampler{Sampler: s, metrics: r}
+}
+
+// countingSampler counts the events its wrapped sampler discards
+type countingSampler struct {
+	zerolog.Sampler
+	metrics *metricsRecorder
+}
+
+// Sample implements the zerolog.Sampler interface
+func (s *countingSampler) Sample(lvl zerolog.Level) bool {
+	if s.Sampler.Sample(lvl) {
+		return true
+	}
+	s.metrics.recordSampled(lvl)
+	return false
+}
+
+// instrument wraps the output so that every sink reachable through it reports its writes.
+// Write failures of the output as a whole are counted as dropped events.
+func (r *metricsRecorder) instrument(w io.Writer) io.Writer {
+	return &droppedCounter{Writer: r.instrumentSink(w, DefaultOutputSinkName), metrics: r}
+}
+
+// instrumentSink wraps a single sink, descending into writers that fan out to several sinks
+func (r *metricsRecorder) instrumentSink(w io.Writer, name string) io.Writer {
+	switch s := w.(type) {
+	case *multiSink:
+		writers := make([]io.Writer, len(s.writers))
+		for i, child := range s.writers {
+			writers[i] = r.instrumentSink(child, sinkName(child, name))
+		}
+		return newMultiSink(writers...)
+	case *FileWriter:
+		s.setMetrics(r)
+		r.addFile(s.filename)
+	case *AsyncWriter:
+		// The queue itself is not a sink; only its drops and depth are recorded
+		s.setMetrics(r)
+		r.addQueue(s)
+		return s
+	case *router:
+		s.instrument(r)
+		return s
+	case *SyslogWriter:
+		s.setMetrics(r)
+	case *HTTPSink:
+		s.setMetrics(r)
+	case *PublisherSink:
+		s.setMetrics(r)
+	case *zerolog.ConsoleWriter:
+		s.Out = r.instrumentSink(s.Out, name)
+		return s
+	case *noticeWriter:
+		s.Writer = r.instrumentSink(s.Writer, name)
+		return s
+	case *DurableWriter:
+		// Its output was instrumented before the writer started replaying into it
+		return s
+	case *failoverWriter:
+		s.metrics = r
+		s.primary = r.instrumentSink(s.primary, s.primaryName)
+		if s.fallback != nil {
+			s.fallback = r.instrumentSink(s.fallback, s.fallbackName)
+		}
+		return s
+	}
+	return &meteredWriter{name: sinkName(w, name), Writer: w, metrics: r}
+}
+
+// sinkName returns the name w reports itself under, or fallback
+func sinkName(w io.Writer, fallback string) string {
+	if n, ok := w.(*noticeWriter); ok {
+		w = n.Writer
+	}
+	if n, ok := w.(interface{ SinkName() string }); ok {
+		return n.SinkName()
+	}
+	return fallback
+}
+
+// meteredWriter records the size, duration and outcome of every write
+type meteredWriter struct {
+	name string
+	io.Writer
+	metrics *metricsRecorder
+}
+
+// Write implements the io.Writer interface
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := m.Writer.Write(p)
+	m.metrics.recordWrite(m.name, n, time.Since(start), err)
+	return n, err
+}
+
+// Flush flushes the wrapped writer, if it buffers
+func (m *meteredWriter) Flush() error {
+	return flushWriter(m.Writer)
+}
+
+// Close closes the wrapped writer, so that zerolog's Fatal can drain it before exiting
+func (m *meteredWriter) Close() error {
+	return closeWriter(m.Writer)
+}
+
+// droppedCounter counts writes that failed as dropped events
+type droppedCounter struct {
+	io.Writer
+	metrics *metricsRecorder
+}
+
+// Write implements the io.Writer interface
+func (d *droppedCounter) Write(p []byte) (int, error) {
+	n, err := d.Writer.Write(p)
+	if err != nil {
+		d.metrics.recordDropped()
+	}
+	return n, err
+}
+
+// Flush flushes the wrapped writer, if it buffers
+func (d *droppedCounter) Flush() error {
+	return flushWriter(d.Writer)
+}
+
+// Close closes the wrapped writer, so that zerolog's Fatal can drain it before exiting
+func (d *droppedCounter) Close() error {
+	return closeWriter(d.Writer)
+}
+
+// flushWriter flushes w if it implements Flush
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// closeWriter closes w if it implements io.Closer
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the logger's own telemetry.
+// It is empty unless the logger was created with WithMetrics.
+func (zl *ZLogger) Stats() Stats {
+	if zl.state.metrics == nil {
+		return Stats{Events: map[string]uint64{}, Loggers: map[string]map[string]uint64{}, Sinks: map[string]SinkStats{}, Files: map[string]int64{}}
+	}
+	return zl.state.metrics.snapshot()
+}
@@ -0,0 +1,195 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestStatsCountsEventsAndBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat), WithLevel(hertzlog.LevelDebug), WithMetrics(nil))
+
+	logger.Debug("one")
+	logger.Info("two")
+	logger.Infof("three %d", 3)
+	logger.Error("four")
+	logger.Trace("filtered by level")
+
+	stats := logger.Stats()
+	assert.Equal(t, uint64(1), stats.Events["debug"])
+	assert.Equal(t, uint64(2), stats.Events["info"])
+	assert.Equal(t, uint64(1), stats.Events["error"])
+	assert.Equal(t, uint64(4), stats.TotalEvents())
+
+	sink := stats.Sinks[DefaultOutputSinkName]
+	assert.Equal(t, uint64(4), sink.Writes)
+	assert.Equal(t, uint64(buf.Len()), sink.Bytes)
+	assert.Equal(t, uint64(4), sink.Latency.Count)
+	assert.Len(t, sink.Latency.Counts, len(sink.Latency.Bounds)+1)
+}
+
+func TestStatsCountsEventsPerLoggerName(t *testing.T) {
+	logger := New(WithOutput(&bytes.Buffer{}), WithName("api"), WithMetrics(nil))
+	db := logger.Named("db")
+
+	logger.Info("request")
+	db.Info("query")
+	logger.Named("pool").Named("db").Warn("slow query")
+	New(WithOutput(&bytes.Buffer{}), WithMetrics(nil)).Info("unnamed")
+
+	stats := logger.Stats()
+	assert.Equal(t, map[string]map[string]uint64{
+		"api": {"info": 1},
+		"db":  {"info": 1, "warn": 1},
+	}, stats.Loggers)
+	assert.Equal(t, uint64(2), stats.Events["info"])
+	assert.Equal(t, uint64(1), stats.Events["warn"])
+}
+
+func TestStatsWriteErrorsAndDropped(t *testing.T) {
+	logger := New(WithOutput(NamedWriter("broken", failingWriter{})), WithMetrics(nil))
+
+	logger.Info("lost")
+	logger.Warn("lost too")
+
+	stats := logger.Stats()
+	assert.Equal(t, uint64(2), stats.Sinks["broken"].Errors)
+	assert.Equal(t, uint64(2), stats.Dropped)
+}
+
+func TestAsyncWithMetricsClosesThroughWrappers(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithAsync(16), WithMetrics(nil))
+	logger.Info("queued")
+	logger.Warn("queued too")
+
+	// zerolog's Fatal closes the writer of the logger before exiting
+	closer, ok := logger.core().chain.out.(io.Closer)
+	require.True(t, ok, "the metrics wrapper hides Close")
+	require.NoError(t, closer.Close())
+	assert.Equal(t, 2, strings.Count(string(out.Bytes()), "queued"))
+	assert.NoError(t, logger.Close())
+}
+
+func TestFatalDrainsAsyncWithMetrics(t *testing.T) {
+	if os.Getenv("ZLOG_FATAL_CHILD") == "1" {
+		logger := New(WithOutput(os.Stdout), WithFormat(JSONFormat), WithAsync(16), WithMetrics(nil))
+		logger.Info("before fatal")
+		logger.Fatal("fatal line")
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalDrainsAsyncWithMetrics$")
+	cmd.Env = append(os.Environ(), "ZLOG_FATAL_CHILD=1")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitCode())
+	assert.Contains(t, string(out), `"message":"before fatal"`)
+	assert.Contains(t, string(out), `"message":"fatal line"`)
+}
+
+func TestStatsSampled(t *testing.T) {
+	logger := New(WithOutput(&bytes.Buffer{}), WithMetrics(nil), WithSampler(&zerolog.BasicSampler{N: 2}))
+
+	for i := 0; i < 10; i++ {
+		logger.Info("sampled")
+	}
+
+	stats := logger.Stats()
+	assert.Equal(t, uint64(5), stats.Events["info"])
+	assert.Equal(t, uint64(5), stats.Sampled)
+}
+
+func TestStatsDisabled(t *testing.T) {
+	logger := New(WithOutput(&bytes.Buffer{}))
+	logger.Info("not counted")
+
+	stats := logger.Stats()
+	assert.Empty(t, stats.Events)
+	assert.Empty(t, stats.Sinks)
+}
+
+func TestRotatingLoggerStats(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithCompress(false)), WithMetrics(nil))
+
+	logger.Info("before rotation")
+	require.NoError(t, logger.Rotate())
+	logger.Info("after rotation")
+
+	stats := logger.Stats()
+	assert.Equal(t, uint64(1), stats.Rotations)
+	assert.Equal(t, uint64(2), stats.Sinks[filename].Writes)
+}
+
+func TestWithRotationReportsEachSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	buf := &bytes.Buffer{}
+	logger := New(
+		WithRotation(GetDefaultRotateConfig(filename, WithCompress(false)), NamedWriter("buffer", buf)),
+		WithMetrics(nil),
+	)
+
+	logger.Info("fan out")
+
+	stats := logger.Stats()
+	assert.ElementsMatch(t, []string{"buffer", filename}, stats.SinkNames())
+	assert.Equal(t, uint64(buf.Len()), stats.Sinks["buffer"].Bytes)
+	assert.Equal(t, uint64(buf.Len()), stats.Sinks[filename].Bytes)
+}
+
+func TestMetricsExportedThroughMeterProvider(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	logger := New(WithOutput(&bytes.Buffer{}), WithFormat(JSONFormat), WithMetrics(mp))
+
+	logger.Info("exported")
+	logger.Named("db").Error("exported")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, instrumentationName, rm.ScopeMetrics[0].Scope.Name)
+
+	byName := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	events, ok := byName["zlog.events"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	var total int64
+	for _, dp := range events.DataPoints {
+		total += dp.Value
+		name, named := dp.Attributes.Value(LoggerNameKey)
+		level, _ := dp.Attributes.Value("level")
+		assert.Equal(t, level.AsString() == "error", named, "only the named logger carries its name")
+		if named {
+			assert.Equal(t, "db", name.AsString())
+		}
+	}
+	assert.Equal(t, int64(2), total)
+
+	latency, ok := byName["zlog.sink.write.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, latency.DataPoints, 1)
+	assert.Equal(t, uint64(2), latency.DataPoints[0].Count)
+}
@@ -0,0 +1,262 @@
+// Package zlog provides the minimal MessagePack codec used by the Fluent Forward output
+package zlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// errShortMsgpack is returned when a MessagePack value is truncated
+var errShortMsgpack = errors.New("zlog: truncated msgpack value")
+
+// eventTime is a time encoded as the Fluent Forward EventTime extension
+type eventTime time.Time
+
+// appendMsgpack appends the MessagePack encoding of v. Maps are encoded with sorted keys;
+// values of unsupported types are encoded as their JSON text.
+func appendMsgpack(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpack(b, f)
+	case string:
+		return appendMsgpackString(b, v)
+	case []byte:
+		switch n := len(v); {
+		case n <= math.MaxUint8:
+			b = append(b, 0xc4, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+		}
+		return append(b, v...)
+	case eventTime:
+		t := time.Time(v)
+		b = append(b, 0xd7, 0x00)
+		b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+		return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	case []interface{}:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc, 0xdd)
+		for _, e := range v {
+			b = appendMsgpack(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde, 0xdf)
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b = appendMsgpack(b, v[k])
+		}
+		return b
+	}
+	return appendMsgpackString(b, fieldString(v))
+}
+
+// appendMsgpackInt appends an integer in its shortest encoding
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+}
+
+// appendMsgpackString appends a string
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackHeader appends an array or map header of n elements
+func appendMsgpackHeader(b []byte, n int, fix, code16, code32 byte) []byte {
+	switch {
+	case n <= 15:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+}
+
+// decodeMsgpack decodes the first value of b and returns the remaining bytes. Integers
+// decode as int64, strings as string, binaries as []byte, EventTime as eventTime, arrays
+// as []interface{} and maps as map[string]interface{}.
+func decodeMsgpack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errShortMsgpack
+	}
+	c, b := b[0], b[1:]
+	switch {
+	case c <= 0x7f:
+		return int64(c), b, nil
+	case c >= 0xe0:
+		return int64(int8(c)), b, nil
+	case c&0xe0 == 0xa0:
+		return decodeMsgpackBytes(b, int(c&0x1f), true)
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(b, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(b, int(c&0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2, 0xc3:
+		return c == 0xc3, b, nil
+	case 0xc4, 0xd9:
+		n, rest, err := msgpackLength(b, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackBytes(rest, n, c == 0xd9)
+	case 0xc5, 0xda:
+		n, rest, err := msgpackLength(b, 2)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackBytes(rest, n, c == 0xda)
+	case 0xc6, 0xdb:
+		n, rest, err := msgpackLength(b, 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackBytes(rest, n, c == 0xdb)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (c - 0xcc)
+		n, rest, err := msgpackUint(b, size)
+		return int64(n), rest, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, rest, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, rest, nil
+	case 0xca:
+		n, rest, err := msgpackUint(b, 4)
+		return float64(math.Float32frombits(uint32(n))), rest, err
+	case 0xcb:
+		n, rest, err := msgpackUint(b, 8)
+		return math.Float64frombits(n), rest, err
+	case 0xd7:
+		if len(b) < 9 {
+			return nil, nil, errShortMsgpack
+		}
+		sec, nsec := binary.BigEndian.Uint32(b[1:5]), binary.BigEndian.Uint32(b[5:9])
+		return eventTime(time.Unix(int64(sec), int64(nsec))), b[9:], nil
+	case 0xdc, 0xdd:
+		n, rest, err := msgpackLength(b, 2<<(c-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackArray(rest, n)
+	case 0xde, 0xdf:
+		n, rest, err := msgpackLength(b, 2<<(c-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackMap(rest, n)
+	}
+	return nil, nil, fmt.Errorf("zlog: unsupported msgpack type 0x%02x", c)
+}
+
+// msgpackUint reads a big endian unsigned integer of size bytes
+func msgpackUint(b []byte, size int) (uint64, []byte, error) {
+	if len(b) < size {
+		return 0, nil, errShortMsgpack
+	}
+	var n uint64
+	for _, c := range b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	return n, b[size:], nil
+}
+
+// msgpackLength reads a length of size bytes
+func msgpackLength(b []byte, size int) (int, []byte, error) {
+	n, rest, err := msgpackUint(b, size)
+	return int(n), rest, err
+}
+
+// decodeMsgpackBytes reads n bytes as a string or a binary
+func decodeMsgpackBytes(b []byte, n int, str bool) (interface{}, []byte, error) {
+	if len(b) < n {
+		return nil, nil, errShortMsgpack
+	}
+	if str {
+		return string(b[:n]), b[n:], nil
+	}
+	return append([]byte(nil), b[:n]...), b[n:], nil
+}
+
+// decodeMsgpackArray reads n array elements
+func decodeMsgpackArray(b []byte, n int) (interface{}, []byte, error) {
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		arr, b = append(arr, v), rest
+	}
+	return arr, b, nil
+}
+
+// decodeMsgpackMap reads n map entries with string keys
+func decodeMsgpackMap(b []byte, n int) (interface{}, []byte, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, rest, err := decodeMsgpack(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[fmt.Sprint(k)], b = v, rest
+	}
+	return m, b, nil
+}
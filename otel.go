@@ -117,9 +117,15 @@ func (zl *ZLogger) AddOtelHooks(ctx context.Context) {
 		return
 	}
 
-	// Add fields to the logger
-	newLogger := zl.logger.With().Fields(fields).Logger()
-	zl.logger = newLogger
+	// Add fields to the logger, keeping those of concurrent calls
+	for {
+		old := zl.fields.Load()
+		if zl.fields.CompareAndSwap(old, appendField(old, func(c zerolog.Context) zerolog.Context {
+			return c.Fields(fields)
+		})) {
+			return
+		}
+	}
 }
 
 // CtxInfofWithTrace adds trace information and logs the message
@@ -127,7 +133,7 @@ func (zl *ZLogger) CtxInfofWithTrace(ctx context.Context, format string, v ...in
 	// Add trace fields to context
 	fields := AddOtelFieldsToContext(ctx)
 
-	logEvt := zl.logger.Info()
+	logEvt := zl.current().Info()
 
 	// Add trace fields to the event
 	for k, v := range fields {
@@ -151,7 +157,7 @@ func (zl *ZLogger) CtxErrorfWithTrace(ctx context.Context, format string, v ...i
 	// Add trace fields to context
 	fields := AddOtelFieldsToContext(ctx)
 
-	logEvt := zl.logger.Error()
+	logEvt := zl.current().Error()
 
 	// Add trace fields to the event
 	for k, v := range fields {
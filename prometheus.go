@@ -0,0 +1,264 @@
+// Package zlog provides a Prometheus text exposition handler for logger statistics
+package zlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// StatsProvider is implemented by loggers that report their own telemetry, such as ZLogger and RotatingLogger
+type StatsProvider interface {
+	Stats() Stats
+}
+
+// MetricsRegistry publishes the statistics of several loggers, each registered under a name.
+// It implements http.Handler serving the Prometheus text exposition format.
+type MetricsRegistry struct {
+	mu      sync.RWMutex
+	loggers map[string]StatsProvider
+}
+
+// DefaultMetricsRegistry is the registry used by RegisterMetrics and MetricsHandler
+var DefaultMetricsRegistry = NewMetricsRegistry()
+
+// NewMetricsRegistry creates an empty MetricsRegistry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{loggers: make(map[string]StatsProvider)}
+}
+
+// Register publishes the statistics of l under the logger label name, replacing any previous registration
+func (r *MetricsRegistry) Register(name string, l StatsProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loggers[name] = l
+}
+
+// Unregister removes the logger registered under name
+func (r *MetricsRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.loggers, name)
+}
+
+// RegisterMetrics registers l with the DefaultMetricsRegistry
+func RegisterMetrics(name string, l StatsProvider) {
+	DefaultMetricsRegistry.Register(name, l)
+}
+
+// MetricsHandler returns an http.Handler serving the DefaultMetricsRegistry
+func MetricsHandler() http.Handler {
+	return DefaultMetricsRegistry
+}
+
+// ServeHTTP implements the http.Handler interface
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	_, _ = r.WriteTo(w)
+}
+
+// namedStats pairs a snapshot with the name it was registered under
+type namedStats struct {
+	name  string
+	stats Stats
+}
+
+// snapshot collects the statistics of every registered logger, ordered by name
+func (r *MetricsRegistry) snapshot() []namedStats {
+	r.mu.RLock()
+	providers := make(map[string]StatsProvider, len(r.loggers))
+	for name, l := range r.loggers {
+		providers[name] = l
+	}
+	r.mu.RUnlock()
+
+	all := make([]namedStats, 0, len(providers))
+	for name, l := range providers {
+		all = append(all, namedStats{name: name, stats: l.Stats()})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// WriteTo writes the statistics of all registered loggers in the Prometheus text exposition format
+func (r *MetricsRegistry) WriteTo(out io.Writer) (int64, error) {
+	all := r.snapshot()
+	bw := bufio.NewWriter(out)
+	cw := &countingWriter{w: bw}
+	pw := &promWriter{w: cw}
+
+	// The events of named loggers carry their name as logger_name, as logger is the registered name
+	pw.family("zlog_events_total", "counter", "Number of log events emitted.")
+	for _, ns := range all {
+		unnamed := make(map[string]uint64, len(ns.stats.Events))
+		for level, n := range ns.stats.Events {
+			unnamed[level] = n
+		}
+		for _, name := range sortedKeys(ns.stats.Loggers) {
+			for _, level := range sortedKeys(ns.stats.Loggers[name]) {
+				n := ns.stats.Loggers[name][level]
+				unnamed[level] -= min(n, unnamed[level])
+				pw.sample("zlog_events_total", n, "logger", ns.name, "logger_name", name, "level", level)
+			}
+		}
+		for _, level := range sortedKeys(unnamed) {
+			if n := unnamed[level]; n > 0 {
+				pw.sample("zlog_events_total", n, "logger", ns.name, "level", level)
+			}
+		}
+	}
+
+	pw.family("zlog_events_dropped_total", "counter", "Number of log events lost before reaching a sink.")
+	for _, ns := range all {
+		pw.sample("zlog_events_dropped_total", ns.stats.Dropped, "logger", ns.name)
+	}
+
+	pw.family("zlog_events_sampled_total", "counter", "Number of log events discarded by sampling.")
+	for _, ns := range all {
+		pw.sample("zlog_events_sampled_total", ns.stats.Sampled, "logger", ns.name)
+	}
+
+	pw.family("zlog_sink_bytes_total", "counter", "Number of bytes written to a sink.")
+	for _, ns := range all {
+		for _, sink := range ns.stats.SinkNames() {
+			pw.sample("zlog_sink_bytes_total", ns.stats.Sinks[sink].Bytes, "logger", ns.name, "sink", sink)
+		}
+	}
+
+	pw.family("zlog_sink_errors_total", "counter", "Number of failed writes to a sink.")
+	for _, ns := range all {
+		for _, sink := range ns.stats.SinkNames() {
+			pw.sample("zlog_sink_errors_total", ns.stats.Sinks[sink].Errors, "logger", ns.name, "sink", sink)
+		}
+	}
+
+	pw.family("zlog_sink_write_duration_seconds", "histogram", "Duration of writes to a sink.")
+	for _, ns := range all {
+		for _, sink := range ns.stats.SinkNames() {
+			pw.histogram("zlog_sink_write_duration_seconds", ns.stats.Sinks[sink].Latency, "logger", ns.name, "sink", sink)
+		}
+	}
+
+	pw.family("zlog_rotations_total", "counter", "Number of log file rotations.")
+	for _, ns := range all {
+		pw.sample("zlog_rotations_total", ns.stats.Rotations, "logger", ns.name)
+	}
+
+	pw.family("zlog_file_size_bytes", "gauge", "Current size of a rotating log file.")
+	for _, ns := range all {
+		for _, file := range sortedKeys(ns.stats.Files) {
+			pw.sample("zlog_file_size_bytes", ns.stats.Files[file], "logger", ns.name, "file", file)
+		}
+	}
+
+	pw.family("zlog_async_queue_depth", "gauge", "Number of log events waiting in async queues.")
+	for _, ns := range all {
+		pw.sample("zlog_async_queue_depth", ns.stats.QueueDepth, "logger", ns.name)
+	}
+
+	pw.family("zlog_async_queue_capacity", "gauge", "Capacity of async queues.")
+	for _, ns := range all {
+		pw.sample("zlog_async_queue_capacity", ns.stats.QueueCapacity, "logger", ns.name)
+	}
+
+	if pw.err == nil {
+		pw.err = bw.Flush()
+	}
+	return cw.n, pw.err
+}
+
+// promWriter writes metric families in the text exposition format, remembering the first error
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+// family writes the HELP and TYPE lines of a metric family
+func (p *promWriter) family(name, typ, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a single sample; labels are given as name/value pairs
+func (p *promWriter) sample(name string, value interface{}, labels ...string) {
+	p.printf("%s%s %v\n", name, formatLabels(labels), value)
+}
+
+// histogram writes the cumulative buckets, sum and count of h
+func (p *promWriter) histogram(name string, h LatencyHistogram, labels ...string) {
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		p.sample(name+"_bucket", cumulative, append(labels, "le", le)...)
+	}
+	p.sample(name+"_bucket", h.Count, append(labels, "le", "+Inf")...)
+	p.sample(name+"_sum", strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64), labels...)
+	p.sample(name+"_count", h.Count, labels...)
+}
+
+// printf writes formatted output unless an earlier write failed
+func (p *promWriter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// formatLabels renders name/value pairs as a Prometheus label set
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelValueEscaper escapes backslashes, double quotes and line feeds in label values
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value for the text exposition format
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements the io.Writer interface
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
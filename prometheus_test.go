@@ -0,0 +1,97 @@
+package zlog
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter blocks every write until release is closed
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return b.buf.Write(p)
+}
+
+func TestMetricsHandlerExposition(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	api := New(WithOutput(NamedWriter("buffer", &bytes.Buffer{})), WithMetrics(nil))
+	files := NewRotatingLogger(GetDefaultRotateConfig(filename, WithCompress(false)), WithMetrics(nil))
+	defer files.Close()
+
+	api.Info("hello")
+	api.Error("boom")
+	api.Named("db").Error("query failed")
+	files.Warn("to file")
+	require.NoError(t, files.Rotate())
+	files.Warn("after rotate")
+
+	registry := NewMetricsRegistry()
+	registry.Register("api", api)
+	registry.Register("files", files)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, body, "# TYPE zlog_events_total counter\n")
+	assert.Contains(t, body, `zlog_events_total{logger="api",level="info"} 1`)
+	assert.Contains(t, body, `zlog_events_total{logger="api",level="error"} 1`)
+	assert.Contains(t, body, `zlog_events_total{logger="api",logger_name="db",level="error"} 1`)
+	assert.Contains(t, body, `zlog_events_total{logger="files",level="warn"} 2`)
+	assert.Contains(t, body, `zlog_sink_errors_total{logger="api",sink="buffer"} 0`)
+	assert.Contains(t, body, `zlog_rotations_total{logger="files"} 1`)
+	assert.Contains(t, body, `zlog_file_size_bytes{logger="files",file="`+filename+`"}`)
+	assert.Contains(t, body, `zlog_sink_write_duration_seconds_bucket{logger="api",sink="buffer",le="+Inf"} 3`)
+	assert.Contains(t, body, `zlog_sink_write_duration_seconds_count{logger="api",sink="buffer"} 3`)
+	assert.Contains(t, body, `zlog_async_queue_depth{logger="api"} 0`)
+}
+
+func TestMetricsHandlerEscapesLabels(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.Register("a\"b\\c\n", New(WithOutput(io.Discard), WithMetrics(nil)))
+
+	var buf bytes.Buffer
+	_, err := registry.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `zlog_rotations_total{logger="a\"b\\c\n"} 0`)
+}
+
+func TestAsyncQueueDepth(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithAsync(2), WithMetrics(nil))
+
+	logger.Info("taken by the worker")
+	assert.Eventually(t, func() bool { return logger.Stats().QueueDepth == 0 }, time.Second, time.Millisecond)
+	logger.Info("queued 1")
+	logger.Info("queued 2")
+	logger.Info("dropped")
+
+	stats := logger.Stats()
+	assert.Equal(t, 2, stats.QueueDepth)
+	assert.Equal(t, 2, stats.QueueCapacity)
+	assert.Equal(t, uint64(1), stats.Dropped)
+
+	registry := NewMetricsRegistry()
+	registry.Register("async", logger)
+	var buf bytes.Buffer
+	_, err := registry.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `zlog_async_queue_depth{logger="async"} 2`)
+
+	close(out.release)
+	require.NoError(t, logger.Close())
+	assert.Equal(t, 3, bytes.Count(out.buf.Bytes(), []byte("\n")))
+	assert.Equal(t, uint64(3), logger.Stats().Sinks[DefaultOutputSinkName].Writes)
+}
@@ -0,0 +1,404 @@
+// Package zlog provides an output publishing batches of events to message queues
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultPublishBatchSize is the number of messages per published batch
+	defaultPublishBatchSize = 100
+	// defaultPublishQueueSize is the number of messages waiting to be published
+	defaultPublishQueueSize = 10000
+	// defaultPublishTimeout bounds a single Publish call
+	defaultPublishTimeout = 10 * time.Second
+)
+
+// Message is a single event handed to a Publisher
+type Message struct {
+	Key   []byte    // Key is the partition key, nil when the event has none of the key fields
+	Value []byte    // Value is the JSON event
+	Time  time.Time // Time is the time of the event
+}
+
+// Publisher sends batches of messages to a message queue such as Kafka, NSQ or NATS.
+// Implementations adapt the client of the queue; Publish returns once the batch is
+// acknowledged, or with an error to have it retried according to the Delivery guarantee.
+type Publisher interface {
+	Publish(ctx context.Context, batch []Message) error
+}
+
+// Delivery is the delivery guarantee of a PublisherSink
+type Delivery int
+
+const (
+	// AtMostOnce publishes every batch once and drops it when Publish fails
+	AtMostOnce Delivery = iota
+	// AtLeastOnce retries a failed batch with backoff until it is published, MaxRetries is exceeded or the sink is closed
+	AtLeastOnce
+)
+
+// Backpressure decides what a PublisherSink does with new events when its queue is full
+type Backpressure int
+
+const (
+	// DropNewest drops the new event, the default; logging never blocks
+	DropNewest Backpressure = iota
+	// DropOldest drops the oldest queued event to make room for the new one
+	DropOldest
+	// Block makes the logging call wait for room in the queue
+	Block
+)
+
+// PublisherConfig configures a PublisherSink
+type PublisherConfig struct {
+	Publisher     Publisher     // Publisher sends the batches
+	KeyFields     []string      // KeyFields are the fields tried in order for the partition key, e.g. "trace_id", "request_id"
+	BatchSize     int           // BatchSize is the number of messages per batch, 100 by default
+	FlushInterval time.Duration // FlushInterval is how long messages wait for a batch to fill, 1 second by default
+	QueueSize     int           // QueueSize is the number of messages waiting to be published, 10000 by default
+	Backpressure  Backpressure  // Backpressure applies when the queue is full, DropNewest by default
+	Delivery      Delivery      // Delivery is AtMostOnce by default
+	MaxRetries    int           // MaxRetries bounds the retries of AtLeastOnce, 0 retries until the sink is closed
+	MinBackoff    time.Duration // MinBackoff is the delay before the first retry, 500ms by default
+	MaxBackoff    time.Duration // MaxBackoff bounds the delay between retries, 30 seconds by default
+	Timeout       time.Duration // Timeout bounds a single Publish call, 10 seconds by default
+}
+
+// PublisherSink queues events and publishes them in batches through a Publisher on a
+// background goroutine, keyed by the first of KeyFields present in the event
+type PublisherSink struct {
+	config PublisherConfig
+	name   string
+
+	queue   chan Message
+	flushCh chan chan struct{}
+	closing chan struct{} // closing releases writers blocked on a full queue
+	done    chan struct{}
+	stopped chan struct{}
+
+	closeOnce sync.Once
+	mu        sync.RWMutex // mu orders writes before the final drain of the queue
+	closed    bool
+	dropped   atomic.Uint64
+	metrics   atomic.Pointer[metricsRecorder]
+}
+
+// NewPublisherSink creates a PublisherSink for config and starts publishing
+func NewPublisherSink(config PublisherConfig) (*PublisherSink, error) {
+	if config.Publisher == nil {
+		return nil, errors.New("zlog: publisher is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultPublishBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultHTTPFlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultPublishQueueSize
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultHTTPMinBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultHTTPMaxBackoff
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultPublishTimeout
+	}
+	s := &PublisherSink{
+		config:  config,
+		name:    "publisher",
+		queue:   make(chan Message, config.QueueSize),
+		flushCh: make(chan chan struct{}),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write implements the io.Writer interface; p is queued as a message, applying the backpressure policy when the queue is full
+func (s *PublisherSink) Write(p []byte) (int, error) {
+	e := decodeEvent(p)
+	msg := Message{Value: trimNewline(append([]byte(nil), stripNotice(p)...)), Time: e.Time}
+	for _, field := range s.config.KeyFields {
+		if v, ok := e.Fields[field]; ok {
+			msg.Key = []byte(fieldString(v))
+			break
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrWriterClosed
+	}
+	select {
+	case s.queue <- msg:
+		return len(p), nil
+	default:
+	}
+	switch s.config.Backpressure {
+	case Block:
+		select {
+		case s.queue <- msg:
+		case <-s.closing:
+			s.recordDropped(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.queue <- msg:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-s.queue:
+				s.recordDropped(1)
+			default:
+			}
+		}
+	default:
+		s.recordDropped(1)
+	}
+	return len(p), nil
+}
+
+// trimNewline removes the trailing newline of an event
+func trimNewline(p []byte) []byte {
+	for len(p) > 0 && p[len(p)-1] == '\n' {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// run collects messages into batches and publishes them until the sink is closed
+func (s *PublisherSink) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Message, 0, s.config.BatchSize)
+	publish := func() {
+		if len(batch) > 0 {
+			s.publish(batch)
+			batch = make([]Message, 0, s.config.BatchSize)
+		}
+	}
+	// drain moves every queued message into batches
+	drain := func() {
+		for {
+			select {
+			case msg := <-s.queue:
+				batch = append(batch, msg)
+				if len(batch) >= s.config.BatchSize {
+					publish()
+				}
+			default:
+				publish()
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case msg := <-s.queue:
+			batch = append(batch, msg)
+			if len(batch) >= s.config.BatchSize {
+				publish()
+			}
+		case <-ticker.C:
+			publish()
+		case ack := <-s.flushCh:
+			drain()
+			close(ack)
+		case <-s.done:
+			drain()
+			return
+		}
+	}
+}
+
+// publish sends a batch according to the delivery guarantee
+func (s *PublisherSink) publish(batch []Message) {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+		err := s.config.Publisher.Publish(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if s.config.Delivery == AtMostOnce || (s.config.MaxRetries > 0 && attempt >= s.config.MaxRetries) {
+			s.recordDropped(len(batch))
+			return
+		}
+		select {
+		case <-time.After(backoffDelay(attempt, s.config.MinBackoff, s.config.MaxBackoff)):
+		case <-s.done:
+			// Closing: one more attempt without waiting
+			ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+			err := s.config.Publisher.Publish(ctx, batch)
+			cancel()
+			if err != nil {
+				s.recordDropped(len(batch))
+			}
+			return
+		}
+	}
+}
+
+// recordDropped counts n events that will never be published
+func (s *PublisherSink) recordDropped(n int) {
+	s.dropped.Add(uint64(n))
+	if m := s.metrics.Load(); m != nil {
+		for i := 0; i < n; i++ {
+			m.recordDropped()
+		}
+	}
+}
+
+// setMetrics attaches a recorder counting dropped events
+func (s *PublisherSink) setMetrics(m *metricsRecorder) {
+	s.metrics.Store(m)
+}
+
+// Dropped returns the number of events dropped by the backpressure policy or failed publishing
+func (s *PublisherSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// QueueDepth returns the number of events waiting to be published
+func (s *PublisherSink) QueueDepth() int {
+	return len(s.queue)
+}
+
+// SinkName returns the name statistics are reported under
+func (s *PublisherSink) SinkName() string {
+	return s.name
+}
+
+// structured marks PublisherSink as decoding JSON events
+func (s *PublisherSink) structured() {}
+
+// Flush blocks until every event queued before the call has been published or dropped
+func (s *PublisherSink) Flush() error {
+	ack := make(chan struct{})
+	select {
+	case s.flushCh <- ack:
+		<-ack
+	case <-s.stopped:
+	}
+	return nil
+}
+
+// Close publishes the queued events and stops the sink; the Publisher is left open
+func (s *PublisherSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.done)
+	})
+	<-s.stopped
+	return nil
+}
+
+// MemoryPublisher is a Publisher keeping the published messages in memory, for tests
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+// NewMemoryPublisher creates an empty MemoryPublisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish implements the Publisher interface
+func (p *MemoryPublisher) Publish(ctx context.Context, batch []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, batch...)
+	return nil
+}
+
+// SetError makes Publish fail with err until it is called again with nil
+func (p *MemoryPublisher) SetError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Messages returns the messages published so far
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// LinePublisher is a reference Publisher writing every message as a line "key<TAB>value\n"
+// to a TCP connection, reconnecting on the next batch after a failure
+type LinePublisher struct {
+	addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewLinePublisher creates a LinePublisher sending to the TCP address addr; it connects on first use
+func NewLinePublisher(addr string) *LinePublisher {
+	return &LinePublisher{addr: addr}
+}
+
+// Publish implements the Publisher interface
+func (p *LinePublisher) Publish(ctx context.Context, batch []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", p.addr)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = p.conn.SetWriteDeadline(deadline)
+	}
+	w := bufio.NewWriter(p.conn)
+	for _, msg := range batch {
+		fmt.Fprintf(w, "%s\t%s\n", msg.Key, msg.Value)
+	}
+	if err := w.Flush(); err != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection
+func (p *LinePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
@@ -0,0 +1,150 @@
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingPublisher blocks every Publish until release is closed
+type blockingPublisher struct {
+	release chan struct{}
+	calls   atomic.Int32
+	*MemoryPublisher
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, batch []Message) error {
+	p.calls.Add(1)
+	<-p.release
+	return p.MemoryPublisher.Publish(ctx, batch)
+}
+
+func TestPublisherSinkBatchesWithKeys(t *testing.T) {
+	pub := NewMemoryPublisher()
+	s, err := NewPublisherSink(PublisherConfig{Publisher: pub, KeyFields: []string{"trace_id", "request_id"}, BatchSize: 2, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	logger := New(WithOutput(s))
+
+	logger.CtxInfof(context.Background(), "no key")
+	s.Write([]byte(`{"request_id":"r1","message":"request"}` + "\n"))
+	s.Write([]byte(`{"request_id":"r2","trace_id":"t1","message":"traced"}`))
+	require.NoError(t, logger.Flush())
+
+	msgs := pub.Messages()
+	require.Len(t, msgs, 3)
+	assert.Nil(t, msgs[0].Key)
+	assert.Contains(t, string(msgs[0].Value), `"message":"no key"`)
+	assert.Equal(t, "r1", string(msgs[1].Key))
+	assert.Equal(t, `{"request_id":"r1","message":"request"}`, string(msgs[1].Value))
+	assert.Equal(t, "t1", string(msgs[2].Key))
+	require.NoError(t, s.Close())
+	_, err = s.Write([]byte(`{}`))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+}
+
+func TestPublisherSinkDelivery(t *testing.T) {
+	pub := NewMemoryPublisher()
+	pub.SetError(errors.New("broker unavailable"))
+	atMostOnce, err := NewPublisherSink(PublisherConfig{Publisher: pub})
+	require.NoError(t, err)
+	atMostOnce.Write([]byte(`{"message":"lost"}`))
+	require.NoError(t, atMostOnce.Flush())
+	assert.Equal(t, uint64(1), atMostOnce.Dropped())
+	require.NoError(t, atMostOnce.Close())
+
+	atLeastOnce, err := NewPublisherSink(PublisherConfig{Publisher: pub, Delivery: AtLeastOnce, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	require.NoError(t, err)
+	defer atLeastOnce.Close()
+	atLeastOnce.Write([]byte(`{"message":"kept"}`))
+	time.AfterFunc(20*time.Millisecond, func() { pub.SetError(nil) })
+	require.NoError(t, atLeastOnce.Flush())
+	assert.Zero(t, atLeastOnce.Dropped())
+	require.Len(t, pub.Messages(), 1)
+	assert.Equal(t, `{"message":"kept"}`, string(pub.Messages()[0].Value))
+}
+
+func TestPublisherSinkBackpressure(t *testing.T) {
+	for _, tc := range []struct {
+		policy Backpressure
+		want   []string
+	}{
+		{DropNewest, []string{"0", "1", "2"}},
+		{DropOldest, []string{"0", "3", "4"}},
+	} {
+		pub := &blockingPublisher{release: make(chan struct{}), MemoryPublisher: NewMemoryPublisher()}
+		s, err := NewPublisherSink(PublisherConfig{Publisher: pub, BatchSize: 1, QueueSize: 2, Backpressure: tc.policy})
+		require.NoError(t, err)
+		s.Write([]byte(`{"message":"0"}`))
+		require.Eventually(t, func() bool { return pub.calls.Load() == 1 }, time.Second, time.Millisecond)
+		// The publisher is busy with event 0, the queue holds two more
+		for _, msg := range []string{"1", "2", "3", "4"} {
+			s.Write([]byte(`{"message":"` + msg + `"}`))
+		}
+		assert.Equal(t, uint64(2), s.Dropped())
+		close(pub.release)
+		require.NoError(t, s.Close())
+
+		var got []string
+		for _, m := range pub.Messages() {
+			got = append(got, decodeEvent(m.Value).Message)
+		}
+		assert.Equal(t, tc.want, got)
+	}
+}
+
+func TestPublisherSinkBlock(t *testing.T) {
+	pub := &blockingPublisher{release: make(chan struct{}), MemoryPublisher: NewMemoryPublisher()}
+	s, err := NewPublisherSink(PublisherConfig{Publisher: pub, BatchSize: 1, QueueSize: 1, Backpressure: Block})
+	require.NoError(t, err)
+	s.Write([]byte(`{"message":"0"}`))
+	require.Eventually(t, func() bool { return pub.calls.Load() == 1 }, time.Second, time.Millisecond)
+	s.Write([]byte(`{"message":"1"}`))
+
+	written := make(chan struct{})
+	go func() {
+		s.Write([]byte(`{"message":"2"}`))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("write did not block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(pub.release)
+	<-written
+	require.NoError(t, s.Close())
+	assert.Len(t, pub.Messages(), 3)
+	assert.Zero(t, s.Dropped())
+}
+
+func TestLinePublisher(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	lines := make(chan string, 4)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	pub := NewLinePublisher(l.Addr().String())
+	defer pub.Close()
+	err = pub.Publish(context.Background(), []Message{{Key: []byte("t1"), Value: []byte(`{"message":"a"}`)}, {Value: []byte(`{"message":"b"}`)}})
+	require.NoError(t, err)
+	assert.Equal(t, "t1\t{\"message\":\"a\"}", <-lines)
+	assert.True(t, strings.HasPrefix(<-lines, "\t{"))
+}
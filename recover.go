@@ -0,0 +1,255 @@
+// Package zlog provides panic recovery helpers that log the panic before deciding its fate
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PanicKey is the field holding the recovered panic value
+const PanicKey = "panic"
+
+// PanicAction decides what happens to a panic once it has been logged
+type PanicAction int
+
+const (
+	// PanicSwallow stops the panic; the goroutine continues after the deferred call
+	PanicSwallow PanicAction = iota
+	// PanicRepanic panics again with the original value after logging
+	PanicRepanic
+	// PanicRespond500 aborts the Hertz request with 500 Internal Server Error, it behaves like PanicSwallow outside of the middleware
+	PanicRespond500
+)
+
+// RecoverOption configures Recover, Go and HertzRecovery
+type RecoverOption func(*recoverConfig)
+
+// recoverConfig holds the configuration for panic recovery
+type recoverConfig struct {
+	logger  CtxLogger
+	level   hertzlog.Level
+	action  PanicAction
+	onPanic func(ctx context.Context, v interface{})
+}
+
+// newRecoverConfig applies opts over the defaults of a recovery helper
+func newRecoverConfig(logger CtxLogger, action PanicAction, opts []RecoverOption) *recoverConfig {
+	cfg := &recoverConfig{
+		logger: logger,
+		level:  hertzlog.LevelError,
+		action: action,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.logger == nil {
+		cfg.logger = hertzlog.DefaultLogger()
+	}
+	return cfg
+}
+
+// WithPanicLevel sets the level panics are logged at, LevelError or LevelFatal.
+// At LevelFatal the process exits after the sinks are flushed; loggers other than those of zlog
+// log the panic with CtxFatalf once the span is marked, since it may exit on its own.
+func WithPanicLevel(level hertzlog.Level) RecoverOption {
+	return func(c *recoverConfig) {
+		c.level = level
+	}
+}
+
+// WithPanicAction sets what happens to the panic after it is logged
+func WithPanicAction(action PanicAction) RecoverOption {
+	return func(c *recoverConfig) {
+		c.action = action
+	}
+}
+
+// WithRecoverLogger sets the logger used by Go; by default the hlog default logger is used
+func WithRecoverLogger(logger CtxLogger) RecoverOption {
+	return func(c *recoverConfig) {
+		c.logger = logger
+	}
+}
+
+// WithOnPanic registers a callback invoked with the panic value after it is logged
+func WithOnPanic(fn func(ctx context.Context, v interface{})) RecoverOption {
+	return func(c *recoverConfig) {
+		c.onPanic = fn
+	}
+}
+
+// Recover logs a panic of the current goroutine, it must be called directly by defer:
+//
+//	defer zlog.Recover(ctx, logger)
+//
+// By default the panic is swallowed; use WithPanicAction(PanicRepanic) to propagate it.
+func Recover(ctx context.Context, logger CtxLogger, opts ...RecoverOption) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	cfg := newRecoverConfig(logger, PanicSwallow, opts)
+	handlePanic(ctx, cfg, v, nil)
+	if cfg.action == PanicRepanic {
+		panic(v)
+	}
+}
+
+// Go runs fn in a new goroutine whose panics are logged the way Recover does
+func Go(ctx context.Context, fn func(ctx context.Context), opts ...RecoverOption) {
+	cfg := newRecoverConfig(nil, PanicSwallow, opts)
+	go func() {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			handlePanic(ctx, cfg, v, nil)
+			if cfg.action == PanicRepanic {
+				panic(v)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// HertzRecovery returns a Hertz middleware that logs panics of later handlers together with
+// the request metadata, then responds 500 unless another PanicAction is configured.
+func HertzRecovery(logger CtxLogger, opts ...RecoverOption) app.HandlerFunc {
+	cfg := newRecoverConfig(logger, PanicRespond500, opts)
+	return func(c context.Context, ctx *app.RequestContext) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			handlePanic(c, cfg, v, requestFields(ctx))
+			switch cfg.action {
+			case PanicRepanic:
+				panic(v)
+			case PanicRespond500:
+				ctx.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		ctx.Next(c)
+	}
+}
+
+// requestFields extracts the metadata of a Hertz request worth logging with a panic
+func requestFields(ctx *app.RequestContext) map[string]interface{} {
+	fields := map[string]interface{}{
+		"method":    string(ctx.Method()),
+		"path":      string(ctx.Path()),
+		"client_ip": ctx.ClientIP(),
+	}
+	if route := ctx.FullPath(); route != "" {
+		fields["route"] = route
+	}
+	if ua := ctx.UserAgent(); len(ua) > 0 {
+		fields["user_agent"] = string(ua)
+	}
+	if reqID := ctx.GetHeader(ReqIDKey); len(reqID) > 0 {
+		fields[LogIDKey] = string(reqID)
+	}
+	return fields
+}
+
+// handlePanic logs a recovered panic value, marks the active span and flushes the sinks.
+// It exits the process when configured to log at fatal level.
+func handlePanic(ctx context.Context, cfg *recoverConfig, v interface{}, extra map[string]interface{}) {
+	// Skip runtime.Callers, callerStack and handlePanic; the deferred function and
+	// runtime.gopanic stay so the panicking frame is easy to find
+	stack := callerStack(3)
+	msg := fmt.Sprintf("panic recovered: %v", v)
+
+	zl := asZLogger(cfg.logger)
+	fatal := cfg.level >= hertzlog.LevelFatal
+	var text string
+	if zl != nil {
+		zl.logPanic(ctx, cfg.level, v, msg, stack, extra)
+	} else {
+		// Other loggers get a self-contained message
+		text = msg
+		if len(extra) > 0 {
+			text += fmt.Sprintf(" %v", extra)
+		}
+		text += "\n\t" + strings.Join(stack, "\n\t")
+		if !fatal {
+			cfg.logger.CtxErrorf(ctx, "%s", text)
+		}
+	}
+	flushLogger(cfg.logger)
+
+	if ctx != nil {
+		span := trace.SpanFromContext(ctx)
+		if span.SpanContext().IsValid() {
+			if err, ok := v.(error); ok {
+				span.RecordError(err)
+			}
+			span.SetStatus(codes.Error, msg)
+		}
+	}
+	if cfg.onPanic != nil {
+		cfg.onPanic(ctx, v)
+	}
+	if fatal {
+		if zl == nil {
+			// CtxFatalf may exit, so it is called once the span is marked
+			cfg.logger.CtxFatalf(ctx, "%s", text)
+			flushLogger(cfg.logger)
+		}
+		os.Exit(1)
+	}
+}
+
+// flushLogger flushes logger when it buffers events
+func flushLogger(logger CtxLogger) {
+	if f, ok := logger.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+}
+
+// logPanic writes a structured panic event.
+// Fatal events are written without zerolog's implicit exit so the flush still happens.
+func (zl *ZLogger) logPanic(ctx context.Context, level hertzlog.Level, v interface{}, msg string, stack []string, extra map[string]interface{}) {
+	zlevel := zerolog.ErrorLevel
+	if level >= hertzlog.LevelFatal {
+		zlevel = zerolog.FatalLevel
+	}
+	logEvt := zl.current().WithLevel(zlevel)
+	if logEvt != nil {
+		for k, v := range zl.getOtelFields(ctx) {
+			logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
+		}
+		for k, v := range extra {
+			logEvt = logEvt.Interface(k, v)
+		}
+		logEvt = logEvt.Str(PanicKey, fmt.Sprint(v))
+		if err, ok := v.(error); ok {
+			appendError(logEvt, err)
+		}
+		logEvt.Strs(StackKey, stack).Msg(msg)
+	}
+}
+
+// asZLogger returns the ZLogger behind the supported logger types, or nil
+func asZLogger(logger interface{}) *ZLogger {
+	switch l := logger.(type) {
+	case *ZLogger:
+		return l
+	case *RotatingLogger:
+		return l.baseLogger
+	case *HlogAdapter:
+		return l.logger
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// syncBuffer is a bytes.Buffer safe for use from several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) Bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.buf.Bytes()...)
+}
+
+func TestRecoverSwallowsAndLogs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+
+	func() {
+		defer Recover(context.Background(), logger)
+		panic("something broke")
+	}()
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "something broke", entry[PanicKey])
+	assert.Equal(t, "panic recovered: something broke", entry["message"])
+	stack := entry[StackKey].([]interface{})
+	found := false
+	for _, frame := range stack {
+		if assert.IsType(t, "", frame) && bytes.Contains([]byte(frame.(string)), []byte("TestRecoverSwallowsAndLogs")) {
+			found = true
+		}
+	}
+	assert.True(t, found, "stack should contain the panicking function")
+}
+
+func TestRecoverRepanics(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+	panicErr := errors.New("fatal input")
+
+	assert.PanicsWithValue(t, panicErr, func() {
+		defer Recover(context.Background(), logger, WithPanicAction(PanicRepanic))
+		panic(panicErr)
+	})
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, "*errors.errorString", entry[ErrorTypeKey])
+}
+
+// flushingLogger is a logger of another package that buffers its output
+type flushingLogger struct {
+	CtxLogger
+	flushed int
+}
+
+func (l *flushingLogger) Flush() error {
+	l.flushed++
+	return nil
+}
+
+func TestRecoverFlushesAnyLogger(t *testing.T) {
+	logger := &flushingLogger{CtxLogger: New(WithOutput(&bytes.Buffer{}))}
+	func() {
+		defer Recover(context.Background(), logger)
+		panic("something broke")
+	}()
+	assert.Equal(t, 1, logger.flushed)
+
+	// The hlog adapter flushes the ZLogger behind it
+	buf := &syncBuffer{}
+	adapter := NewHlogAdapter(New(WithOutput(buf), WithFormat(JSONFormat), WithAsync(16)))
+	func() {
+		defer Recover(context.Background(), adapter)
+		panic("adapter broke")
+	}()
+	assert.Contains(t, string(buf.Bytes()), "adapter broke")
+}
+
+// recordingLogger records the Error messages of a CtxLogger that is not a ZLogger
+type recordingLogger struct {
+	CtxLogger
+	errors []string
+}
+
+func (l *recordingLogger) CtxErrorf(ctx context.Context, format string, v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
+
+func TestRecoverFormatsPanicForOtherLoggers(t *testing.T) {
+	logger := &recordingLogger{CtxLogger: New(WithOutput(&bytes.Buffer{}))}
+	func() {
+		defer Recover(context.Background(), logger)
+		panic("something broke")
+	}()
+	require.Len(t, logger.errors, 1)
+	assert.True(t, strings.HasPrefix(logger.errors[0], "panic recovered: something broke\n\t"), logger.errors[0])
+	assert.NotContains(t, logger.errors[0], "map[]")
+
+	cfg := newRecoverConfig(logger, PanicSwallow, nil)
+	handlePanic(context.Background(), cfg, "handler broke", map[string]interface{}{"path": "/users"})
+	require.Len(t, logger.errors, 2)
+	assert.True(t, strings.HasPrefix(logger.errors[1], "panic recovered: handler broke map[path:/users]\n\t"), logger.errors[1])
+}
+
+func TestRecoverMarksSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "work")
+
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+	func() {
+		defer Recover(ctx, logger)
+		panic("in span")
+	}()
+	span.End()
+
+	entry := decodeLine(t, buf)
+	assert.Equal(t, span.SpanContext().TraceID().String(), entry["trace_id"])
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+}
+
+func TestGoRecoversPanics(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+	done := make(chan interface{}, 1)
+
+	Go(context.Background(), func(ctx context.Context) {
+		panic("in goroutine")
+	}, WithRecoverLogger(logger), WithOnPanic(func(ctx context.Context, v interface{}) {
+		done <- v
+	}))
+
+	assert.Equal(t, "in goroutine", <-done)
+	assert.Contains(t, string(buf.Bytes()), `"panic":"in goroutine"`)
+}
+
+func TestHertzRecoveryResponds500(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(WithOutput(buf), WithFormat(JSONFormat))
+	ctx := ut.CreateUtRequestContext(http.MethodGet, "/orders/42", nil, ut.Header{Key: ReqIDKey, Value: "req-1"})
+	ctx.SetHandlers([]app.HandlerFunc{
+		HertzRecovery(logger),
+		func(c context.Context, ctx *app.RequestContext) { panic("handler failed") },
+	})
+
+	ctx.Next(context.Background())
+
+	assert.Equal(t, http.StatusInternalServerError, ctx.Response.StatusCode())
+	assert.True(t, ctx.IsAborted())
+	entry := decodeLine(t, buf)
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/orders/42", entry["path"])
+	assert.Equal(t, "req-1", entry[LogIDKey])
+	assert.Equal(t, "handler failed", entry[PanicKey])
+}
+
+func TestHertzRecoveryRepanic(t *testing.T) {
+	logger := New(WithOutput(&bytes.Buffer{}))
+	ctx := ut.CreateUtRequestContext(http.MethodGet, "/", nil)
+	ctx.SetHandlers([]app.HandlerFunc{
+		HertzRecovery(logger, WithPanicAction(PanicRepanic)),
+		func(c context.Context, ctx *app.RequestContext) { panic("again") },
+	})
+
+	assert.PanicsWithValue(t, "again", func() { ctx.Next(context.Background()) })
+}
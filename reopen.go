@@ -0,0 +1,107 @@
+// Package zlog provides cooperation with external log rotation tools
+package zlog
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// reopenRegistry holds the writers reopened when a reopen signal is received
+var reopenRegistry struct {
+	sync.Mutex
+	writers map[*FileWriter]struct{}
+	signals chan os.Signal
+}
+
+// NewReopenWriter creates a plain file writer for use with an external rotation tool such as
+// logrotate; it is the FileWriter of a RotateConfig with ExternalRotation. The writer never
+// rotates or deletes files itself. Instead it notices within a second when the file was moved,
+// deleted or truncated (copytruncate) and reopens it, and it reopens the file when the process
+// receives SIGHUP or Reopen is called (move-and-HUP).
+func NewReopenWriter(filename string, opts ...RotateConfigOption) *FileWriter {
+	config := &RotateConfig{Filename: filename, ExternalRotation: true}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return NewFileWriter(config)
+}
+
+// WithExternalRotation leaves rotation to an external tool, see NewReopenWriter.
+// Size and time triggers as well as retention policies are ignored.
+func WithExternalRotation(external bool) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.ExternalRotation = external
+	}
+}
+
+// Reopen closes the log file and opens it again, creating it when it was moved or deleted
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	return w.reopenOrCreate()
+}
+
+// reopenOrCreate opens the log file for appending, creating it when missing
+func (w *FileWriter) reopenOrCreate() error {
+	if err := w.reopen(); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	return w.openNew(w.newFileAttributes())
+}
+
+// registerReopen reopens w on every reopen signal until unregistered
+func registerReopen(w *FileWriter) {
+	if len(reopenSignals) == 0 {
+		return
+	}
+	reopenRegistry.Lock()
+	defer reopenRegistry.Unlock()
+	if reopenRegistry.writers == nil {
+		reopenRegistry.writers = make(map[*FileWriter]struct{})
+	}
+	reopenRegistry.writers[w] = struct{}{}
+	if reopenRegistry.signals == nil {
+		reopenRegistry.signals = make(chan os.Signal, 1)
+		signal.Notify(reopenRegistry.signals, reopenSignals...)
+		go reopenOnSignal(reopenRegistry.signals)
+	}
+}
+
+// unregisterReopen stops reopening w, and listening for signals once no writer is left
+func unregisterReopen(w *FileWriter) {
+	reopenRegistry.Lock()
+	defer reopenRegistry.Unlock()
+	delete(reopenRegistry.writers, w)
+	if len(reopenRegistry.writers) == 0 && reopenRegistry.signals != nil {
+		signal.Stop(reopenRegistry.signals)
+		close(reopenRegistry.signals)
+		reopenRegistry.signals = nil
+	}
+}
+
+// reopenOnSignal reopens the registered writers every time a signal arrives on ch
+func reopenOnSignal(ch chan os.Signal) {
+	for range ch {
+		reopenRegistry.Lock()
+		writers := make([]*FileWriter, 0, len(reopenRegistry.writers))
+		for w := range reopenRegistry.writers {
+			writers = append(writers, w)
+		}
+		reopenRegistry.Unlock()
+		for _, w := range writers {
+			if err := w.Reopen(); err != nil && err != ErrWriterClosed {
+				w.events.reportError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9 || js || wasip1
+
+package zlog
+
+import "os"
+
+// reopenSignals is empty on this platform; external rotation writers reopen through Reopen only
+var reopenSignals []os.Signal
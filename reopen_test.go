@@ -0,0 +1,104 @@
+package zlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReopenWriter returns an external rotation writer whose clock is advanced by the returned function
+func newTestReopenWriter(t *testing.T, filename string) (*FileWriter, func()) {
+	t.Helper()
+	w := NewReopenWriter(filename)
+	t.Cleanup(func() { w.Close() })
+	now := time.Now()
+	w.clock.set(ClockFunc(func() time.Time { return now }))
+	return w, func() { now = now.Add(identityCheckInterval) }
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestReopenWriterDetectsMove(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w, advance := newTestReopenWriter(t, filename)
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	moved := filepath.Join(dir, "app.log.1")
+	require.NoError(t, os.Rename(filename, moved))
+	advance()
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "before\n", readFile(t, moved))
+	assert.Equal(t, "after\n", readFile(t, filename))
+}
+
+func TestReopenWriterDetectsDelete(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, advance := newTestReopenWriter(t, filename)
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filename))
+	advance()
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", readFile(t, filename))
+}
+
+func TestReopenWriterCopyTruncate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w, advance := newTestReopenWriter(t, filename)
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(filename, 0))
+	advance()
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "after\n", readFile(t, filename))
+	assert.Equal(t, int64(6), w.size)
+}
+
+func TestReopenWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithExternalRotation(true)), WithFormat(JSONFormat))
+	defer logger.Close()
+
+	logger.Info("before")
+	require.NoError(t, os.Rename(filename, filepath.Join(dir, "app.log.1")))
+	require.NoError(t, logger.Reopen())
+	logger.Info("after")
+
+	assert.Contains(t, readFile(t, filename), `"message":"after"`)
+	assert.NotContains(t, readFile(t, filename), `"message":"before"`)
+}
+
+func TestReopenWriterNeverRotates(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := NewReopenWriter(filename, WithMaxSize(1), WithMaxBackups(1))
+	defer w.Close()
+
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 2; i++ {
+		_, err := w.Write(chunk)
+		require.NoError(t, err)
+	}
+	assert.Empty(t, backupsOf(t, filename))
+	assert.Nil(t, w.retention)
+	assert.Equal(t, int64(2*len(chunk)), fileSize(filename))
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package zlog
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals are the signals that make external rotation writers reopen their file
+var reopenSignals = []os.Signal{syscall.SIGHUP}
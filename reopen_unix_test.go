@@ -0,0 +1,32 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReopenWriterOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w := NewReopenWriter(filename)
+	defer w.Close()
+
+	_, err := w.Write([]byte("before\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(filename, filepath.Join(dir, "app.log.1")))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	// The reopen creates the file again
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filename)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
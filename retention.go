@@ -0,0 +1,398 @@
+// Package zlog provides retention policies for rotated log files
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the timestamp layout rotated files carry in their name
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	// gzipSuffix is the extension added to gzip compressed backups
+	gzipSuffix = ".gz"
+	// megabyte is the unit of the size settings of RotateConfig
+	megabyte = 1024 * 1024
+	// freeSpaceCheckInterval bounds how often writes trigger a free space check
+	freeSpaceCheckInterval = time.Minute
+)
+
+// Reasons reported for deleted backups
+const (
+	RetentionMaxBackups   = "max_backups"
+	RetentionMaxAge       = "max_age"
+	RetentionMaxTotalSize = "max_total_size"
+	RetentionMinFreeSpace = "min_free_space"
+)
+
+// BackupFile describes a rotated log file
+type BackupFile struct {
+	Path       string    // Path is the location of the backup
+	Size       int64     // Size is the size of the backup in bytes
+	Time       time.Time // Time is when the backup was rotated out
+	Compressed bool      // Compressed reports whether the backup is compressed
+}
+
+// RetentionDeletion is a backup removed by a retention pass and the rule that removed it
+type RetentionDeletion struct {
+	BackupFile
+	Reason string
+}
+
+// RetentionReport describes what a retention pass did, or would do in dry-run mode
+type RetentionReport struct {
+	DryRun     bool
+	Compressed []BackupFile
+	Deleted    []RetentionDeletion
+	Archived   []BackupFile // Archived are the final backups handed to the Archiver, under their compressed path
+	FreeSpace  int64        // FreeSpace is the free space in bytes observed on the filesystem, -1 when unknown
+}
+
+// hasRetention reports whether any retention, compression or archiving policy is configured
+func (c *RotateConfig) hasRetention() bool {
+	return c.MaxBackups > 0 || c.MaxAge > 0 || c.Compress || c.MaxTotalSize > 0 || c.MinFreeSpace > 0 ||
+		c.CompressAfter > 0 || c.RetentionDryRun || c.Compression != nil || c.OnRetention != nil ||
+		c.OnCompress != nil || c.OnDelete != nil || c.Archiver != nil
+}
+
+// retentionManager applies the retention policy of a RotateConfig to the backups of its file
+type retentionManager struct {
+	config *RotateConfig
+	events *lifecycle
+	clock  Clock
+	lock   *fileLock // lock excludes retention passes of other processes, nil without MultiProcess
+
+	mu      sync.Mutex // serializes retention passes
+	pending chan struct{}
+	done    chan struct{}
+	stopped chan struct{} // closed by run on exit
+	once    sync.Once
+
+	checkMu   sync.Mutex
+	lastCheck time.Time
+
+	recovered bool // guarded by mu, set once interrupted compressions have been cleaned up
+}
+
+// newRetentionManager creates a manager and starts its background worker
+func newRetentionManager(config *RotateConfig, events *lifecycle, clock Clock) *retentionManager {
+	m := &retentionManager{config: config, events: events, clock: clock, pending: make(chan struct{}, 1), done: make(chan struct{}), stopped: make(chan struct{})}
+	go m.run()
+	return m
+}
+
+// run performs a retention pass every time one is triggered, until stopped
+func (m *retentionManager) run() {
+	defer close(m.stopped)
+	for {
+		select {
+		case <-m.pending:
+			if _, err := m.apply(m.config.RetentionDryRun); err != nil {
+				m.events.reportError(err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// stop ends the background worker and waits for a running pass to finish
+func (m *retentionManager) stop() {
+	m.once.Do(func() {
+		close(m.done)
+		<-m.stopped
+		if m.lock != nil {
+			m.mu.Lock()
+			_ = m.lock.close()
+			m.lock = nil
+			m.mu.Unlock()
+		}
+	})
+}
+
+// trigger schedules a retention pass without waiting for it
+func (m *retentionManager) trigger() {
+	select {
+	case m.pending <- struct{}{}:
+	default:
+		// A pass is already scheduled and will see the current state
+	}
+}
+
+// maybeCheckFreeSpace triggers a pass when the free space watermark has not been checked recently
+func (m *retentionManager) maybeCheckFreeSpace() {
+	if m.config.MinFreeSpace <= 0 {
+		return
+	}
+	m.checkMu.Lock()
+	now := m.clock.Now()
+	due := now.Sub(m.lastCheck) >= freeSpaceCheckInterval
+	if due {
+		m.lastCheck = now
+	}
+	m.checkMu.Unlock()
+	if due {
+		m.trigger()
+	}
+}
+
+// apply runs a retention pass; with dryRun no file is touched
+func (m *retentionManager) apply(dryRun bool) (RetentionReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := RetentionReport{DryRun: dryRun, FreeSpace: -1}
+	if !dryRun && m.lock != nil {
+		if err := m.lock.lock(); err != nil {
+			return report, err
+		}
+		defer m.lock.unlock()
+	}
+	if !dryRun && !m.recovered {
+		if err := recoverCompression(m.config.Filename); err != nil {
+			return report, err
+		}
+		m.recovered = true
+	}
+	backups, err := listBackups(m.config.Filename, m.config.LocalTime)
+	if err != nil {
+		return report, err
+	}
+
+	kept, deleted := planDeletions(m.config, backups, m.clock.Now())
+	if m.config.MinFreeSpace > 0 {
+		if free, ok := diskFree(filepath.Dir(m.config.Filename)); ok {
+			report.FreeSpace = free
+			var pruned []RetentionDeletion
+			kept, pruned = pruneForFreeSpace(kept, free, int64(m.config.MinFreeSpace)*megabyte)
+			deleted = append(deleted, pruned...)
+		}
+	}
+	report.Deleted = deleted
+	after, compress := m.compressAfter()
+	if compress {
+		report.Compressed = planCompression(kept, m.clock.Now(), after)
+	}
+	compression := m.compression()
+	if m.config.Archiver != nil {
+		report.Archived = planArchive(kept, report.Compressed, compress, compression.suffix())
+	}
+
+	if !dryRun {
+		for _, d := range report.Deleted {
+			rerr := firstErr(removeIfExists(d.Path), removeIfExists(d.Path+checksumSuffix))
+			m.events.deleted(DeleteEvent{Path: d.Path, Size: d.Size, Reason: d.Reason, Time: m.clock.Now(), Err: rerr})
+			err = firstErr(err, rerr)
+		}
+		failed := make(map[string]bool)
+		for _, b := range report.Compressed {
+			cerr := compressFile(b.Path, compression)
+			archive := b.Path + compression.suffix()
+			e := CompressEvent{Source: b.Path, Archive: archive, Size: b.Size, Time: m.clock.Now(), Err: cerr}
+			if cerr == nil {
+				e.CompressedSize = fileSize(archive)
+			} else {
+				failed[archive] = true
+			}
+			m.events.compressed(e)
+			err = firstErr(err, cerr)
+		}
+		for _, b := range report.Archived {
+			if failed[b.Path] {
+				continue
+			}
+			if aerr := m.config.Archiver.Archive(context.Background(), b.Path); aerr != nil {
+				err = firstErr(err, fmt.Errorf("failed to archive %s: %w", b.Path, aerr))
+			}
+		}
+	}
+	if m.config.OnRetention != nil {
+		m.config.OnRetention(report)
+	}
+	return report, err
+}
+
+// compressAfter returns how long backups stay uncompressed, and whether they are compressed at all.
+// Without CompressAfter, backups are compressed right after rotation.
+func (m *retentionManager) compressAfter() (time.Duration, bool) {
+	switch {
+	case m.config.CompressAfter > 0:
+		return time.Duration(m.config.CompressAfter) * 24 * time.Hour, true
+	case m.config.Compress || m.config.Compression != nil:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// compression returns the configured compression, gzip when only Compress is set
+func (m *retentionManager) compression() *Compression {
+	if m.config.Compression != nil {
+		return m.config.Compression
+	}
+	return &Compression{Algorithm: CompressionGzip}
+}
+
+// planDeletions splits backups, sorted newest first, into kept ones and ones removed by
+// the MaxAge, MaxBackups and MaxTotalSize rules
+func planDeletions(c *RotateConfig, backups []BackupFile, now time.Time) (kept []BackupFile, deleted []RetentionDeletion) {
+	var total int64
+	maxTotal := int64(c.MaxTotalSize) * megabyte
+	for _, b := range backups {
+		switch {
+		case c.MaxAge > 0 && now.Sub(b.Time) > time.Duration(c.MaxAge)*24*time.Hour:
+			deleted = append(deleted, RetentionDeletion{BackupFile: b, Reason: RetentionMaxAge})
+		case c.MaxBackups > 0 && len(kept) >= c.MaxBackups:
+			deleted = append(deleted, RetentionDeletion{BackupFile: b, Reason: RetentionMaxBackups})
+		case maxTotal > 0 && total+b.Size > maxTotal:
+			deleted = append(deleted, RetentionDeletion{BackupFile: b, Reason: RetentionMaxTotalSize})
+		default:
+			kept = append(kept, b)
+			total += b.Size
+		}
+	}
+	return kept, deleted
+}
+
+// pruneForFreeSpace removes the oldest kept backups until the space they free brings the
+// filesystem back above the watermark, or no backup is left
+func pruneForFreeSpace(kept []BackupFile, free, watermark int64) ([]BackupFile, []RetentionDeletion) {
+	var deleted []RetentionDeletion
+	for free < watermark && len(kept) > 0 {
+		oldest := kept[len(kept)-1]
+		kept = kept[:len(kept)-1]
+		deleted = append(deleted, RetentionDeletion{BackupFile: oldest, Reason: RetentionMinFreeSpace})
+		free += oldest.Size
+	}
+	return kept, deleted
+}
+
+// planCompression returns the uncompressed backups older than after
+func planCompression(kept []BackupFile, now time.Time, after time.Duration) []BackupFile {
+	var compress []BackupFile
+	for _, b := range kept {
+		if !b.Compressed && now.Sub(b.Time) >= after {
+			compress = append(compress, b)
+		}
+	}
+	return compress
+}
+
+// planArchive returns the kept backups that are final, under the path they have once the
+// planned compressions are done; backups still waiting for compression are left for later passes
+func planArchive(kept, compressing []BackupFile, compress bool, suffix string) []BackupFile {
+	planned := make(map[string]bool, len(compressing))
+	for _, b := range compressing {
+		planned[b.Path] = true
+	}
+	var archive []BackupFile
+	for _, b := range kept {
+		switch {
+		case planned[b.Path]:
+			b.Path += suffix
+			b.Compressed = true
+		case compress && !b.Compressed:
+			continue
+		}
+		archive = append(archive, b)
+	}
+	return archive
+}
+
+// listBackups returns the rotated files of filename, newest first
+func listBackups(filename string, localTime bool) ([]BackupFile, error) {
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list log backups: %w", err)
+	}
+
+	loc := time.UTC
+	if localTime {
+		loc = time.Local
+	}
+
+	var backups []BackupFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		t, ok := parseBackupName(filename, trimArchiveSuffix(name), loc)
+		if !ok {
+			continue
+		}
+		info, ierr := entry.Info()
+		if ierr != nil {
+			continue
+		}
+		backups = append(backups, BackupFile{
+			Path:       filepath.Join(dir, name),
+			Size:       info.Size(),
+			Time:       t,
+			Compressed: isArchive(name),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// parseBackupName returns the rotation time in name, a rotated file of filename without its
+// compression extension; ok is false for any other file, e.g. the backups of a sibling log
+func parseBackupName(filename, name string, loc *time.Location) (t time.Time, ok bool) {
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	prefix := base[:len(base)-len(ext)] + "-"
+	if len(name) < len(prefix)+len(ext) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeFormat, name[len(prefix):len(name)-len(ext)], loc)
+	return t, err == nil
+}
+
+// ApplyRetention runs a retention pass synchronously and reports what it did.
+// It returns an error when no retention policy is configured.
+func (rl *RotatingLogger) ApplyRetention() (RetentionReport, error) {
+	m := rl.retentionManager()
+	if m == nil {
+		return RetentionReport{}, fmt.Errorf("no retention policy configured")
+	}
+	return m.apply(rl.config.RetentionDryRun)
+}
+
+// PlanRetention reports what a retention pass would delete or compress without touching any file
+func (rl *RotatingLogger) PlanRetention() (RetentionReport, error) {
+	m := rl.retentionManager()
+	if m == nil {
+		m = &retentionManager{config: rl.config, clock: rl.clock()}
+	}
+	return m.apply(true)
+}
+
+// clock returns the clock of the rotating writer, or the clock of its config
+func (rl *RotatingLogger) clock() Clock {
+	if fw, ok := rl.writer.(*FileWriter); ok {
+		return fw.clock
+	}
+	if rl.config != nil && rl.config.Clock != nil {
+		return rl.config.Clock
+	}
+	return SystemClock
+}
+
+// retentionManager returns the manager of the rotating writer, if any
+func (rl *RotatingLogger) retentionManager() *retentionManager {
+	if fw, ok := rl.writer.(*FileWriter); ok {
+		return fw.retention
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBackup creates a backup of filename rotated at t with size bytes
+func writeBackup(t *testing.T, filename string, at time.Time, size int, compressed bool) string {
+	t.Helper()
+	ext := filepath.Ext(filename)
+	name := filename[:len(filename)-len(ext)] + "-" + at.UTC().Format(backupTimeFormat) + ext
+	if compressed {
+		name += gzipSuffix
+	}
+	require.NoError(t, os.WriteFile(name, make([]byte, size), 0644))
+	return name
+}
+
+func deletedPaths(report RetentionReport) map[string]string {
+	paths := make(map[string]string)
+	for _, d := range report.Deleted {
+		paths[d.Path] = d.Reason
+	}
+	return paths
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRetentionMaxTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	newest := writeBackup(t, filename, now.Add(-time.Hour), megabyte, false)
+	middle := writeBackup(t, filename, now.Add(-2*time.Hour), megabyte, false)
+	oldest := writeBackup(t, filename, now.Add(-3*time.Hour), megabyte, false)
+
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithCompress(false), WithMaxTotalSize(2)))
+	defer logger.Close()
+	_, err := logger.ApplyRetention()
+	require.NoError(t, err)
+
+	assert.FileExists(t, newest)
+	assert.FileExists(t, middle)
+	assert.NoFileExists(t, oldest)
+}
+
+func TestRetentionTieredAging(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	fresh := writeBackup(t, filename, now.Add(-2*time.Hour), 10, false)
+	aged := writeBackup(t, filename, now.Add(-48*time.Hour), 10, false)
+	expired := writeBackup(t, filename, now.Add(-40*24*time.Hour), 10, true)
+
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithCompressAfter(1), WithMaxAge(30), WithMaxBackups(0)))
+	defer logger.Close()
+	_, err := logger.ApplyRetention()
+	require.NoError(t, err)
+
+	assert.FileExists(t, fresh)
+	assert.NoFileExists(t, aged)
+	assert.FileExists(t, aged+gzipSuffix)
+	assert.NoFileExists(t, expired)
+}
+
+func TestRetentionDryRun(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	kept := writeBackup(t, filename, now.Add(-time.Hour), 10, false)
+	aged := writeBackup(t, filename, now.Add(-48*time.Hour), 10, false)
+	extra := writeBackup(t, filename, now.Add(-72*time.Hour), 10, false)
+	before := listDir(t, dir)
+
+	reports := make(chan RetentionReport, 4)
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename,
+		WithMaxBackups(2), WithCompressAfter(1), WithRetentionDryRun(true),
+		WithOnRetention(func(r RetentionReport) { reports <- r }),
+	))
+	defer logger.Close()
+
+	report, err := logger.ApplyRetention()
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, map[string]string{extra: RetentionMaxBackups}, deletedPaths(report))
+	require.Len(t, report.Compressed, 1)
+	assert.Equal(t, aged, report.Compressed[0].Path)
+	assert.NotContains(t, deletedPaths(report), kept)
+	assert.Equal(t, before, listDir(t, dir))
+	assert.NotEmpty(t, reports)
+}
+
+func TestRetentionMinFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	now := time.Now()
+	newest := writeBackup(t, filename, now.Add(-time.Hour), 10, false)
+	oldest := writeBackup(t, filename, now.Add(-2*time.Hour), 10, false)
+
+	// An unreachable watermark prunes every backup, oldest first
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filename, WithCompress(false), WithMinFreeSpace(1<<40), WithRetentionDryRun(true)))
+	defer logger.Close()
+	report, err := logger.PlanRetention()
+	require.NoError(t, err)
+
+	if report.FreeSpace < 0 {
+		t.Skip("free space is not available on this platform")
+	}
+	require.Len(t, report.Deleted, 2)
+	assert.Equal(t, oldest, report.Deleted[0].Path)
+	assert.Equal(t, newest, report.Deleted[1].Path)
+	assert.Equal(t, RetentionMinFreeSpace, report.Deleted[0].Reason)
+}
+
+func TestPruneForFreeSpaceStopsAtWatermark(t *testing.T) {
+	kept := []BackupFile{{Path: "new", Size: 30}, {Path: "mid", Size: 30}, {Path: "old", Size: 30}}
+
+	remaining, deleted := pruneForFreeSpace(kept, 50, 100)
+	require.Len(t, deleted, 2)
+	assert.Equal(t, "old", deleted[0].Path)
+	assert.Equal(t, "mid", deleted[1].Path)
+	assert.Equal(t, []BackupFile{{Path: "new", Size: 30}}, remaining)
+}
+
+func TestRetentionNotConfigured(t *testing.T) {
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filepath.Join(t.TempDir(), "app.log"),
+		WithMaxBackups(0), WithMaxAge(0), WithCompress(false)))
+	defer logger.Close()
+
+	_, err := logger.ApplyRetention()
+	assert.Error(t, err)
+
+	// Planning without a policy reports nothing to do instead of failing
+	report, err := logger.PlanRetention()
+	require.NoError(t, err)
+	assert.Empty(t, report.Deleted)
+	assert.Empty(t, report.Compressed)
+}
+
+func TestCloseWaitsForRetentionPass(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	logger := NewRotatingLogger(GetDefaultRotateConfig(filepath.Join(t.TempDir(), "app.log"),
+		WithCompress(false), WithOnRetention(func(RetentionReport) {
+			once.Do(func() {
+				close(entered)
+				<-release
+			})
+		})))
+	<-entered
+
+	closed := make(chan struct{})
+	go func() {
+		_ = logger.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a retention pass was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+}
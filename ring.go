@@ -0,0 +1,315 @@
+// Package zlog provides an in-memory ring buffer of recent events with a query API
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultRingEvents is the number of events a RingBuffer keeps
+	defaultRingEvents = 1000
+	// ringSubscriberBuffer is the number of events a slow tail stream may lag behind
+	ringSubscriberBuffer = 256
+)
+
+// RingBufferConfig configures a RingBuffer
+type RingBufferConfig struct {
+	MaxEvents int // MaxEvents is the number of events kept, 1000 by default
+	MaxBytes  int // MaxBytes bounds the total size of the kept JSON events, 0 for no bound
+}
+
+// RingEvent is an event kept by a RingBuffer
+type RingEvent struct {
+	Seq     uint64                 // Seq numbers the events written to the buffer from 1
+	Time    time.Time              // Time is the time of the event
+	Level   string                 // Level is the level name, "notice" for Notice events and empty for events without level
+	Message string                 // Message is the message of the event
+	Logger  string                 // Logger is the logger name set with WithName or Named
+	TraceID string                 // TraceID is the trace_id field of the event
+	Fields  map[string]interface{} // Fields are the fields other than time, level and message
+	JSON    json.RawMessage        // JSON is the event as written by the logger
+}
+
+// RingFilter selects events of a RingBuffer; its zero value selects every event
+type RingFilter struct {
+	MinLevel hertzlog.Level // MinLevel is the lowest level selected
+	Since    time.Time      // Since excludes events before it when set
+	Until    time.Time      // Until excludes events after it when set
+	Logger   string         // Logger selects the events of one logger name when set
+	TraceID  string         // TraceID selects the events of one trace when set
+	Limit    int            // Limit keeps only the most recent matching events when positive
+}
+
+// RingBuffer keeps the most recent events in memory for debugging, e.g. to inspect the
+// last lines of a process during an incident without touching disk. Add it alongside the
+// normal output with WithSink; it implements http.Handler serving the events as NDJSON.
+type RingBuffer struct {
+	config RingBufferConfig
+
+	mu          sync.Mutex
+	events      []RingEvent // events holds the kept events from head on, oldest first
+	head        int
+	bytes       int
+	seq         uint64
+	subscribers map[chan RingEvent]struct{}
+}
+
+// NewRingBuffer creates an empty RingBuffer for config
+func NewRingBuffer(config RingBufferConfig) *RingBuffer {
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = defaultRingEvents
+	}
+	return &RingBuffer{config: config, subscribers: make(map[chan RingEvent]struct{})}
+}
+
+// Write implements the io.Writer interface. p is a JSON event of the logger; any other
+// output is kept as the message of an event without level.
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	e := decodeEvent(p)
+	event := RingEvent{Time: e.Time, Message: e.Message, Fields: e.Fields}
+	if e.Level != zerolog.NoLevel {
+		event.Level = e.Level.String()
+		if e.Notice {
+			event.Level = levelName(hertzlog.LevelNotice)
+		}
+	}
+	if name, ok := e.Fields[LoggerNameKey].(string); ok {
+		event.Logger = name
+	}
+	if id, ok := e.Fields["trace_id"].(string); ok {
+		event.TraceID = id
+	}
+	if raw := trimNewline(p); json.Valid(raw) {
+		event.JSON = append(json.RawMessage(nil), stripNotice(raw)...)
+	} else {
+		event.JSON, _ = json.Marshal(map[string]string{zerolog.MessageFieldName: e.Message})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	event.Seq = r.seq
+	r.events = append(r.events, event)
+	r.bytes += len(event.JSON)
+	for len(r.events)-r.head > r.config.MaxEvents ||
+		(r.config.MaxBytes > 0 && r.bytes > r.config.MaxBytes && len(r.events)-r.head > 1) {
+		r.bytes -= len(r.events[r.head].JSON)
+		r.events[r.head] = RingEvent{}
+		r.head++
+	}
+	// Reclaim the evicted slots once they outnumber the kept events
+	if r.head > len(r.events)/2 {
+		r.events = append(r.events[:0], r.events[r.head:]...)
+		r.head = 0
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Snapshot returns the kept events matching filter, oldest first
+func (r *RingBuffer) Snapshot(filter RingFilter) []RingEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []RingEvent
+	for _, e := range r.events[r.head:] {
+		if filter.matches(e) {
+			events = append(events, e)
+		}
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events
+}
+
+// Len returns the number of kept events
+func (r *RingBuffer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events) - r.head
+}
+
+// Reset discards the kept events
+func (r *RingBuffer) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events, r.head, r.bytes = nil, 0, 0
+}
+
+// subscribe returns the kept events matching filter and a channel receiving the events written afterwards
+func (r *RingBuffer) subscribe(filter RingFilter) ([]RingEvent, chan RingEvent) {
+	ch := make(chan RingEvent, ringSubscriberBuffer)
+	events := r.Snapshot(filter)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Events written between the snapshot and the subscription are sent on the channel
+	last := uint64(0)
+	if len(events) > 0 {
+		last = events[len(events)-1].Seq
+	}
+	for _, e := range r.events[r.head:] {
+		if e.Seq > last && filter.matches(e) {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+	r.subscribers[ch] = struct{}{}
+	return events, ch
+}
+
+// unsubscribe stops sending events to ch
+func (r *RingBuffer) unsubscribe(ch chan RingEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.subscribers, ch)
+}
+
+// matches reports whether an event satisfies every condition of the filter
+func (f RingFilter) matches(e RingEvent) bool {
+	if f.MinLevel > hertzlog.LevelTrace && e.Level != "" {
+		l, ok := parseLevelName(e.Level)
+		if !ok {
+			level, _ := zerolog.ParseLevel(e.Level)
+			l = fromZerologLevel(level)
+		}
+		if l < f.MinLevel {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Logger != "" && e.Logger != f.Logger {
+		return false
+	}
+	return f.TraceID == "" || e.TraceID == f.TraceID
+}
+
+// ServeHTTP implements the http.Handler interface, writing the matching events as NDJSON.
+// The query parameters level, since, until, logger, trace_id and limit build the filter;
+// since and until take RFC 3339 times or durations before now such as 5m. With follow=1
+// the response stays open and streams new matching events until the client disconnects.
+func (r *RingBuffer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseRingFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	follow, _ := strconv.ParseBool(req.URL.Query().Get("follow"))
+	if !follow {
+		for _, e := range r.Snapshot(filter) {
+			_ = writeRingEvent(w, e)
+		}
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	events, ch := r.subscribe(filter)
+	defer r.unsubscribe(ch)
+	for _, e := range events {
+		_ = writeRingEvent(w, e)
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case e := <-ch:
+			if filter.matches(e) {
+				if err := writeRingEvent(w, e); err != nil {
+					return
+				}
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// writeRingEvent writes an event as a line of NDJSON
+func writeRingEvent(w io.Writer, e RingEvent) error {
+	if _, err := w.Write(e.JSON); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
+
+// parseRingFilter builds a filter from the query parameters of a request
+func parseRingFilter(req *http.Request) (RingFilter, error) {
+	q := req.URL.Query()
+	filter := RingFilter{Logger: q.Get("logger"), TraceID: q.Get("trace_id")}
+	if s := q.Get("level"); s != "" {
+		level, ok := parseLevelName(s)
+		if !ok {
+			return filter, fmt.Errorf("unknown level %q", s)
+		}
+		filter.MinLevel = level
+	}
+	var err error
+	if filter.Since, err = parseRingTime(q.Get("since")); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseRingTime(q.Get("until")); err != nil {
+		return filter, err
+	}
+	if s := q.Get("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil {
+			return filter, fmt.Errorf("invalid limit %q", s)
+		}
+	}
+	return filter, nil
+}
+
+// parseRingTime parses an RFC 3339 time or a duration before now; an empty string is the zero time
+func parseRingTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
+
+// parseLevelName returns the level named s, e.g. "warn"
+func parseLevelName(s string) (hertzlog.Level, bool) {
+	for l := hertzlog.LevelTrace; l <= hertzlog.LevelFatal; l++ {
+		if levelName(l) == s {
+			return l, true
+		}
+	}
+	return hertzlog.LevelInfo, false
+}
+
+// SinkName returns the name statistics are reported under
+func (r *RingBuffer) SinkName() string {
+	return "ring"
+}
+
+// structured marks RingBuffer as decoding JSON events
+func (r *RingBuffer) structured() {}
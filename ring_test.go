@@ -0,0 +1,137 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRingBufferKeepsRecentEvents(t *testing.T) {
+	rb := NewRingBuffer(RingBufferConfig{MaxEvents: 3})
+	var out bytes.Buffer
+	logger := New(WithOutput(&out), WithSink(rb))
+
+	for _, msg := range []string{"one", "two", "three", "four", "five"} {
+		logger.Info(msg)
+	}
+	events := rb.Snapshot(RingFilter{})
+	require.Len(t, events, 3)
+	assert.Equal(t, "three", events[0].Message)
+	assert.Equal(t, "five", events[2].Message)
+	assert.Equal(t, uint64(5), events[2].Seq)
+	assert.Equal(t, "info", events[2].Level)
+	assert.Contains(t, string(events[2].JSON), `"message":"five"`)
+	assert.Equal(t, 5, strings.Count(out.String(), "\n"), "the normal output is unaffected")
+
+	rb.Reset()
+	assert.Zero(t, rb.Len())
+}
+
+func TestRingBufferBoundsBytes(t *testing.T) {
+	rb := NewRingBuffer(RingBufferConfig{MaxBytes: 40})
+	rb.Write([]byte(`{"message":"aaaaaaaaaa"}` + "\n"))
+	rb.Write([]byte(`{"message":"bbbbbbbbbb"}` + "\n"))
+	rb.Write([]byte("plain text\n"))
+	events := rb.Snapshot(RingFilter{})
+	require.Len(t, events, 1)
+	assert.Equal(t, "plain text", events[0].Message)
+	assert.Equal(t, `{"message":"plain text"}`, string(events[0].JSON))
+
+	rb.Write([]byte(`{"message":"` + strings.Repeat("x", 100) + `"}`))
+	assert.Equal(t, 1, rb.Len(), "the newest event is kept even when larger than MaxBytes")
+}
+
+func TestRingBufferSnapshotFilters(t *testing.T) {
+	rb := NewRingBuffer(RingBufferConfig{})
+	logger := New(WithOutput(rb), WithLevel(hertzlog.LevelTrace))
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	logger.Debug("debug")
+	logger.Notice("notice")
+	logger.Named("access").Warn("slow")
+	logger.Named("access").CtxErrorf(ctx, "failed")
+	logger.Info("info")
+
+	messages := func(f RingFilter) []string {
+		var msgs []string
+		for _, e := range rb.Snapshot(f) {
+			msgs = append(msgs, e.Message)
+		}
+		return msgs
+	}
+	assert.Equal(t, []string{"notice", "slow", "failed"}, messages(RingFilter{MinLevel: hertzlog.LevelNotice}))
+	assert.Equal(t, []string{"slow", "failed"}, messages(RingFilter{MinLevel: hertzlog.LevelWarn}))
+	assert.Equal(t, []string{"failed"}, messages(RingFilter{MinLevel: hertzlog.LevelError}))
+	assert.Equal(t, []string{"slow", "failed"}, messages(RingFilter{Logger: "access"}))
+	assert.Equal(t, []string{"failed"}, messages(RingFilter{TraceID: traceID.String()}))
+	assert.Equal(t, []string{"info"}, messages(RingFilter{Limit: 1}))
+	assert.Empty(t, messages(RingFilter{Since: time.Now().Add(time.Minute)}))
+	assert.Empty(t, messages(RingFilter{Until: time.Now().Add(-time.Minute)}))
+
+	notice := rb.Snapshot(RingFilter{})[1]
+	assert.Equal(t, "notice", notice.Level)
+	assert.NotContains(t, string(notice.JSON), NoticeKey)
+}
+
+func TestRingBufferHandler(t *testing.T) {
+	rb := NewRingBuffer(RingBufferConfig{})
+	logger := New(WithOutput(rb))
+	logger.Info("first")
+	logger.Named("db").Error("second")
+	server := httptest.NewServer(rb)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?level=error&since=1m")
+	require.NoError(t, err)
+	body := new(bytes.Buffer)
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(body.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"message":"second"`)
+
+	resp, err = http.Get(server.URL + "?level=loud")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestRingBufferHandlerFollows(t *testing.T) {
+	rb := NewRingBuffer(RingBufferConfig{})
+	logger := New(WithOutput(rb))
+	logger.Info("before")
+	server := httptest.NewServer(rb)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?follow=1&logger=api", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	logger.Info("ignored")
+	logger.Named("api").Info("streamed")
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, `"message":"streamed"`)
+	cancel()
+	assert.Eventually(t, func() bool {
+		rb.mu.Lock()
+		defer rb.mu.Unlock()
+		return len(rb.subscribers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
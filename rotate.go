@@ -7,9 +7,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // RotatingLogger provides log rotation functionality
@@ -27,6 +27,31 @@ type RotateConfig struct {
 	MaxAge     int    // MaxAge is the maximum number of days to retain old log files
 	Compress   bool   // Compress determines if the rotated log files should be compressed
 	LocalTime  bool   // LocalTime determines if the time used for formatting the timestamps in backup files is the computer's local time
+
+	// Additional retention and compression policies
+	MaxTotalSize    int                   // MaxTotalSize is the maximum total size in megabytes of all backups of the log file
+	MinFreeSpace    int                   // MinFreeSpace is the free space in megabytes to keep on the filesystem, the oldest backups are pruned below it
+	CompressAfter   int                   // CompressAfter is the number of days backups stay uncompressed before being compressed
+	RetentionDryRun bool                  // RetentionDryRun reports what retention would remove through OnRetention without touching any file
+	OnRetention     func(RetentionReport) // OnRetention is called with the outcome of every retention pass
+	Compression     *Compression          // Compression selects how rotated files are compressed, overriding Compress
+
+	// Lifecycle hooks run asynchronously and in order on a goroutine of the logger
+	OnRotate    func(RotateEvent)   // OnRotate is called after every rotation of the log file
+	OnCompress  func(CompressEvent) // OnCompress is called after every compression of a rotated file
+	OnDelete    func(DeleteEvent)   // OnDelete is called after retention removes a rotated file
+	OnHookError func(error)         // OnHookError receives errors of hooks, the archiver and background retention passes
+	Archiver    Archiver            // Archiver receives rotated files once compressed, to move them elsewhere
+
+	// Rotation triggers and file handling
+	RotationInterval time.Duration // RotationInterval also rotates the file at every boundary of the interval, aligned to midnight
+	BufferSize       int           // BufferSize is the size in bytes of the write buffer, 0 writes every event straight to the file
+	FlushInterval    time.Duration // FlushInterval bounds how long buffered events wait before being written, 1s by default
+	FileMode         os.FileMode   // FileMode is the permission of new log files, the mode of the previous file or 0600 by default
+	Owner            *FileOwner    // Owner is the owner of new log files, the owner of the previous file by default
+	MultiProcess     bool          // MultiProcess coordinates rotation with other processes writing the same file through an advisory lock
+	ExternalRotation bool          // ExternalRotation leaves rotation to an external tool such as logrotate, see NewReopenWriter
+	Clock            Clock         // Clock tells the time of rotation and retention decisions, the clock of the logger or the system clock by default
 }
 
 // EnsureDirectoryExists checks if the directory for the log file exists, and creates it if it doesn't
@@ -41,99 +66,57 @@ func EnsureDirectoryExists(filename string) error {
 	return nil
 }
 
-// safeLumberjackLogger wraps lumberjack.Logger to ensure directory exists before writing
-type safeLumberjackLogger struct {
-	*lumberjack.Logger
-	directoryEnsured bool
-	filename         string
-}
-
-// newSafeLumberjackLogger creates a new safeLumberjackLogger that ensures directory exists
-func newSafeLumberjackLogger(config *RotateConfig) *safeLumberjackLogger {
-	// Ensure directory exists before creating the logger
-	EnsureDirectoryExists(config.Filename)
-
-	return &safeLumberjackLogger{
-		Logger: &lumberjack.Logger{
-			Filename:   config.Filename,
-			MaxSize:    config.MaxSize,
-			MaxBackups: config.MaxBackups,
-			MaxAge:     config.MaxAge,
-			Compress:   config.Compress,
-			LocalTime:  config.LocalTime,
-		},
-		filename:         config.Filename,
-		directoryEnsured: true, // Since we ensured directory exists at creation
-	}
-}
-
-// ensureDirectory ensures the directory exists before any write operation
-func (s *safeLumberjackLogger) ensureDirectory() error {
-	if !s.directoryEnsured {
-		err := EnsureDirectoryExists(s.filename)
-		if err != nil {
-			return err
-		}
-		s.directoryEnsured = true
-	}
-	return nil
-}
-
-// Write implements the io.Writer interface with directory creation
-func (s *safeLumberjackLogger) Write(p []byte) (n int, err error) {
-	err = s.ensureDirectory()
-	if err != nil {
-		return 0, err
-	}
-	return s.Logger.Write(p)
-}
-
-// NewRotatingLogger creates a new logger with rotation capabilities
-func NewRotatingLogger(config *RotateConfig) *RotatingLogger {
-	sLumberjackLogger := newSafeLumberjackLogger(config)
+// NewRotatingLogger creates a new logger with rotation capabilities.
+// Additional options such as WithLevel or WithMetrics are applied to the underlying ZLogger.
+func NewRotatingLogger(config *RotateConfig, opts ...Option) *RotatingLogger {
+	writer := NewFileWriter(config)
 
-	// Create a new ZLogger with safe lumberjack writer using console format by default
-	zLogger := New(WithOutput(sLumberjackLogger), WithFormat(ConsoleFormat))
+	// Create a new ZLogger with the rotating file writer using console format by default
+	zLogger := New(append([]Option{WithOutput(writer), WithFormat(ConsoleFormat)}, opts...)...)
 
 	return &RotatingLogger{
 		baseLogger: zLogger,
-		writer:     sLumberjackLogger,
+		writer:     writer,
 		config:     config,
 	}
 }
 
 // NewRotatingLoggerWithFormat creates a new logger with rotation capabilities and specified format
-func NewRotatingLoggerWithFormat(config *RotateConfig, format FormatType) *RotatingLogger {
-	sLumberjackLogger := newSafeLumberjackLogger(config)
+func NewRotatingLoggerWithFormat(config *RotateConfig, format FormatType, opts ...Option) *RotatingLogger {
+	writer := NewFileWriter(config)
 
-	// Create a new ZLogger with safe lumberjack writer and specified format
-	zLogger := New(WithOutput(sLumberjackLogger), WithFormat(format))
+	// Create a new ZLogger with the rotating file writer and specified format
+	zLogger := New(append([]Option{WithOutput(writer), WithFormat(format)}, opts...)...)
 
 	return &RotatingLogger{
 		baseLogger: zLogger,
-		writer:     sLumberjackLogger,
+		writer:     writer,
 		config:     config,
 	}
 }
 
-// WithRotation is an option function that configures the logger with rotation
-func WithRotation(config *RotateConfig, output io.Writer) Option {
-	sLumberjackLogger := newSafeLumberjackLogger(config)
-	if output != nil {
-		iw := io.MultiWriter(sLumberjackLogger, output)
-		return WithOutput(iw)
-	} else {
-		iw := io.MultiWriter(sLumberjackLogger, os.Stdout)
-		return WithOutput(iw)
+// WithRotation is an option function that configures the logger with rotation.
+// The file is closed by ZLogger.Close.
+func WithRotation(rotationConfig *RotateConfig, output io.Writer) Option {
+	return func(c *config) {
+		writer := NewFileWriter(rotationConfig)
+		c.closers = append(c.closers, writer)
+		if output != nil {
+			c.output = newMultiSink(writer, output)
+		} else {
+			c.output = newMultiSink(writer, NamedWriter("stdout", os.Stdout))
+		}
 	}
 }
 
-// WithRotationAndFormat is an option function that configures the logger with rotation and format
+// WithRotationAndFormat is an option function that configures the logger with rotation and format.
+// The file is closed by ZLogger.Close.
 func WithRotationAndFormat(rotationConfig *RotateConfig, format FormatType) Option {
 	return func(c *config) {
-		sLumberjackLogger := newSafeLumberjackLogger(rotationConfig)
+		writer := NewFileWriter(rotationConfig)
+		c.closers = append(c.closers, writer)
 
-		c.output = sLumberjackLogger
+		c.output = writer
 		c.format = format
 	}
 }
@@ -169,6 +152,41 @@ func WithCompress(compress bool) RotateConfigOption {
 	}
 }
 
+// WithMaxTotalSize sets the maximum total size in megabytes of all backups of the log file
+func WithMaxTotalSize(maxTotalSize int) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.MaxTotalSize = maxTotalSize
+	}
+}
+
+// WithMinFreeSpace sets the free space in megabytes below which the oldest backups are pruned
+func WithMinFreeSpace(minFreeSpace int) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.MinFreeSpace = minFreeSpace
+	}
+}
+
+// WithCompressAfter sets the number of days backups stay uncompressed before being compressed
+func WithCompressAfter(days int) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.CompressAfter = days
+	}
+}
+
+// WithRetentionDryRun makes retention only report what it would delete or compress
+func WithRetentionDryRun(dryRun bool) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.RetentionDryRun = dryRun
+	}
+}
+
+// WithOnRetention sets the callback receiving the outcome of every retention pass
+func WithOnRetention(fn func(RetentionReport)) RotateConfigOption {
+	return func(c *RotateConfig) {
+		c.OnRetention = fn
+	}
+}
+
 // WithLocalTime sets whether to use local time for formatting timestamps in backup files
 func WithLocalTime(localTime bool) RotateConfigOption {
 	return func(c *RotateConfig) {
@@ -197,24 +215,56 @@ func GetDefaultRotateConfig(filename string, opts ...RotateConfigOption) *Rotate
 
 // Rotate manually rotates the log file
 func (rl *RotatingLogger) Rotate() error {
-	if lj, ok := rl.writer.(*safeLumberjackLogger); ok {
-		return lj.Rotate()
+	if fw, ok := rl.writer.(*FileWriter); ok {
+		return fw.Rotate()
 	}
-	if lj, ok := rl.writer.(*lumberjack.Logger); ok {
-		return lj.Rotate()
-	}
-	return fmt.Errorf("unable to rotate: writer is not a safeLumberjackLogger or lumberjack.Logger")
+	return fmt.Errorf("unable to rotate: writer is not a FileWriter")
+}
+
+// FileWriter returns the underlying rotating file writer for direct access
+func (rl *RotatingLogger) FileWriter() *FileWriter {
+	fw, _ := rl.writer.(*FileWriter)
+	return fw
+}
+
+// GetRotatingWriter returns the underlying rotating file writer. It returned a *lumberjack.Logger
+// before rotation was implemented natively; the FileWriter keeps its Write, Rotate and Close methods.
+//
+// Deprecated: use FileWriter.
+func (rl *RotatingLogger) GetRotatingWriter() *FileWriter {
+	return rl.FileWriter()
+}
+
+// Stats returns a snapshot of the logger's own telemetry, see ZLogger.Stats.
+// The current size of the log file is always reported, even without WithMetrics.
+func (rl *RotatingLogger) Stats() Stats {
+	s := rl.baseLogger.Stats()
+	s.Files[rl.config.Filename] = fileSize(rl.config.Filename)
+	return s
 }
 
-// GetRotatingWriter returns the underlying lumberjack writer for direct access
-func (rl *RotatingLogger) GetRotatingWriter() *lumberjack.Logger {
-	if lj, ok := rl.writer.(*safeLumberjackLogger); ok {
-		return lj.Logger
+// Reopen closes and reopens the log file, see FileWriter.Reopen
+func (rl *RotatingLogger) Reopen() error {
+	if fw, ok := rl.writer.(*FileWriter); ok {
+		return fw.Reopen()
 	}
-	if lj, ok := rl.writer.(*lumberjack.Logger); ok {
-		return lj
+	return fmt.Errorf("unable to reopen: writer is not a FileWriter")
+}
+
+// Flush blocks until queued events have been written, see ZLogger.Flush
+func (rl *RotatingLogger) Flush() error {
+	return rl.baseLogger.Flush()
+}
+
+// Close flushes the logger and closes the log file
+func (rl *RotatingLogger) Close() error {
+	err := rl.baseLogger.Close()
+	if fw, ok := rl.writer.(*FileWriter); ok {
+		if cerr := fw.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
 	}
-	return nil
+	return err
 }
 
 // SetLevel implements the Control interface for RotatingLogger
@@ -224,11 +274,8 @@ func (rl *RotatingLogger) SetLevel(level hertzlog.Level) {
 
 // SetOutput implements the Control interface for RotatingLogger
 func (rl *RotatingLogger) SetOutput(w io.Writer) {
-	// We typically don't want to change the output for rotating loggers
-	// but if we do, we'd need to handle this differently
-	// For now, just update the underlying logger with the new writer
-	newZLogger := New(WithOutput(w), WithLevel(rl.baseLogger.level))
-	rl.baseLogger = newZLogger
+	// The rotating file is still closed by Close
+	rl.baseLogger.SetOutput(w)
 }
 
 // Implement all the logging methods by delegating to the base logger
@@ -275,3 +322,23 @@ func (rl *RotatingLogger) CtxErrorf(ctx context.Context, format string, v ...int
 func (rl *RotatingLogger) CtxFatalf(ctx context.Context, format string, v ...interface{}) {
 	rl.baseLogger.CtxFatalf(ctx, format, v...)
 }
+
+// Error-aware methods, see ZLogger.ErrorErr
+func (rl *RotatingLogger) WarnErr(err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(nil, hertzlog.LevelWarn, err, msg, kv)
+}
+func (rl *RotatingLogger) ErrorErr(err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(nil, hertzlog.LevelError, err, msg, kv)
+}
+func (rl *RotatingLogger) FatalErr(err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(nil, hertzlog.LevelFatal, err, msg, kv)
+}
+func (rl *RotatingLogger) CtxWarnErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(ctx, hertzlog.LevelWarn, err, msg, kv)
+}
+func (rl *RotatingLogger) CtxErrorErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(ctx, hertzlog.LevelError, err, msg, kv)
+}
+func (rl *RotatingLogger) CtxFatalErr(ctx context.Context, err error, msg string, kv ...interface{}) {
+	rl.baseLogger.logErr(ctx, hertzlog.LevelFatal, err, msg, kv)
+}
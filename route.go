@@ -0,0 +1,236 @@
+// Package zlog provides routing of events to different files by level, logger name or field value
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+)
+
+// LoggerNameKey is the field holding the name set with WithName or Named
+const LoggerNameKey = "logger"
+
+// WithName sets the name of the logger, logged under LoggerNameKey and usable for routing
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// Named returns a logger writing to the same outputs whose events carry name under LoggerNameKey
+func (zl *ZLogger) Named(name string) *ZLogger {
+	child := zl.with(func(c zerolog.Context) zerolog.Context {
+		return c.Str(LoggerNameKey, name)
+	})
+	child.name = name
+	return child
+}
+
+// Route sends the events matching all of its rules to its own rotating file.
+// A route without rules receives every event.
+type Route struct {
+	config   *RotateConfig
+	output   io.Writer
+	levels   bool
+	minLevel hertzlog.Level
+	maxLevel hertzlog.Level
+	logger   string
+	field    string
+	value    string
+	fallback bool
+}
+
+// RouteOption adds a rule to a Route
+type RouteOption func(*Route)
+
+// NewRoute creates a route writing the events matching opts to the file described by config
+func NewRoute(config *RotateConfig, opts ...RouteOption) Route {
+	r := Route{config: config}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// NewWriterRoute creates a route writing the events matching opts to w instead of a rotating file
+func NewWriterRoute(w io.Writer, opts ...RouteOption) Route {
+	r := Route{output: w}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	return r
+}
+
+// RouteLevels restricts a route to the levels from min to max inclusive
+func RouteLevels(min, max hertzlog.Level) RouteOption {
+	return func(r *Route) {
+		r.levels, r.minLevel, r.maxLevel = true, min, max
+	}
+}
+
+// RouteLogger restricts a route to events of the logger with the given name, see WithName
+func RouteLogger(name string) RouteOption {
+	return func(r *Route) {
+		r.logger = name
+	}
+}
+
+// RouteField restricts a route to events whose field key renders as value
+func RouteField(key string, value interface{}) RouteOption {
+	return func(r *Route) {
+		r.field, r.value = key, fmt.Sprint(value)
+	}
+}
+
+// RouteFallback makes a route receive only the events no other non-fallback route with rules matched,
+// e.g. business logs next to a route for the "access" logger
+func RouteFallback() RouteOption {
+	return func(r *Route) {
+		r.fallback = true
+	}
+}
+
+// WithRouting dispatches events to the given routes, each writing to its own file in the
+// logger's format; it replaces the output of the logger. An event is written to every
+// route it matches. The files are closed by ZLogger.Close.
+func WithRouting(routes ...Route) Option {
+	return func(c *config) {
+		c.routes = routes
+	}
+}
+
+// routedSink is a route bound to its writers
+type routedSink struct {
+	Route
+	name string
+	sink io.Writer // sink is the destination of the route, instrumented when metrics are enabled
+	out  io.Writer // out renders events into sink in the logger's format
+}
+
+// router is the output of a logger configured with WithRouting. It receives events as JSON
+// and writes each one to the routes it matches.
+type router struct {
+	format  FormatType
+	console ConsoleConfig
+	sinks   []*routedSink
+	closers []io.Closer
+	// instrumented is set once the sinks report to the metrics, so that SetOutput leaves them alone
+	instrumented bool
+}
+
+// newRouter creates the files of routes and a router writing to them in format
+func newRouter(routes []Route, format FormatType, console ConsoleConfig) *router {
+	rt := &router{format: format, console: console}
+	for i, route := range routes {
+		s := &routedSink{Route: route, sink: route.output}
+		if route.config != nil {
+			fw := NewFileWriter(route.config)
+			rt.closers = append(rt.closers, fw)
+			s.sink = fw
+		}
+		s.name = sinkName(s.sink, fmt.Sprintf("route-%d", i))
+		rt.sinks = append(rt.sinks, s)
+		rt.bind(s)
+	}
+	return rt
+}
+
+// bind builds the formatting writer of s over its sink
+func (rt *router) bind(s *routedSink) {
+	if hasStructuredSink(s.sink) {
+		s.out = s.sink
+		return
+	}
+	if rt.format == JSONFormat {
+		s.out = &noticeWriter{Writer: s.sink}
+		return
+	}
+	s.out = newConsoleWriter(s.sink, rt.console)
+}
+
+// Write implements the io.Writer interface, returning the first error of the matched routes
+func (rt *router) Write(p []byte) (int, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return 0, fmt.Errorf("zlog: routing requires JSON events: %w", err)
+	}
+	zlevel := zerolog.NoLevel
+	if s, ok := fields[zerolog.LevelFieldName].(string); ok {
+		if l, err := zerolog.ParseLevel(s); err == nil {
+			zlevel = l
+		}
+	}
+	notice, _ := fields[NoticeKey].(bool)
+	level := eventLevel(zlevel, notice)
+
+	var err error
+	matched := false
+	for _, s := range rt.sinks {
+		if s.fallback || !s.matches(level, fields) {
+			continue
+		}
+		if s.hasRules() {
+			matched = true
+		}
+		_, werr := s.out.Write(p)
+		err = firstErr(err, werr)
+	}
+	if !matched {
+		for _, s := range rt.sinks {
+			if s.fallback && s.matches(level, fields) {
+				_, werr := s.out.Write(p)
+				err = firstErr(err, werr)
+			}
+		}
+	}
+	return len(p), err
+}
+
+// hasRules reports whether the route restricts the events it receives
+func (r *Route) hasRules() bool {
+	return r.levels || r.logger != "" || r.field != ""
+}
+
+// matches reports whether an event at level with fields satisfies every rule of the route
+func (r *Route) matches(level hertzlog.Level, fields map[string]interface{}) bool {
+	if r.levels && (level < r.minLevel || level > r.maxLevel) {
+		return false
+	}
+	if r.logger != "" && fields[LoggerNameKey] != r.logger {
+		return false
+	}
+	if r.field != "" {
+		v, ok := fields[r.field]
+		if !ok || fmt.Sprint(v) != r.value {
+			return false
+		}
+	}
+	return true
+}
+
+// structured marks the router as decoding events itself
+func (rt *router) structured() {}
+
+// Close closes the files created for the routes
+func (rt *router) Close() error {
+	var err error
+	for _, c := range rt.closers {
+		err = firstErr(err, c.Close())
+	}
+	return err
+}
+
+// instrument replaces the sink of every route by its instrumented version
+func (rt *router) instrument(r *metricsRecorder) {
+	if rt.instrumented {
+		return
+	}
+	rt.instrumented = true
+	for _, s := range rt.sinks {
+		s.sink = r.instrumentSink(s.sink, s.name)
+		rt.bind(s)
+	}
+}
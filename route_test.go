@@ -0,0 +1,103 @@
+package zlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingByLevel(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "app.log")
+	errorLog := filepath.Join(dir, "error.log")
+	logger := New(WithFormat(JSONFormat), WithRouting(
+		NewRoute(GetDefaultRotateConfig(appLog)),
+		NewRoute(GetDefaultRotateConfig(errorLog), RouteLevels(hertzlog.LevelError, hertzlog.LevelFatal)),
+	))
+	logger.Info("started")
+	logger.Warn("slow")
+	logger.Error("failed")
+	require.NoError(t, logger.Close())
+
+	app := readFile(t, appLog)
+	assert.Equal(t, 3, strings.Count(app, "\n"))
+	errs := readFile(t, errorLog)
+	assert.Equal(t, 1, strings.Count(errs, "\n"))
+	assert.Contains(t, errs, `"message":"failed"`)
+}
+
+func TestRoutingByLoggerName(t *testing.T) {
+	var access, business bytes.Buffer
+	logger := New(WithName("app"), WithRouting(
+		NewWriterRoute(&access, RouteLogger("access")),
+		NewWriterRoute(&business, RouteFallback()),
+	))
+	logger.Named("access").Info("GET /health")
+	logger.Info("order created")
+
+	assert.Contains(t, access.String(), "GET /health")
+	assert.NotContains(t, access.String(), "order created")
+	assert.Contains(t, business.String(), "order created")
+	assert.NotContains(t, business.String(), "GET /health")
+	// Routes render events in the logger's format
+	assert.Contains(t, business.String(), "info ")
+	assert.Contains(t, business.String(), "logger=app")
+}
+
+func TestRoutingByField(t *testing.T) {
+	var audit, all bytes.Buffer
+	logger := New(WithFormat(JSONFormat), WithRouting(
+		NewWriterRoute(&audit, RouteField("category", "audit")),
+		NewWriterRoute(&all),
+	))
+	logger.WarnErr(nil, "permission changed", "category", "audit")
+	logger.Info("unrelated")
+
+	assert.Equal(t, 1, strings.Count(audit.String(), "\n"))
+	assert.Contains(t, audit.String(), "permission changed")
+	assert.Equal(t, 2, strings.Count(all.String(), "\n"))
+}
+
+func TestRouteLevelsNotice(t *testing.T) {
+	var notice, warn bytes.Buffer
+	logger := New(WithFormat(JSONFormat), WithRouting(
+		NewWriterRoute(&notice, RouteLevels(hertzlog.LevelNotice, hertzlog.LevelNotice)),
+		NewWriterRoute(&warn, RouteLevels(hertzlog.LevelWarn, hertzlog.LevelWarn)),
+	))
+	logger.Notice("noticed")
+	logger.Warn("warned")
+	logger.Info("ignored")
+	assert.Contains(t, notice.String(), "noticed")
+	assert.NotContains(t, notice.String(), "warned")
+	assert.NotContains(t, notice.String(), "ignored")
+	assert.Contains(t, warn.String(), "warned")
+	assert.NotContains(t, warn.String(), "noticed")
+}
+
+func TestRoutingMetricsAndClose(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "app.log")
+	errorLog := filepath.Join(dir, "error.log")
+	logger := New(WithMetrics(nil), WithAsync(16), WithRouting(
+		NewRoute(GetDefaultRotateConfig(appLog)),
+		NewRoute(GetDefaultRotateConfig(errorLog), RouteLevels(hertzlog.LevelError, hertzlog.LevelFatal)),
+	))
+	logger.Error("failed")
+	require.NoError(t, logger.Flush())
+
+	stats := logger.Stats()
+	assert.Contains(t, stats.Files, appLog)
+	assert.Contains(t, stats.Files, errorLog)
+	assert.Equal(t, uint64(1), stats.Sinks[errorLog].Writes)
+
+	require.NoError(t, logger.Close())
+	info, err := os.Stat(errorLog)
+	require.NoError(t, err)
+	assert.Greater(t, info.Size(), int64(0))
+}
@@ -0,0 +1,438 @@
+// Package zlog provides a syslog output speaking RFC 5424 and RFC 3164
+package zlog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultSyslogSocket is the local syslog socket used when no address is configured
+	defaultSyslogSocket = "/dev/log"
+	// defaultSyslogBuffer is the number of messages kept while disconnected
+	defaultSyslogBuffer = 1000
+	// defaultSyslogMaxBackoff bounds the delay between reconnection attempts
+	defaultSyslogMaxBackoff = 30 * time.Second
+	// syslogMinBackoff is the delay before the first reconnection attempt
+	syslogMinBackoff = 100 * time.Millisecond
+	// syslogTimeout bounds how long dialing and writing a message may take
+	syslogTimeout = 5 * time.Second
+	// DefaultSyslogSDID is the structured data ID zlog fields are sent under in RFC 5424 messages
+	DefaultSyslogSDID = "zlog@32473"
+)
+
+// SyslogFormat is the message format of a SyslogWriter
+type SyslogFormat int
+
+const (
+	// RFC5424 is the structured syslog format; event fields become structured data
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is the traditional BSD syslog format; event fields are appended to the message
+	RFC3164
+)
+
+// Facility is a syslog facility
+type Facility int
+
+// Syslog facilities
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityLocal0 Facility = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Severity is a syslog severity
+type Severity int
+
+// Syslog severities
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// SyslogSeverity returns the syslog severity of a hertz log level
+func SyslogSeverity(level hertzlog.Level) Severity {
+	switch level {
+	case hertzlog.LevelTrace, hertzlog.LevelDebug:
+		return SeverityDebug
+	case hertzlog.LevelInfo:
+		return SeverityInfo
+	case hertzlog.LevelNotice:
+		return SeverityNotice
+	case hertzlog.LevelWarn:
+		return SeverityWarning
+	case hertzlog.LevelError:
+		return SeverityError
+	case hertzlog.LevelFatal:
+		return SeverityCritical
+	default:
+		return SeverityInfo
+	}
+}
+
+// severityOf returns the syslog severity of a decoded event
+func severityOf(e logEvent) Severity {
+	if e.Notice {
+		return SeverityNotice
+	}
+	switch e.Level {
+	case zerolog.WarnLevel:
+		return SeverityWarning
+	case zerolog.PanicLevel:
+		return SeverityAlert
+	case zerolog.NoLevel:
+		return SeverityInfo
+	}
+	return SyslogSeverity(fromZerologLevel(e.Level))
+}
+
+// SyslogConfig configures a SyslogWriter
+type SyslogConfig struct {
+	Network    string        // Network is "udp", "tcp", "tls" or "unix"; empty with an empty Address selects the local syslog socket
+	Address    string        // Address is the host:port of the server or the path of the unix socket
+	TLSConfig  *tls.Config   // TLSConfig is used with the "tls" network
+	Format     SyslogFormat  // Format is RFC5424 by default
+	Facility   Facility      // Facility defaults to FacilityUser; kernel messages cannot be sent
+	AppName    string        // AppName defaults to the name of the executable
+	ProcID     string        // ProcID defaults to the process id
+	Hostname   string        // Hostname defaults to os.Hostname
+	SDID       string        // SDID is the structured data ID of RFC 5424 messages, DefaultSyslogSDID by default
+	BufferSize int           // BufferSize is the number of messages kept while disconnected, 1000 by default
+	MaxBackoff time.Duration // MaxBackoff bounds the delay between reconnection attempts, 30 seconds by default
+}
+
+// SyslogWriter sends events to a syslog server. It decodes the JSON events of the logger,
+// maps their level to a severity and frames stream connections with octet counting (RFC 6587).
+// While the server is unreachable messages are buffered, dropping the oldest, and the
+// connection is retried in the background with exponential backoff.
+type SyslogWriter struct {
+	config  SyslogConfig
+	network string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending [][]byte
+	closed  bool
+
+	dropped   atomic.Uint64
+	metrics   atomic.Pointer[metricsRecorder]
+	reconnect chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewSyslogWriter creates a SyslogWriter for config and connects to the server. Only an invalid
+// configuration is an error; an unreachable server is retried in the background.
+func NewSyslogWriter(config SyslogConfig) (*SyslogWriter, error) {
+	network := config.Network
+	switch network {
+	case "":
+		if config.Address == "" {
+			config.Address = defaultSyslogSocket
+		}
+		network = "unix"
+	case "udp", "tcp", "tls", "unix":
+	default:
+		return nil, fmt.Errorf("zlog: unsupported syslog network %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, errors.New("zlog: syslog address is required")
+	}
+	if config.Facility == FacilityKern {
+		config.Facility = FacilityUser
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.ProcID == "" {
+		config.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.SDID == "" {
+		config.SDID = DefaultSyslogSDID
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultSyslogBuffer
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultSyslogMaxBackoff
+	}
+
+	s := &SyslogWriter{
+		config:    config,
+		network:   network,
+		reconnect: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.run()
+	if err := s.connect(); err != nil {
+		s.reconnect <- struct{}{}
+	}
+	return s, nil
+}
+
+// Write implements the io.Writer interface. p is a JSON event of the logger; any other
+// output is sent as the message of an info event.
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	msg := s.format(decodeEvent(p))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrWriterClosed
+	}
+	if s.conn != nil && len(s.pending) == 0 {
+		if err := s.send(msg); err == nil {
+			return len(p), nil
+		}
+		s.disconnect()
+	}
+	s.buffer(msg)
+	return len(p), nil
+}
+
+// format renders an event as a syslog message
+func (s *SyslogWriter) format(e logEvent) []byte {
+	pri := int(s.config.Facility)*8 + int(severityOf(e))
+	var b strings.Builder
+	if s.config.Format == RFC3164 {
+		fmt.Fprintf(&b, "<%d>%s %s %s[%s]: %s", pri, e.Time.Format(time.Stamp),
+			orNil(s.config.Hostname), s.config.AppName, s.config.ProcID, e.Message)
+		for _, k := range e.keys() {
+			fmt.Fprintf(&b, " %s=%s", k, fieldString(e.Fields[k]))
+		}
+		return []byte(b.String())
+	}
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s - ", pri, e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		orNil(truncate(s.config.Hostname, 255)), orNil(truncate(s.config.AppName, 48)), orNil(truncate(s.config.ProcID, 128)))
+	if len(e.Fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + s.config.SDID)
+		for _, k := range e.keys() {
+			fmt.Fprintf(&b, ` %s="%s"`, sdName(k), sdEscaper.Replace(fieldString(e.Fields[k])))
+		}
+		b.WriteString("]")
+	}
+	if e.Message != "" {
+		b.WriteString(" " + e.Message)
+	}
+	return []byte(b.String())
+}
+
+// sdEscaper escapes the characters RFC 5424 reserves in structured data values
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// sdName turns a field name into a valid structured data parameter name
+func sdName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	return truncate(name, 32)
+}
+
+// orNil returns s, or the RFC 5424 nil value for an empty header field
+func orNil(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// stream reports whether messages are sent over a stream connection and need framing
+func (s *SyslogWriter) stream() bool {
+	return s.network == "tcp" || s.network == "tls"
+}
+
+// send writes a single message to the connection; s.mu must be held
+func (s *SyslogWriter) send(msg []byte) error {
+	if s.stream() {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+// buffer keeps msg until the connection is back, dropping the oldest message when full; s.mu must be held
+func (s *SyslogWriter) buffer(msg []byte) {
+	if len(s.pending) >= s.config.BufferSize {
+		s.pending = s.pending[1:]
+		s.recordDropped()
+	}
+	s.pending = append(s.pending, msg)
+}
+
+// disconnect closes the connection and wakes the reconnection loop; s.mu must be held
+func (s *SyslogWriter) disconnect() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	select {
+	case s.reconnect <- struct{}{}:
+	default:
+	}
+}
+
+// dial opens a connection to the server
+func (s *SyslogWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	switch s.network {
+	case "tls":
+		return tls.DialWithDialer(dialer, "tcp", s.config.Address, s.config.TLSConfig)
+	case "unix":
+		conn, err := dialer.Dial("unixgram", s.config.Address)
+		if err != nil {
+			return dialer.Dial("unix", s.config.Address)
+		}
+		return conn, nil
+	}
+	return dialer.Dial(s.network, s.config.Address)
+}
+
+// connect dials the server and sends the buffered messages
+func (s *SyslogWriter) connect() error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return conn.Close()
+	}
+	s.conn = conn
+	for len(s.pending) > 0 {
+		if err := s.send(s.pending[0]); err != nil {
+			_ = conn.Close()
+			s.conn = nil
+			return err
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
+
+// run reconnects with exponential backoff every time the connection is lost
+func (s *SyslogWriter) run() {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.reconnect:
+		case <-s.done:
+			return
+		}
+		for backoff := syslogMinBackoff; ; backoff = min(backoff*2, s.config.MaxBackoff) {
+			select {
+			case <-time.After(backoff):
+			case <-s.done:
+				return
+			}
+			if s.connect() == nil {
+				break
+			}
+		}
+	}
+}
+
+// recordDropped counts a message lost because the buffer was full
+func (s *SyslogWriter) recordDropped() {
+	s.dropped.Add(1)
+	if m := s.metrics.Load(); m != nil {
+		m.recordDropped()
+	}
+}
+
+// setMetrics attaches a recorder counting messages dropped while disconnected
+func (s *SyslogWriter) setMetrics(m *metricsRecorder) {
+	s.metrics.Store(m)
+}
+
+// Dropped returns the number of messages dropped because the buffer was full while disconnected
+func (s *SyslogWriter) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Buffered returns the number of messages waiting for the connection
+func (s *SyslogWriter) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// SinkName returns the name statistics are reported under
+func (s *SyslogWriter) SinkName() string {
+	return "syslog"
+}
+
+// structured marks SyslogWriter as decoding JSON events
+func (s *SyslogWriter) structured() {}
+
+// Close stops reconnecting and closes the connection; messages still buffered are lost
+func (s *SyslogWriter) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.conn != nil {
+		err = s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+	close(s.done)
+	<-s.stopped
+	return err
+}
@@ -0,0 +1,231 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readDatagrams collects the messages received on a packet connection
+func readDatagrams(conn net.PacketConn) <-chan string {
+	ch := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				close(ch)
+				return
+			}
+			ch <- string(buf[:n])
+		}
+	}()
+	return ch
+}
+
+// readOctetCounted collects the octet-counted messages received by a listener
+func readOctetCounted(l net.Listener) <-chan string {
+	ch := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					size, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(size))
+					msg := make([]byte, n)
+					if _, err := io.ReadFull(r, msg); err != nil {
+						return
+					}
+					ch <- string(msg)
+				}
+			}()
+		}
+	}()
+	return ch
+}
+
+// receive waits for the next message on ch
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+		return ""
+	}
+}
+
+func TestSyslogRFC5424OverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+
+	w, err := NewSyslogWriter(SyslogConfig{Network: "udp", Address: conn.LocalAddr().String(),
+		Facility: FacilityLocal0, AppName: "billing", ProcID: "42", Hostname: "host1"})
+	require.NoError(t, err)
+	defer w.Close()
+	logger := New(WithOutput(w), WithLevel(hertzlog.LevelTrace), WithStackTrace())
+
+	logger.ErrorErr(errors.New("declined"), "charge failed", "order", `a"b]`, "amount", 3)
+	msg := receive(t, received)
+	assert.Regexp(t, `^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ host1 billing 42 - `, msg)
+	assert.True(t, strings.HasSuffix(msg, ` [zlog@32473 amount="3" error.message="declined" error.type="*errors.errorString" order="a\"b\]"] charge failed`), msg)
+
+	// local0 is facility 16: Trace and Debug are debug, Notice is notice although logged at warn level
+	for _, tc := range []struct {
+		log func(...interface{})
+		pri string
+	}{
+		{logger.Trace, "<135>"}, {logger.Debug, "<135>"}, {logger.Info, "<134>"},
+		{logger.Notice, "<133>"}, {logger.Warn, "<132>"}, {logger.Error, "<131>"},
+	} {
+		tc.log("x")
+		assert.True(t, strings.HasPrefix(receive(t, received), tc.pri), tc.pri)
+	}
+}
+
+func TestNoticeKeyOnlyReachesDecodingOutputs(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+	w, err := NewSyslogWriter(SyslogConfig{Network: "udp", Address: conn.LocalAddr().String(), Facility: FacilityLocal0})
+	require.NoError(t, err)
+	defer w.Close()
+
+	out := &toggleWriter{}
+	var sink, fallback, routed bytes.Buffer
+	logger := New(WithOutput(out), WithFormat(JSONFormat), WithSink(&sink), WithSink(w),
+		WithFallback(&fallback, 1, time.Hour), WithDiagnosticOutput(io.Discard))
+	logger.Notice("noted")
+	assert.True(t, strings.HasPrefix(receive(t, received), "<133>"), "syslog still sends the notice severity")
+	out.broken.Store(true)
+	logger.Notice("noted")
+
+	routedLogger := New(WithFormat(JSONFormat), WithRouting(NewWriterRoute(&routed)))
+	routedLogger.Notice("noted")
+
+	for name, b := range map[string]*bytes.Buffer{"output": &out.Buffer, "sink": &sink, "fallback": &fallback, "route": &routed} {
+		assert.Contains(t, b.String(), `"message":"noted"}`, name)
+		assert.NotContains(t, b.String(), NoticeKey, name)
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	assert.Equal(t, SeverityDebug, SyslogSeverity(hertzlog.LevelTrace))
+	assert.Equal(t, SeverityDebug, SyslogSeverity(hertzlog.LevelDebug))
+	assert.Equal(t, SeverityInfo, SyslogSeverity(hertzlog.LevelInfo))
+	assert.Equal(t, SeverityNotice, SyslogSeverity(hertzlog.LevelNotice))
+	assert.Equal(t, SeverityWarning, SyslogSeverity(hertzlog.LevelWarn))
+	assert.Equal(t, SeverityError, SyslogSeverity(hertzlog.LevelError))
+	assert.Equal(t, SeverityCritical, SyslogSeverity(hertzlog.LevelFatal))
+}
+
+func TestSyslogRFC3164OverUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+
+	w, err := NewSyslogWriter(SyslogConfig{Network: "unix", Address: path, Format: RFC3164,
+		AppName: "billing", ProcID: "42", Hostname: "host1"})
+	require.NoError(t, err)
+	defer w.Close()
+	logger := New(WithOutput(w))
+	logger.WarnErr(errors.New("locked"), "login", "user", "u1")
+
+	assert.Regexp(t, `^<12>\w{3} [ \d]\d \d\d:\d\d:\d\d host1 billing\[42\]: login error.message=locked error.type=\*errors.errorString user=u1$`, receive(t, received))
+}
+
+func TestSyslogTCPReconnectsAndBuffers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	received := readOctetCounted(l)
+
+	w, err := NewSyslogWriter(SyslogConfig{Network: "tcp", Address: addr, MaxBackoff: 200 * time.Millisecond})
+	require.NoError(t, err)
+	defer w.Close()
+	_, err = w.Write([]byte(`{"level":"info","message":"first"}`))
+	require.NoError(t, err)
+	assert.Contains(t, receive(t, received), "first")
+
+	// The server goes away: writes fail eventually and are buffered
+	l.Close()
+	w.mu.Lock()
+	w.disconnect()
+	w.mu.Unlock()
+	_, err = w.Write([]byte(`{"level":"info","message":"while down"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, w.Buffered())
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer l.Close()
+	received = readOctetCounted(l)
+	assert.Contains(t, receive(t, received), "while down")
+	assert.Eventually(t, func() bool { return w.Buffered() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestSyslogBufferDropsOldest(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	w, err := NewSyslogWriter(SyslogConfig{Network: "tcp", Address: addr, BufferSize: 2})
+	require.NoError(t, err)
+	defer w.Close()
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(`{"message":"event"}`))
+	}
+	assert.Equal(t, 2, w.Buffered())
+	assert.Equal(t, uint64(1), w.Dropped())
+}
+
+func TestSyslogSinkWithConsoleFormat(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	received := readDatagrams(conn)
+	w, err := NewSyslogWriter(SyslogConfig{Network: "udp", Address: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer w.Close()
+
+	var console bytes.Buffer
+	logger := New(WithOutput(&console), WithSink(w))
+	logger.Warn("disk almost full")
+
+	assert.Contains(t, console.String(), "warn   disk almost full")
+	assert.NotContains(t, console.String(), "{")
+	assert.True(t, strings.HasPrefix(receive(t, received), "<12>1 "))
+}
+
+func TestSyslogConfigValidation(t *testing.T) {
+	_, err := NewSyslogWriter(SyslogConfig{Network: "sctp", Address: "localhost:514"})
+	assert.Error(t, err)
+	_, err = NewSyslogWriter(SyslogConfig{Network: "udp"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+// Package zlog provides composable writers for log outputs
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+)
+
+// NamedWriter wraps w so that its statistics are reported under name
+func NamedWriter(name string, w io.Writer) io.Writer {
+	return &namedWriter{name: name, Writer: w}
+}
+
+// namedWriter attaches a sink name to an io.Writer
+type namedWriter struct {
+	name string
+	io.Writer
+}
+
+// SinkName returns the name statistics are reported under
+func (n *namedWriter) SinkName() string {
+	return n.name
+}
+
+// multiSink writes every event to all of its sinks, unlike io.MultiWriter it does not stop at the first failure
+type multiSink struct {
+	writers []io.Writer
+}
+
+// newMultiSink creates a writer that duplicates its writes to all provided writers
+func newMultiSink(writers ...io.Writer) *multiSink {
+	return &multiSink{writers: writers}
+}
+
+// Write implements the io.Writer interface
+func (m *multiSink) Write(p []byte) (n int, err error) {
+	for _, w := range m.writers {
+		if _, werr := w.Write(p); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// childWriters returns the writers that w forwards its writes to
+func childWriters(w io.Writer) []io.Writer {
+	switch s := w.(type) {
+	case *multiSink:
+		return s.writers
+	case *namedWriter:
+		return []io.Writer{s.Writer}
+	case *meteredWriter:
+		return []io.Writer{s.Writer}
+	case *droppedCounter:
+		return []io.Writer{s.Writer}
+	case *AsyncWriter:
+		return []io.Writer{s.out}
+	case *failoverWriter:
+		if s.fallback == nil {
+			return []io.Writer{s.primary}
+		}
+		return []io.Writer{s.primary, s.fallback}
+	case *DurableWriter:
+		return []io.Writer{s.currentSink()}
+	case *zerolog.ConsoleWriter:
+		return []io.Writer{s.Out}
+	case *noticeWriter:
+		return []io.Writer{s.Writer}
+	case *router:
+		children := make([]io.Writer, len(s.sinks))
+		for i, sink := range s.sinks {
+			children[i] = sink.sink
+		}
+		return children
+	}
+	return nil
+}
+
+// walkWriters calls fn for w and every writer reachable through it, parents first
+func walkWriters(w io.Writer, fn func(io.Writer)) {
+	if w == nil {
+		return
+	}
+	fn(w)
+	for _, child := range childWriters(w) {
+		walkWriters(child, fn)
+	}
+}
+
+// structuredSink is implemented by outputs that decode events, such as SyslogWriter. The logger
+// hands them JSON whatever its format and renders the console format for the other outputs.
+type structuredSink interface {
+	structured()
+}
+
+// EventDecoder is implemented by outputs that decode the events they receive, such as the
+// observer of zlogtest. Like the structured sinks of zlog they receive JSON whatever the format
+// of the logger, and Notice events keep their NoticeKey field, which other outputs never see.
+type EventDecoder interface {
+	DecodesEvents()
+}
+
+// isStructured reports whether w decodes the events it receives
+func isStructured(w io.Writer) bool {
+	switch w.(type) {
+	case structuredSink, EventDecoder:
+		return true
+	}
+	return false
+}
+
+// hasStructuredSink reports whether a structured sink is reachable through w
+func hasStructuredSink(w io.Writer) bool {
+	found := false
+	walkWriters(w, func(child io.Writer) {
+		if isStructured(child) {
+			found = true
+		}
+	})
+	return found
+}
+
+// renderConsole returns w with every output below it that is not a structured sink
+// receiving events in the console format
+func renderConsole(w io.Writer, console ConsoleConfig) io.Writer {
+	if !hasStructuredSink(w) {
+		return newConsoleWriter(w, console)
+	}
+	if m, ok := w.(*multiSink); ok {
+		writers := make([]io.Writer, len(m.writers))
+		for i, child := range m.writers {
+			writers[i] = renderConsole(child, console)
+		}
+		return newMultiSink(writers...)
+	}
+	return w
+}
+
+// noticeField is the NoticeKey field as zerolog writes it
+var noticeField = []byte(`"` + NoticeKey + `":true`)
+
+// noticeWriter removes the NoticeKey field from the events written to an output that does not decode them
+type noticeWriter struct {
+	io.Writer
+}
+
+// Write implements the io.Writer interface
+func (w *noticeWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write(stripNotice(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// hideNotice returns w with every output below it that does not decode events receiving them
+// without the NoticeKey field
+func hideNotice(w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	if _, ok := w.(*zerolog.ConsoleWriter); ok {
+		// The console format leaves the field out itself
+		return w
+	}
+	if !hasStructuredSink(w) {
+		return &noticeWriter{Writer: w}
+	}
+	if m, ok := w.(*multiSink); ok {
+		writers := make([]io.Writer, len(m.writers))
+		for i, child := range m.writers {
+			writers[i] = hideNotice(child)
+		}
+		return newMultiSink(writers...)
+	}
+	return w
+}
+
+// stripNotice returns the JSON event p without its NoticeKey field
+func stripNotice(p []byte) []byte {
+	i := bytes.Index(p, noticeField)
+	if i < 0 {
+		return p
+	}
+	j := i + len(noticeField)
+	if i > 0 && p[i-1] == ',' {
+		i--
+	} else if j < len(p) && p[j] == ',' {
+		j++
+	}
+	return append(append(make([]byte, 0, len(p)-(j-i)), p[:i]...), p[j:]...)
+}
+
+// eventLevel returns the hertz level of an event, telling the Notice events from the Warn ones
+func eventLevel(level zerolog.Level, notice bool) hertzlog.Level {
+	if level == zerolog.WarnLevel && !notice {
+		return hertzlog.LevelWarn
+	}
+	return fromZerologLevel(level)
+}
+
+// logEvent is a JSON event decoded by a structured sink
+type logEvent struct {
+	Level   zerolog.Level
+	Time    time.Time
+	Message string
+	Notice  bool                   // Notice is set for the warn events logged with Notice
+	Fields  map[string]interface{} // Fields holds every field but the level, time, message and NoticeKey
+}
+
+// decodeEvent decodes a JSON event written by zerolog. Output that is not JSON becomes the
+// message of an event without level.
+func decodeEvent(p []byte) logEvent {
+	e := logEvent{Level: zerolog.NoLevel, Time: time.Now()}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&e.Fields); err != nil || e.Fields == nil {
+		e.Message, e.Fields = strings.TrimRight(string(p), "\n"), map[string]interface{}{}
+		return e
+	}
+	if s, ok := e.Fields[zerolog.LevelFieldName].(string); ok {
+		if l, err := zerolog.ParseLevel(s); err == nil {
+			e.Level = l
+		}
+		delete(e.Fields, zerolog.LevelFieldName)
+	}
+	if s, ok := e.Fields[zerolog.TimestampFieldName].(string); ok {
+		if t, err := time.Parse(zerolog.TimeFieldFormat, s); err == nil {
+			e.Time = t
+		}
+		delete(e.Fields, zerolog.TimestampFieldName)
+	}
+	if s, ok := e.Fields[zerolog.MessageFieldName].(string); ok {
+		e.Message = s
+		delete(e.Fields, zerolog.MessageFieldName)
+	}
+	if notice, ok := e.Fields[NoticeKey].(bool); ok {
+		e.Notice = notice
+		delete(e.Fields, NoticeKey)
+	}
+	return e
+}
+
+// keys returns the field names of the event in order
+func (e logEvent) keys() []string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldString renders a decoded field value, strings without quotes and everything else as JSON
+func fieldString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
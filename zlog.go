@@ -7,7 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
@@ -22,6 +23,11 @@ const (
 	ReqIDKey = "X-Request-ID"
 )
 
+// NoticeKey marks the events logged with Notice, which zerolog writes at warn level, so that
+// outputs decoding events such as syslog, journald, GELF and routes can tell them from Warn.
+// It is removed from the events written as JSON to the other outputs.
+const NoticeKey = "zlog.notice"
+
 // Logger defines the core logging interface with basic log levels
 type Logger interface {
 	Trace(v ...interface{})
@@ -86,14 +92,60 @@ func GetLogFormat(f string) FormatType {
 	return ConsoleFormat
 }
 
-// ZLogger implements the FullLogger interface using zerolog
+// ZLogger implements the FullLogger interface using zerolog. SetLevel and SetOutput swap the
+// core shared with the loggers derived by Named, so they are safe while other goroutines log.
 type ZLogger struct {
+	state *loggerState
+	// name is the logger name its events are counted under, see WithName and Named
+	name string
+	// fields are the context fields of this logger on top of the core, e.g. its name
+	fields atomic.Pointer[[]contextField]
+	// bound caches the logger of the current core with the fields applied
+	bound atomic.Pointer[boundLogger]
+}
+
+// loggerState holds what a logger shares with the loggers derived from it
+type loggerState struct {
+	core atomic.Pointer[core]
+	// mu serializes SetLevel and SetOutput
+	mu  sync.Mutex
+	cfg *config
+	//tp     trace.TracerProvider
+	metrics *metricsRecorder
+	sampler zerolog.Sampler
+	router  *router
+	// closers are the writers created by the logger itself outside of the chain, released by Close
+	closers []io.Closer
+	// retired are the async writers of the chains replaced by SetOutput, released by Close
+	retired     []io.Closer
+	stackLevels levelSet
+	caller      *callerHook
+}
+
+// core is the immutable result of assembling a logger from its options, level and output
+type core struct {
 	logger zerolog.Logger
 	level  hertzlog.Level
-	format FormatType
-	out    io.Writer
-	//tp     trace.TracerProvider
+	chain  *outputChain
+	flight *flightRecorder
+}
 
+// outputChain is the chain of writers built from the options around the output
+type outputChain struct {
+	out        io.Writer // out is the top of the chain, written by the logger
+	jsonEvents bool      // jsonEvents is set when out receives JSON events even in ConsoleFormat
+	async      *AsyncWriter
+	durable    *DurableWriter
+}
+
+// contextField adds a field to the context of a derived logger
+type contextField func(zerolog.Context) zerolog.Context
+
+// boundLogger is the zerolog logger of a core with the fields of a ZLogger applied
+type boundLogger struct {
+	core   *core
+	fields *[]contextField
+	logger zerolog.Logger
 }
 
 // Ensure ZLogger implements FullLogger interface
@@ -106,6 +158,8 @@ func New(options ...Option) *ZLogger {
 		level:           hertzlog.LevelInfo,
 		format:          ConsoleFormat, // Default to console format
 		loggerEnrichers: []func(zerolog.Logger) zerolog.Logger{},
+		stackLevels:     newLevelSet(defaultStackLevels),
+		clock:           SystemClock,
 		//tp:              trace.NewNoopTracerProvider(),
 	}
 
@@ -113,61 +167,173 @@ func New(options ...Option) *ZLogger {
 		opt(cfg)
 	}
 
-	var zlogger zerolog.Logger
-	var zctx = zerolog.Context{}
-	switch cfg.format {
-	case JSONFormat:
-		// JSON format - default zerolog behavior with caller info
-		zctx = zerolog.New(cfg.output).Level(toZerologLevel(cfg.level)).With().Timestamp()
-	case ConsoleFormat:
-		// Console format - human readable with RFC3339 time format, caller info and custom format
-		consoleWriter := &zerolog.ConsoleWriter{
-			Out:        cfg.output,
-			TimeFormat: time.DateTime,
-			NoColor:    true,
-			FormatLevel: func(i interface{}) string {
-				// Ensure full level name is shown instead of 3-letter abbreviation
-				if ll, ok := i.(string); ok {
-					return fmt.Sprintf("%-6s", strings.ToLower(ll))
-				}
-				return fmt.Sprintf("%-6s", strings.ToLower(fmt.Sprintf("%s", i)))
-			},
+	state := &loggerState{
+		cfg:         cfg,
+		metrics:     cfg.metrics,
+		stackLevels: cfg.stackLevels,
+		caller:      newCallerHook(cfg),
+		sampler:     cfg.sampler,
+		closers:     cfg.closers,
+		//tp:     cfg.tp,
+	}
+	if len(cfg.routes) > 0 {
+		state.router = newRouter(cfg.routes, cfg.format, cfg.console)
+		state.closers = append(state.closers, state.router)
+	}
+	if cfg.clock != SystemClock {
+		if s, ok := cfg.sampler.(interface{ setDefaultClock(Clock) }); ok {
+			s.setDefaultClock(cfg.clock)
 		}
-		zctx = zerolog.New(consoleWriter).Level(toZerologLevel(cfg.level)).With().Timestamp()
-	default:
-		// Default to console format with customization
-		consoleWriter := &zerolog.ConsoleWriter{
-			Out:        cfg.output,
-			NoColor:    true,
-			TimeFormat: time.DateTime,
-			FormatLevel: func(i interface{}) string {
-				// Ensure full level name is shown instead of 3-letter abbreviation
-				if ll, ok := i.(string); ok {
-					return fmt.Sprintf("%-6s", strings.ToLower(ll))
-				}
-				return fmt.Sprintf("%-6s", strings.ToLower(fmt.Sprintf("%s", i)))
-			},
+	}
+	state.core.Store(state.newCore(state.buildChain(cfg.output, nil), cfg.level, nil))
+	return &ZLogger{state: state, name: cfg.name}
+}
+
+// buildChain builds the writers of the options around output. The write-ahead buffer of a
+// previous chain is reused, delivering to the new chain, as its directory cannot be opened twice.
+func (s *loggerState) buildChain(output io.Writer, durable *DurableWriter) *outputChain {
+	cfg := s.cfg
+	chain := &outputChain{durable: durable}
+	if s.router != nil {
+		// The routes replace the output of the logger
+		output = s.router
+	}
+	if len(cfg.sinks) > 0 {
+		output = newMultiSink(append([]io.Writer{output}, cfg.sinks...)...)
+	}
+	// Outputs that decode events receive JSON, the others are rendered in the console format below them
+	chain.jsonEvents = cfg.format == JSONFormat
+	if !chain.jsonEvents && hasStructuredSink(output) {
+		output = renderConsole(output, cfg.console)
+		chain.jsonEvents = true
+	}
+	if chain.jsonEvents {
+		// Only the outputs decoding events see the NoticeKey field
+		output = hideNotice(output)
+	}
+	// The write-ahead buffer sits right above the output, so that only events the output
+	// accepted count as delivered; the failover and the queue would acknowledge lost ones
+	if cfg.durableDir != "" {
+		sink := output
+		if cfg.metrics != nil {
+			sink = cfg.metrics.instrumentSink(output, DefaultOutputSinkName)
 		}
-		zctx = zerolog.New(consoleWriter).Level(toZerologLevel(cfg.level)).With().Timestamp()
+		if chain.durable != nil {
+			if err := chain.durable.setSink(sink); err != nil {
+				fmt.Fprintf(os.Stderr, "zlog: failed to flush the previous output: %v\n", err)
+			}
+			output = chain.durable
+		} else if dw, err := NewDurableWriter(cfg.durableDir, sink, append(cfg.durableOptions, withDurableDiagnostics(cfg.diagnosticOutput()))...); err != nil {
+			fmt.Fprintf(os.Stderr, "zlog: durable buffer disabled: %v\n", err)
+		} else {
+			chain.durable = dw
+			output = dw
+		}
+	}
+	if cfg.errorHandler != nil || cfg.fallback != nil {
+		output = newFailoverWriter(output, cfg)
+	}
+	if cfg.async {
+		if cfg.metrics != nil {
+			output = cfg.metrics.instrumentSink(output, DefaultOutputSinkName)
+		}
+		chain.async = NewAsyncWriter(output, cfg.asyncQueueSize)
+		output = chain.async
+	}
+	if cfg.metrics != nil {
+		output = cfg.metrics.instrument(output)
+	}
+	if cfg.clock != SystemClock {
+		applyClock(output, cfg.clock)
+	}
+	chain.out = output
+	return chain
+}
 
+// newCore assembles the logger writing to chain at level from the options passed to New.
+// A flight recorder of a previous core is reused, keeping the events it buffered.
+func (s *loggerState) newCore(chain *outputChain, level hertzlog.Level, flight *flightRecorder) *core {
+	cfg := s.cfg
+	// JSON format - default zerolog behavior; routes and structured sinks render events themselves.
+	// Console format - human readable with DateTime time format and full level names
+	eventWriter := chain.out
+	if !chain.jsonEvents {
+		eventWriter = newConsoleWriter(chain.out, cfg.console)
+	}
+	zlevel := toZerologLevel(level)
+	if flight != nil {
+		flight.setNext(eventWriter)
+	} else if cfg.flightRecorder != nil {
+		flight = newFlightRecorder(eventWriter, *cfg.flightRecorder, level, cfg.clock, s.metrics)
+	}
+	if flight != nil {
+		eventWriter, zlevel = flight, flight.loggerLevel()
 	}
-	if cfg.skipFrameCount > 0 {
+	zctx := withTimestamp(zerolog.New(eventWriter).Level(zlevel), cfg.clock)
+	if cfg.name != "" {
+		zctx = zctx.Str(LoggerNameKey, cfg.name)
+	}
+	if cfg.skipFrameCount > 0 && !cfg.caller {
 		zctx = zctx.CallerWithSkipFrameCount(cfg.skipFrameCount)
 	}
 
-	zlogger = zctx.Logger()
+	zlogger := zctx.Logger()
 
 	// Apply any additional logger enrichments
 	for _, enricher := range cfg.loggerEnrichers {
 		zlogger = enricher(zlogger)
 	}
+	zlogger = applyInstrumentation(zlogger, s.metrics, s.sampler, s.caller, flight)
+	return &core{logger: zlogger, level: level, chain: chain, flight: flight}
+}
 
-	return &ZLogger{
-		logger: zlogger,
-		level:  cfg.level,
-		format: cfg.format,
-		//tp:     cfg.tp,
+// core returns the current core of the logger
+func (zl *ZLogger) core() *core {
+	return zl.state.core.Load()
+}
+
+// current returns the zerolog logger events are written with, following SetLevel and SetOutput
+func (zl *ZLogger) current() *zerolog.Logger {
+	c := zl.state.core.Load()
+	fields := zl.fields.Load()
+	if b := zl.bound.Load(); b != nil && b.core == c && b.fields == fields {
+		return &b.logger
+	}
+	b := &boundLogger{core: c, fields: fields, logger: c.logger}
+	if fields != nil && len(*fields) > 0 {
+		zctx := c.logger.With()
+		for _, field := range *fields {
+			zctx = field(zctx)
+		}
+		b.logger = zctx.Logger()
 	}
+	if m := zl.state.metrics; m != nil {
+		// Events are counted per logger name, so the counting hook is bound here rather than in the core
+		var hook zerolog.Hook = m.eventHook(zl.name)
+		if c.flight != nil {
+			hook = flightHook{Hook: hook, flight: c.flight}
+		}
+		b.logger = b.logger.Hook(hook)
+	}
+	zl.bound.Store(b)
+	return &b.logger
+}
+
+// with returns a logger sharing the core of zl whose events also carry field
+func (zl *ZLogger) with(field contextField) *ZLogger {
+	child := &ZLogger{state: zl.state, name: zl.name}
+	child.fields.Store(appendField(zl.fields.Load(), field))
+	return child
+}
+
+// appendField returns a copy of fields followed by field
+func appendField(fields *[]contextField, field contextField) *[]contextField {
+	var out []contextField
+	if fields != nil {
+		out = append(out, *fields...)
+	}
+	out = append(out, field)
+	return &out
 }
 
 // Option configures the logger
@@ -179,9 +345,34 @@ type config struct {
 	level  hertzlog.Level
 	//tp     trace.TracerProvider
 	format         FormatType
-	skipFrameCount int
+	skipFrameCount int // skipFrameCount is the zerolog caller skip of CallerWithSkipFrameCount
+	caller         bool
+	callerSkip     int
+	callerMode     CallerMode
+	callerFunction bool
 	// Functions to customize the base logger after initial setup
-	loggerEnrichers []func(zerolog.Logger) zerolog.Logger
+	loggerEnrichers  []func(zerolog.Logger) zerolog.Logger
+	metrics          *metricsRecorder
+	sampler          zerolog.Sampler
+	async            bool
+	asyncQueueSize   int
+	stackLevels      levelSet
+	name             string
+	routes           []Route
+	errorHandler     ErrorHandler
+	fallback         io.Writer
+	fallbackFailures int
+	fallbackRetry    time.Duration
+	diagnostics      io.Writer
+	diagnosticsSet   bool
+	sinks            []io.Writer
+	durableDir       string
+	durableOptions   []DurableOption
+	flightRecorder   *FlightRecorderConfig
+	clock            Clock
+	console          ConsoleConfig
+	// closers are the writers created by options, released by ZLogger.Close
+	closers []io.Closer
 }
 
 // WithOutput sets the output writer for the logger
@@ -191,6 +382,13 @@ func WithOutput(output io.Writer) Option {
 	}
 }
 
+// WithSink adds w as an additional output receiving every event next to the main output
+func WithSink(w io.Writer) Option {
+	return func(c *config) {
+		c.sinks = append(c.sinks, w)
+	}
+}
+
 // WithLevel sets the log level for the logger
 func WithLevel(level hertzlog.Level) Option {
 	return func(c *config) {
@@ -216,12 +414,6 @@ func WithFormat(format FormatType) Option {
 	}
 }
 
-func CallerWithSkipFrameCount(skipFrameCount int) Option {
-	return func(c *config) {
-		c.skipFrameCount = skipFrameCount
-	}
-}
-
 // WithZerologOptions sets additional zerolog options using enricher functions
 func WithZerologOptions(enrichers ...func(zerolog.Logger) zerolog.Logger) Option {
 	return func(c *config) {
@@ -271,60 +463,65 @@ func fromZerologLevel(level zerolog.Level) hertzlog.Level {
 
 // Implementation of Logger interface methods
 func (zl *ZLogger) Trace(v ...interface{}) {
-	zl.logger.Trace().Msg(fmt.Sprint(v...))
+	zl.current().Trace().Msg(fmt.Sprint(v...))
 }
 
 func (zl *ZLogger) Debug(v ...interface{}) {
-	zl.logger.Debug().Msg(fmt.Sprint(v...))
+	zl.current().Debug().Msg(fmt.Sprint(v...))
 }
 
 func (zl *ZLogger) Info(v ...interface{}) {
-	zl.logger.Info().Msg(fmt.Sprint(v...))
+	zl.current().Info().Msg(fmt.Sprint(v...))
+}
+
+// notice starts a Notice event: a warn event marked with NoticeKey
+func (zl *ZLogger) notice() *zerolog.Event {
+	return zl.current().Warn().Bool(NoticeKey, true)
 }
 
 func (zl *ZLogger) Notice(v ...interface{}) {
-	zl.logger.Warn().Msg(fmt.Sprint(v...)) // Map Notice to Warn level
+	zl.notice().Msg(fmt.Sprint(v...))
 }
 
 func (zl *ZLogger) Warn(v ...interface{}) {
-	zl.logger.Warn().Msg(fmt.Sprint(v...))
+	zl.current().Warn().Msg(fmt.Sprint(v...))
 }
 
 func (zl *ZLogger) Error(v ...interface{}) {
-	zl.logger.Error().Msg(fmt.Sprint(v...))
+	zl.current().Error().Msg(fmt.Sprint(v...))
 }
 
 func (zl *ZLogger) Fatal(v ...interface{}) {
-	zl.logger.Fatal().Msg(fmt.Sprint(v...))
+	zl.current().Fatal().Msg(fmt.Sprint(v...))
 }
 
 // Implementation of FormatLogger interface methods
 func (zl *ZLogger) Tracef(format string, v ...interface{}) {
-	zl.logger.Trace().Msgf(format, v...)
+	zl.current().Trace().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Debugf(format string, v ...interface{}) {
-	zl.logger.Debug().Msgf(format, v...)
+	zl.current().Debug().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Infof(format string, v ...interface{}) {
-	zl.logger.Info().Msgf(format, v...)
+	zl.current().Info().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Noticef(format string, v ...interface{}) {
-	zl.logger.Warn().Msgf(format, v...) // Map Noticef to Warnf level
+	zl.notice().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Warnf(format string, v ...interface{}) {
-	zl.logger.Warn().Msgf(format, v...)
+	zl.current().Warn().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Errorf(format string, v ...interface{}) {
-	zl.logger.Error().Msgf(format, v...)
+	zl.current().Error().Msgf(format, v...)
 }
 
 func (zl *ZLogger) Fatalf(format string, v ...interface{}) {
-	zl.logger.Fatal().Msgf(format, v...)
+	zl.current().Fatal().Msgf(format, v...)
 }
 
 // Implementation of CtxLogger interface methods
@@ -333,7 +530,7 @@ func (zl *ZLogger) CtxTracef(ctx context.Context, format string, v ...interface{
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Trace()
+	logEvt := zl.current().Trace()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -355,7 +552,7 @@ func (zl *ZLogger) CtxDebugf(ctx context.Context, format string, v ...interface{
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Debug()
+	logEvt := zl.current().Debug()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -377,7 +574,7 @@ func (zl *ZLogger) CtxInfof(ctx context.Context, format string, v ...interface{}
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Info()
+	logEvt := zl.current().Info()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -399,7 +596,7 @@ func (zl *ZLogger) CtxNoticef(ctx context.Context, format string, v ...interface
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Warn() // Map Notice to Warn level
+	logEvt := zl.notice()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -421,7 +618,7 @@ func (zl *ZLogger) CtxWarnf(ctx context.Context, format string, v ...interface{}
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Warn()
+	logEvt := zl.current().Warn()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -443,7 +640,7 @@ func (zl *ZLogger) CtxErrorf(ctx context.Context, format string, v ...interface{
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Error()
+	logEvt := zl.current().Error()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -469,7 +666,7 @@ func (zl *ZLogger) CtxFatalf(ctx context.Context, format string, v ...interface{
 	// For now, we'll call the basic logger with OTel fields
 	fields := zl.getOtelFields(ctx)
 
-	logEvt := zl.logger.Fatal()
+	logEvt := zl.current().Fatal()
 	for k, v := range fields {
 		logEvt = logEvt.Str(k, fmt.Sprintf("%v", v))
 	}
@@ -563,44 +760,60 @@ func getContextFields(ctx context.Context) map[string]interface{} {
 }
 
 // Implementation of Control interface methods
-func (zl *ZLogger) SetLevel(level hertzlog.Level) {
-	zl.level = level
-	zl.logger = zl.logger.Level(toZerologLevel(level))
-}
 
+// SetLevel changes the level of the logger and of the loggers derived from it
+func (zl *ZLogger) SetLevel(level hertzlog.Level) {
+	s := zl.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *s.core.Load()
+	c.level = level
+	if c.flight != nil {
+		c.flight.setLevel(level)
+		c.logger = c.logger.Level(c.flight.loggerLevel())
+	} else {
+		c.logger = c.logger.Level(toZerologLevel(level))
+	}
+	s.core.Store(&c)
+}
+
+// SetOutput replaces the output of the logger and of the loggers derived from it. The chain
+// of writers is rebuilt from the options passed to New around w: sinks, failover, async and
+// durable output, metrics and the clock. The routes of WithRouting replace the output, so a
+// routed logger keeps writing to its routes. Events queued for the previous output still reach
+// it; the writers created by the logger are released by Close.
 func (zl *ZLogger) SetOutput(w io.Writer) {
-	// Rebuild logger with the same configuration but new output
-	switch zl.format {
-	case JSONFormat:
-		// JSON format - default zerolog behavior with caller info
-		zl.logger = zerolog.New(w).Level(toZerologLevel(zl.level)).With().Timestamp().CallerWithSkipFrameCount(3).Logger()
-	case ConsoleFormat:
-		// Console format - human readable with RFC3339 time format, caller info and custom format
-		consoleWriter := &zerolog.ConsoleWriter{
-			Out:        w,
-			TimeFormat: time.DateTime,
-			FormatLevel: func(i interface{}) string {
-				// Ensure full level name is shown instead of 3-letter abbreviation
-				if ll, ok := i.(string); ok {
-					return fmt.Sprintf("%-6s", strings.ToUpper(ll))
-				}
-				return fmt.Sprintf("%-6s", strings.ToUpper(fmt.Sprintf("%s", i)))
-			},
+	s := zl.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.core.Load()
+	if old.chain.async != nil {
+		// The events queued so far go to the old output, before the buffer below is retargeted
+		_ = old.chain.async.Flush()
+	}
+	s.core.Store(s.newCore(s.buildChain(w, old.chain.durable), old.level, old.flight))
+	if old.chain.async != nil {
+		_ = old.chain.async.Flush()
+		s.retired = append(s.retired, old.chain.async)
+	}
+}
+
+// applyInstrumentation attaches the sampler and the caller hook to logger; the hook counting
+// events is bound per logger name by current. With a flight recorder, the events it buffers
+// skip the sampler and are counted once written; the caller hook still runs so that they carry
+// their caller when flushed.
+func applyInstrumentation(logger zerolog.Logger, metrics *metricsRecorder, sampler zerolog.Sampler, caller *callerHook, flight *flightRecorder) zerolog.Logger {
+	if sampler != nil {
+		if metrics != nil {
+			sampler = metrics.sampler(sampler)
 		}
-		zl.logger = zerolog.New(consoleWriter).Level(toZerologLevel(zl.level)).With().Timestamp().CallerWithSkipFrameCount(3).Logger()
-	default:
-		// Default to console format
-		consoleWriter := &zerolog.ConsoleWriter{
-			Out:        w,
-			TimeFormat: time.RFC3339,
-			FormatLevel: func(i interface{}) string {
-				// Ensure full level name is shown instead of 3-letter abbreviation
-				if ll, ok := i.(string); ok {
-					return fmt.Sprintf("%-6s", strings.ToUpper(ll))
-				}
-				return fmt.Sprintf("%-6s", strings.ToUpper(fmt.Sprintf("%s", i)))
-			},
+		if flight != nil {
+			sampler = &flightSampler{Sampler: sampler, flight: flight}
 		}
-		zl.logger = zerolog.New(consoleWriter).Level(toZerologLevel(zl.level)).With().Timestamp().CallerWithSkipFrameCount(3).Logger()
+		logger = logger.Sample(sampler)
+	}
+	if caller != nil {
+		logger = logger.Hook(caller)
 	}
+	return logger
 }
@@ -42,8 +42,8 @@ func TestFormatTypes(t *testing.T) {
 	assert.Regexp(t, `^\s*\{.*\}\s*$`, strings.TrimSpace(jsonOutput))
 
 	// Test that format is correctly stored
-	assert.Equal(t, ConsoleFormat, consoleLogger.format)
-	assert.Equal(t, JSONFormat, jsonLogger.format)
+	assert.Equal(t, ConsoleFormat, consoleLogger.state.cfg.format)
+	assert.Equal(t, JSONFormat, jsonLogger.state.cfg.format)
 }
 
 func TestSetOutputPreservesFormat(t *testing.T) {
@@ -2,6 +2,7 @@ package zlog
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 )
 
@@ -27,8 +28,9 @@ func TestZLogger(t *testing.T) {
 
 func TestRotatingLogger(t *testing.T) {
 	// Test rotating logger
-	config := GetDefaultRotateConfig("test.log")
+	config := GetDefaultRotateConfig(filepath.Join(t.TempDir(), "test.log"))
 	rotatingLogger := NewRotatingLogger(config)
+	defer rotatingLogger.Close()
 
 	rotatingLogger.Info("Test rotating logger")
 	rotatingLogger.Infof("Test formatted rotating logger: %s", "info")
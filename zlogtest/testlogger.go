@@ -0,0 +1,130 @@
+// Package zlogtest provides a logger writing to the test log and golden file comparison
+package zlogtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/v-mars/zlog"
+)
+
+// UpdateGoldenEnv is the environment variable making AssertGolden rewrite the golden files
+const UpdateGoldenEnv = "ZLOGTEST_UPDATE"
+
+// testWriter writes every line to the log of a test until the test ends
+type testWriter struct {
+	t    testing.TB
+	mu   sync.Mutex
+	done bool
+}
+
+// Write implements the io.Writer interface
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Logging after the test ended panics, e.g. from an asynchronous output
+	if !w.done {
+		w.t.Helper()
+		w.t.Log(strings.TrimRight(string(p), "\n"))
+	}
+	return len(p), nil
+}
+
+// NewTestLogger creates a logger writing through t.Log, so its output only shows for failing
+// tests or with go test -v. The logger is closed when the test ends.
+func NewTestLogger(t testing.TB, opts ...zlog.Option) *zlog.ZLogger {
+	w := &testWriter{t: t}
+	logger := zlog.New(append(opts, zlog.WithOutput(w))...)
+	t.Cleanup(func() {
+		_ = logger.Close()
+		w.mu.Lock()
+		w.done = true
+		w.mu.Unlock()
+	})
+	return logger
+}
+
+// Clock is a zlog.Clock for tests that only moves when told to; pass it to zlog.WithClock
+// or RotateConfig.Clock to make timestamps, rotation and sampling deterministic
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock creates a Clock stopped at now. Console output renders times in time.Local;
+// pass a time in time.Local to keep it independent of the time zone.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now implements the zlog.Clock interface
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Add moves the clock forward by d and returns the new time
+func (c *Clock) Add(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// AssertGolden compares got with the golden file testdata/name.golden, reporting the
+// difference as an error. With ZLOGTEST_UPDATE=1 the golden file is written instead.
+func AssertGolden(t testing.TB, name string, got []byte) bool {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("zlogtest: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("zlogtest: %v", err)
+		}
+		return true
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("zlogtest: %v (run with %s=1 to create it)", err, UpdateGoldenEnv)
+	}
+	if bytes.Equal(got, want) {
+		return true
+	}
+	t.Errorf("zlogtest: output differs from %s:\n%s", path, diffLines(string(want), string(got)))
+	return false
+}
+
+// diffLines renders the lines that differ between want and got
+func diffLines(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "  line %d:\n    - %s\n    + %s\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,288 @@
+// Package zlogtest provides helpers to capture and assert the events of a zlog logger in tests
+package zlogtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/rs/zerolog"
+	"github.com/v-mars/zlog"
+)
+
+// Entry is an event recorded by an Observer
+type Entry struct {
+	Time      time.Time              // Time is the time of the event
+	Level     hertzlog.Level         // Level is the level of the event, LevelNotice for Notice events
+	Message   string                 // Message is the message of the event
+	Logger    string                 // Logger is the logger name set with WithName or Named
+	Caller    string                 // Caller is the caller field added by WithCaller
+	RequestID string                 // RequestID is the request ID added by the Ctx* methods
+	TraceID   string                 // TraceID is the trace ID added by the Ctx* methods
+	SpanID    string                 // SpanID is the span ID added by the Ctx* methods
+	Fields    map[string]interface{} // Fields are the other fields, numbers decoded as json.Number
+}
+
+// Observer records the events of a logger as entries
+type Observer struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewObserver creates a logger at LevelTrace recording its events in the returned Observer.
+// opts are applied before the output and format of the observer, e.g. to set a level or name.
+func NewObserver(opts ...zlog.Option) (*zlog.ZLogger, *Observer) {
+	o := &Observer{}
+	options := append([]zlog.Option{zlog.WithLevel(hertzlog.LevelTrace)}, opts...)
+	options = append(options, zlog.WithOutput(o), zlog.WithFormat(zlog.JSONFormat))
+	return zlog.New(options...), o
+}
+
+// DecodesEvents implements the zlog.EventDecoder interface, so that the observer tells Notice events from Warn
+func (o *Observer) DecodesEvents() {}
+
+// Write implements the io.Writer interface, recording the JSON event p
+func (o *Observer) Write(p []byte) (int, error) {
+	e, err := decodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = append(o.entries, e)
+	return len(p), nil
+}
+
+// decodeEntry decodes a JSON event
+func decodeEntry(p []byte) (Entry, error) {
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return Entry{}, fmt.Errorf("zlogtest: decode event: %w", err)
+	}
+	take := func(key string) string {
+		v, ok := fields[key]
+		if !ok {
+			return ""
+		}
+		delete(fields, key)
+		return fmt.Sprint(v)
+	}
+	e := Entry{
+		Level:     parseLevel(take(zerolog.LevelFieldName)),
+		Message:   take(zerolog.MessageFieldName),
+		Logger:    take(zlog.LoggerNameKey),
+		Caller:    take(zerolog.CallerFieldName),
+		RequestID: take(zlog.LogIDKey),
+		TraceID:   take("trace_id"),
+		SpanID:    take("span_id"),
+	}
+	if notice, _ := fields[zlog.NoticeKey].(bool); notice && e.Level == hertzlog.LevelWarn {
+		e.Level = hertzlog.LevelNotice
+	}
+	delete(fields, zlog.NoticeKey)
+	e.Fields = fields
+	if ts := take(zerolog.TimestampFieldName); ts != "" {
+		e.Time, _ = time.Parse(zerolog.TimeFieldFormat, ts)
+	}
+	return e, nil
+}
+
+// parseLevel returns the level of a level field
+func parseLevel(s string) hertzlog.Level {
+	switch s {
+	case "trace":
+		return hertzlog.LevelTrace
+	case "debug":
+		return hertzlog.LevelDebug
+	case "warn":
+		return hertzlog.LevelWarn
+	case "error":
+		return hertzlog.LevelError
+	case "fatal", "panic":
+		return hertzlog.LevelFatal
+	default:
+		return hertzlog.LevelInfo
+	}
+}
+
+// Entries returns the recorded entries in order
+func (o *Observer) Entries() []Entry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Entry(nil), o.entries...)
+}
+
+// Filter returns the recorded entries matching every filter
+func (o *Observer) Filter(filters ...Filter) []Entry {
+	var matched []Entry
+	for _, e := range o.Entries() {
+		if matchAll(e, filters) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Len returns the number of recorded entries
+func (o *Observer) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Reset discards the recorded entries
+func (o *Observer) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries = nil
+}
+
+// Filter selects entries
+type Filter func(Entry) bool
+
+// matchAll reports whether e satisfies every filter
+func matchAll(e Entry, filters []Filter) bool {
+	for _, f := range filters {
+		if !f(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// Level selects the entries at level
+func Level(level hertzlog.Level) Filter {
+	return func(e Entry) bool { return e.Level == level }
+}
+
+// MinLevel selects the entries at level or above
+func MinLevel(level hertzlog.Level) Filter {
+	return func(e Entry) bool { return e.Level >= level }
+}
+
+// Message selects the entries with message msg
+func Message(msg string) Filter {
+	return func(e Entry) bool { return e.Message == msg }
+}
+
+// MessageContains selects the entries whose message contains s
+func MessageContains(s string) Filter {
+	return func(e Entry) bool { return strings.Contains(e.Message, s) }
+}
+
+// Field selects the entries with field key equal to value, compared in their printed form
+// so that Field("status", 200) matches the decoded number
+func Field(key string, value interface{}) Filter {
+	want := fmt.Sprint(value)
+	return func(e Entry) bool {
+		v, ok := e.Fields[key]
+		return ok && fmt.Sprint(v) == want
+	}
+}
+
+// HasField selects the entries with field key
+func HasField(key string) Filter {
+	return func(e Entry) bool {
+		_, ok := e.Fields[key]
+		return ok
+	}
+}
+
+// Logger selects the entries of the logger named name
+func Logger(name string) Filter {
+	return func(e Entry) bool { return e.Logger == name }
+}
+
+// RequestID selects the entries logged for the request id
+func RequestID(id string) Filter {
+	return func(e Entry) bool { return e.RequestID == id }
+}
+
+// TraceID selects the entries logged for the trace id
+func TraceID(id string) Filter {
+	return func(e Entry) bool { return e.TraceID == id }
+}
+
+// AssertLogged reports an error unless an entry matches every filter
+func AssertLogged(t testing.TB, o *Observer, filters ...Filter) bool {
+	t.Helper()
+	if len(o.Filter(filters...)) > 0 {
+		return true
+	}
+	t.Errorf("zlogtest: no matching entry was logged; recorded entries:\n%s", o.dump())
+	return false
+}
+
+// AssertNotLogged reports an error when an entry matches every filter
+func AssertNotLogged(t testing.TB, o *Observer, filters ...Filter) bool {
+	t.Helper()
+	matched := o.Filter(filters...)
+	if len(matched) == 0 {
+		return true
+	}
+	t.Errorf("zlogtest: %d unexpected matching entries were logged:\n%s", len(matched), dumpEntries(matched))
+	return false
+}
+
+// RequireNoErrors stops the test when an entry at LevelError or above was logged
+func RequireNoErrors(t testing.TB, o *Observer) {
+	t.Helper()
+	if errs := o.Filter(MinLevel(hertzlog.LevelError)); len(errs) > 0 {
+		t.Fatalf("zlogtest: %d errors were logged:\n%s", len(errs), dumpEntries(errs))
+	}
+}
+
+// dump renders the recorded entries for a failure message
+func (o *Observer) dump() string {
+	entries := o.Entries()
+	if len(entries) == 0 {
+		return "  (none)"
+	}
+	return dumpEntries(entries)
+}
+
+// dumpEntries renders entries one per line
+func dumpEntries(entries []Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "  %s %q", levelName(e.Level), e.Message)
+		keys := make([]string, 0, len(e.Fields))
+		for k := range e.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %s=%v", k, e.Fields[k])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// levelName returns the name of a level
+func levelName(level hertzlog.Level) string {
+	switch level {
+	case hertzlog.LevelTrace:
+		return "trace"
+	case hertzlog.LevelDebug:
+		return "debug"
+	case hertzlog.LevelNotice:
+		return "notice"
+	case hertzlog.LevelWarn:
+		return "warn"
+	case hertzlog.LevelError:
+		return "error"
+	case hertzlog.LevelFatal:
+		return "fatal"
+	default:
+		return "info"
+	}
+}
@@ -0,0 +1,158 @@
+package zlogtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	hertzlog "github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/v-mars/zlog"
+)
+
+// fakeTB records the failures and log lines of assertions under test
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	logs     []string
+	fatal    bool
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+	f.fatal = true
+}
+
+func (f *fakeTB) Log(args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprint(args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+// finish runs the cleanups like the end of a test
+func (f *fakeTB) finish() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestObserverRecordsEntries(t *testing.T) {
+	logger, logs := NewObserver(zlog.WithName("api"), zlog.WithCaller(zlog.CallerShortPath))
+	ctx := context.WithValue(context.Background(), zlog.ReqIDKey, "req-1")
+
+	logger.Debug("starting")
+	logger.CtxInfof(ctx, "handled %s", "/users")
+	logger.Named("db").WarnErr(errors.New("slow"), "query", "rows", 42)
+
+	entries := logs.Entries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, hertzlog.LevelDebug, entries[0].Level)
+	assert.Equal(t, "api", entries[0].Logger)
+	assert.Contains(t, entries[0].Caller, "zlogtest_test.go:")
+	assert.WithinDuration(t, time.Now(), entries[0].Time, time.Minute)
+	assert.Equal(t, "handled /users", entries[1].Message)
+	assert.Equal(t, "req-1", entries[1].RequestID)
+	assert.Equal(t, hertzlog.LevelWarn, entries[2].Level)
+	assert.Equal(t, "db", entries[2].Logger)
+
+	assert.Len(t, logs.Filter(Level(hertzlog.LevelWarn)), 1)
+	assert.Empty(t, logs.Filter(Level(hertzlog.LevelNotice)))
+	assert.Len(t, logs.Filter(MinLevel(hertzlog.LevelInfo)), 2)
+	assert.Len(t, logs.Filter(Field("rows", 42), Logger("db")), 1)
+	assert.Len(t, logs.Filter(HasField("rows"), MessageContains("que")), 1)
+	assert.Len(t, logs.Filter(RequestID("req-1"), Message("handled /users")), 1)
+	assert.Empty(t, logs.Filter(TraceID("abc")))
+
+	logs.Reset()
+	assert.Zero(t, logs.Len())
+}
+
+func TestObserverRecordsNotice(t *testing.T) {
+	logger, logs := NewObserver()
+	logger.Notice("maintenance")
+	logger.Warn("slow")
+
+	entries := logs.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, hertzlog.LevelNotice, entries[0].Level)
+	assert.Empty(t, entries[0].Fields)
+	assert.Equal(t, hertzlog.LevelWarn, entries[1].Level)
+	assert.Len(t, logs.Filter(Level(hertzlog.LevelNotice)), 1)
+	assert.Len(t, logs.Filter(MinLevel(hertzlog.LevelWarn)), 1)
+}
+
+func TestAssertions(t *testing.T) {
+	logger, logs := NewObserver(zlog.WithLevel(hertzlog.LevelInfo))
+	logger.Debug("hidden")
+	logger.Info("ready")
+
+	ft := &fakeTB{}
+	assert.True(t, AssertLogged(ft, logs, Message("ready")))
+	assert.True(t, AssertNotLogged(ft, logs, Message("hidden")))
+	RequireNoErrors(ft, logs)
+	assert.Empty(t, ft.errors)
+
+	assert.False(t, AssertLogged(ft, logs, Level(hertzlog.LevelError)))
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], `info "ready"`)
+
+	logger.Errorf("failed: %d", 3)
+	assert.False(t, AssertNotLogged(ft, logs, MinLevel(hertzlog.LevelError)))
+	RequireNoErrors(ft, logs)
+	assert.True(t, ft.fatal)
+	assert.Contains(t, ft.errors[len(ft.errors)-1], `error "failed: 3"`)
+}
+
+func TestTestLoggerWritesToTestLog(t *testing.T) {
+	ft := &fakeTB{}
+	logger := NewTestLogger(ft, zlog.WithFormat(zlog.JSONFormat))
+	logger.Info("visible on failure")
+	require.Len(t, ft.logs, 1)
+	assert.Contains(t, ft.logs[0], `"message":"visible on failure"`)
+
+	ft.finish()
+	logger.Info("after the test")
+	assert.Len(t, ft.logs, 1)
+}
+
+func TestGoldenConsoleOutput(t *testing.T) {
+	clock := NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local))
+	var out bytes.Buffer
+	logger := zlog.New(zlog.WithOutput(&out), zlog.WithLevel(hertzlog.LevelDebug), zlog.WithClock(clock))
+	logger.Debug("connecting")
+	clock.Add(1500 * time.Millisecond)
+	logger.Named("http").Warnf("slow request %dms", 1200)
+	AssertGolden(t, "console", out.Bytes())
+
+	t.Setenv(UpdateGoldenEnv, "")
+	ft := &fakeTB{}
+	assert.False(t, AssertGolden(ft, "console", []byte("other\n")))
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], "+ other")
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewClock(start)
+	assert.Equal(t, start, clock.Now())
+	assert.Equal(t, start.Add(time.Minute), clock.Add(time.Minute))
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+
+	logger, logs := NewObserver(zlog.WithClock(clock))
+	logger.Info("stamped")
+	assert.Equal(t, start, logs.Entries()[0].Time.UTC())
+}